@@ -0,0 +1,431 @@
+/**
+ * This file contains archiving, exporting child tables to files before retention removes them (and restoring them again).
+ * Each child table is written to a gzipped CSV file in COPY's CSV format, beside a manifest with its row count and checksum.
+ * lib/pq can't COPY ... TO STDOUT, so rows are read with a query and written the way COPY would write them. Restoring uses COPY ... FROM STDIN.
+ */
+
+package gopartman
+
+import (
+	"bufio"
+	"compress/gzip"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// The format archive files are written in. Every value is quoted so that unquoted empty values can be NULL, like COPY's CSV format.
+const archiveFormat = "csv"
+
+// Describes an archived child table, saved as JSON beside the archive file.
+type ArchiveManifest struct {
+	// The child table which was archived and the parent table it belonged to (a sub-parent table for sub-partitions)
+	Table  string `json:"table"`
+	Parent string `json:"parent"`
+	Format string `json:"format"`
+	// The archive file, in the same directory as the manifest
+	File    string   `json:"file"`
+	Columns []string `json:"columns"`
+	Rows    int64    `json:"rows"`
+	// The size and SHA-256 checksum of the (compressed) archive file
+	Bytes  int64  `json:"bytes"`
+	SHA256 string `json:"sha256"`
+	// For native partitions, the values the child table held (a FOR VALUES clause) so it can be attached again
+	Bound    string    `json:"bound,omitempty"`
+	Archived time.Time `json:"archived"`
+}
+
+// Returns the paths of the archive file and manifest for a child table.
+func archivePaths(directory string, table string) (string, string) {
+	return filepath.Join(directory, table+"."+archiveFormat+".gz"), filepath.Join(directory, table+".json")
+}
+
+// Reads an archive manifest.
+func ReadArchiveManifest(path string) (ArchiveManifest, error) {
+	m := ArchiveManifest{}
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return m, err
+	}
+	if err := json.Unmarshal(b, &m); err != nil {
+		return m, fmt.Errorf("%w: %s is not an archive manifest: %s", ErrArchiveCorrupt, path, err.Error())
+	}
+	return m, nil
+}
+
+// Archives child tables to the partition's archive directory (if it has one). Child tables which are already archived (with the same
+// number of rows) are skipped, so an archive made before maintenance failed to remove the child table isn't made again.
+func (db DB) archiveChildren(p *Partition, tables []string) error {
+	if p.Options.ArchiveDirectory == "" {
+		return nil
+	}
+	for _, table := range tables {
+		if db.DryRun != nil {
+			file, _ := archivePaths(p.Options.ArchiveDirectory, table)
+			db.DryRun.preview(table + " would be archived to " + file)
+			continue
+		}
+		if _, err := db.ArchiveChild(p, table); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Archives the child tables of a pg_partman partition (and its sub-partitions) which run_maintenance() will remove under the retention period.
+// With no table, every configured partition with an archive directory is archived.
+func (db DB) archiveExpired(p *Partition) error {
+	if p.Table == "" {
+		for _, configured := range db.Partitions {
+			if configured.Options.ArchiveDirectory == "" || configured.isNative() {
+				continue
+			}
+			if err := db.archiveExpired(&configured); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if p.Options.ArchiveDirectory == "" {
+		return nil
+	}
+	tables := []string{p.Table}
+	if p.SubPartition != nil {
+		subs, err := db.subParents(p.Table)
+		if err != nil {
+			return err
+		}
+		tables = append(tables, subs...)
+	}
+	for _, table := range tables {
+		pc, err := db.partConfig(table)
+		if err != nil {
+			return err
+		}
+		if pc.Retention == "" || pc.UndoInProgress {
+			continue
+		}
+		expired, err := db.expiredPartmanChildren(pc, pc.Retention)
+		if err != nil {
+			return err
+		}
+		if err := db.archiveChildren(p, expired); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Exports a child table of a partition to the partition's archive directory, as a gzipped CSV file and a manifest.
+// The rows of any tables below the child table (sub-partitions) are included. Both files are written in full before they replace an older archive,
+// which is left as it was if it has the same checksum.
+func (db DB) ArchiveChild(p *Partition, table string) (ArchiveManifest, error) {
+	m := ArchiveManifest{Table: table, Parent: p.Table, Format: archiveFormat}
+	if p.Options.ArchiveDirectory == "" {
+		return m, fmt.Errorf("%w: %s has no archive directory", ErrInvalidPartition, p.Table)
+	}
+	file, manifest := archivePaths(p.Options.ArchiveDirectory, table)
+	m.File = filepath.Base(file)
+
+	if err := db.Select(&m.Columns, `SELECT attname FROM pg_attribute WHERE attrelid = $1::regclass AND attnum > 0 AND NOT attisdropped ORDER BY attnum`, table); err != nil {
+		return m, &SQLError{Op: "read columns", Table: table, Err: err}
+	}
+	// Child tables of sub-partitions belong to a sub-parent table, not the partition's
+	if err := db.Get(&m.Parent, `SELECT COALESCE((SELECT n.nspname || '.' || c.relname FROM pg_inherits i
+		JOIN pg_class c ON c.oid = i.inhparent JOIN pg_namespace n ON n.oid = c.relnamespace WHERE i.inhrelid = $1::regclass), $2)`, table, p.Table); err != nil {
+		return m, &SQLError{Op: "read parent table", Table: table, Err: err}
+	}
+	if p.isNative() {
+		if err := db.Get(&m.Bound, "SELECT COALESCE(pg_get_expr(relpartbound, oid), '') FROM pg_class WHERE oid = $1::regclass", table); err != nil {
+			return m, &SQLError{Op: "read partition bound", Table: table, Err: err}
+		}
+	}
+	if err := os.MkdirAll(p.Options.ArchiveDirectory, 0750); err != nil {
+		return m, err
+	}
+
+	// Every value is read as text, which is how COPY writes it
+	selects := make([]string, len(m.Columns))
+	for i, c := range m.Columns {
+		selects[i] = pq.QuoteIdentifier(c) + "::text"
+	}
+	result, err := db.Queryx("SELECT " + strings.Join(selects, ", ") + " FROM " + table)
+	if err != nil {
+		return m, &SQLError{Op: "read records", Table: table, Err: err}
+	}
+	defer result.Close()
+
+	tmp, err := ioutil.TempFile(p.Options.ArchiveDirectory, ".archive")
+	if err != nil {
+		return m, err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+	h := sha256.New()
+	gz := gzip.NewWriter(io.MultiWriter(tmp, h))
+	w := bufio.NewWriter(gz)
+
+	values := make([]sql.NullString, len(m.Columns))
+	dest := make([]interface{}, len(values))
+	for i := range values {
+		dest[i] = &values[i]
+	}
+	for result.Next() {
+		if err := result.Scan(dest...); err != nil {
+			return m, &SQLError{Op: "read records", Table: table, Err: err}
+		}
+		if err := writeCSVRecord(w, values); err != nil {
+			return m, err
+		}
+		m.Rows++
+	}
+	if err := result.Err(); err != nil {
+		return m, &SQLError{Op: "read records", Table: table, Err: err}
+	}
+	if err := w.Flush(); err != nil {
+		return m, err
+	}
+	if err := gz.Close(); err != nil {
+		return m, err
+	}
+	if err := tmp.Sync(); err != nil {
+		return m, err
+	}
+	info, err := tmp.Stat()
+	if err != nil {
+		return m, err
+	}
+	m.Bytes = info.Size()
+	m.SHA256 = hex.EncodeToString(h.Sum(nil))
+	m.Archived = time.Now()
+	if err := tmp.Close(); err != nil {
+		return m, err
+	}
+	// The rows are written every time (rows may have been updated since the last archive), but an identical archive is left as it was
+	if old, err := ReadArchiveManifest(manifest); err == nil && old.SHA256 == m.SHA256 && old.Rows == m.Rows && verifyArchive(file, old) == nil {
+		db.Log.Info(table + " has already been archived to " + file + ".")
+		return old, nil
+	}
+	if err := os.Rename(tmp.Name(), file); err != nil {
+		return m, err
+	}
+
+	b, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return m, err
+	}
+	if err := writeFileAtomic(manifest, append(b, '\n'), 0640); err != nil {
+		return m, err
+	}
+	db.Log.Info("Archived " + strconv.FormatInt(m.Rows, 10) + " rows from " + table + " to " + file + ".")
+	return m, nil
+}
+
+// Creates an archived child table again from its manifest, loads its rows and makes it a child table of the partition again
+// (by inheritance for pg_partman partitions, attached with its old bound for native partitions). The archive file's checksum
+// and row count are checked, nothing is changed if they don't match. Maintenance will remove it again if it's still past the
+// retention period.
+func (db DB) RestoreArchive(p *Partition, manifestPath string) (ArchiveManifest, error) {
+	m, err := ReadArchiveManifest(manifestPath)
+	if err != nil {
+		return m, err
+	}
+	parents := []string{p.Table}
+	if p.SubPartition != nil {
+		subs, err := db.subParents(p.Table)
+		if err != nil {
+			return m, err
+		}
+		parents = append(parents, subs...)
+	}
+	if !stringInSlice(m.Parent, parents) {
+		return m, fmt.Errorf("%w: %s was archived from %s, not %s", ErrArchiveCorrupt, m.Table, m.Parent, p.Table)
+	}
+	if m.Format != archiveFormat || len(m.Columns) == 0 {
+		return m, fmt.Errorf("%w: %s is not a %s archive", ErrArchiveCorrupt, manifestPath, archiveFormat)
+	}
+	if p.isNative() && m.Bound == "" {
+		return m, fmt.Errorf("%w: %s has no partition bound to attach it with", ErrArchiveCorrupt, m.Table)
+	}
+	var exists bool
+	if err := db.Get(&exists, "SELECT to_regclass($1) IS NOT NULL", m.Table); err != nil {
+		return m, &SQLError{Op: "check table", Table: m.Table, Err: err}
+	}
+	if exists {
+		return m, fmt.Errorf("%w: %s", ErrTableExists, m.Table)
+	}
+
+	path := filepath.Join(filepath.Dir(manifestPath), m.File)
+	if err := verifyArchive(path, m); err != nil {
+		return m, err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return m, err
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return m, fmt.Errorf("%w: %s", ErrArchiveCorrupt, err.Error())
+	}
+	defer gz.Close()
+	r := bufio.NewReader(gz)
+
+	attach := "ALTER TABLE " + m.Table + " INHERIT " + m.Parent
+	if p.isNative() {
+		attach = "ALTER TABLE " + m.Parent + " ATTACH PARTITION " + m.Table + " " + m.Bound
+	}
+	schema, name := m.Table, m.Table
+	if i := strings.Index(m.Table, "."); i >= 0 {
+		schema, name = m.Table[:i], m.Table[i+1:]
+	}
+	copyIn := pq.CopyInSchema(schema, name, m.Columns...)
+
+	// In dry-run mode the rows aren't loaded, only counted
+	if db.DryRun != nil {
+		tx, _ := db.begin()
+		tx.Exec("CREATE TABLE " + m.Table + " (LIKE " + m.Parent + " INCLUDING ALL)")
+		tx.Exec(copyIn)
+		tx.Exec(attach)
+		tx.Commit()
+		db.DryRun.preview(strconv.FormatInt(m.Rows, 10) + " rows would be loaded into " + m.Table + " from " + path)
+		return m, nil
+	}
+
+	tx, err := db.Beginx()
+	if err != nil {
+		return m, &SQLError{Op: "begin", Table: p.Table, Err: err}
+	}
+	fail := func(op string, err error) (ArchiveManifest, error) {
+		tx.Rollback()
+		return m, &SQLError{Op: op, Table: m.Table, Err: err}
+	}
+	if _, err := tx.Exec("CREATE TABLE " + m.Table + " (LIKE " + m.Parent + " INCLUDING ALL)"); err != nil {
+		return fail("create table", err)
+	}
+	stmt, err := tx.Prepare(copyIn)
+	if err != nil {
+		return fail("copy records", err)
+	}
+	var rows int64
+	for {
+		record, err := readCSVRecord(r)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			stmt.Close()
+			tx.Rollback()
+			return m, fmt.Errorf("%w: %s", ErrArchiveCorrupt, err.Error())
+		}
+		if len(record) != len(m.Columns) {
+			stmt.Close()
+			tx.Rollback()
+			return m, fmt.Errorf("%w: row %d has %d values, there are %d columns", ErrArchiveCorrupt, rows+1, len(record), len(m.Columns))
+		}
+		if _, err := stmt.Exec(record...); err != nil {
+			stmt.Close()
+			return fail("copy records", err)
+		}
+		rows++
+	}
+	if _, err := stmt.Exec(); err != nil {
+		stmt.Close()
+		return fail("copy records", err)
+	}
+	if err := stmt.Close(); err != nil {
+		return fail("copy records", err)
+	}
+	if rows != m.Rows {
+		tx.Rollback()
+		return m, fmt.Errorf("%w: %s has %d rows, the manifest says %d", ErrArchiveCorrupt, path, rows, m.Rows)
+	}
+	if _, err := tx.Exec(attach); err != nil {
+		return fail("attach to "+m.Parent, err)
+	}
+	if err := tx.Commit(); err != nil {
+		return m, &SQLError{Op: "commit", Table: m.Table, Err: err}
+	}
+	db.Log.Info("Restored " + strconv.FormatInt(rows, 10) + " rows to " + m.Table + " from " + path + ".")
+	return m, nil
+}
+
+// Checks an archive file's size and checksum against its manifest.
+func verifyArchive(path string, m ArchiveManifest) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	h := sha256.New()
+	n, err := io.Copy(h, f)
+	if err != nil {
+		return err
+	}
+	if n != m.Bytes || hex.EncodeToString(h.Sum(nil)) != m.SHA256 {
+		return fmt.Errorf("%w: the checksum of %s doesn't match its manifest", ErrArchiveCorrupt, path)
+	}
+	return nil
+}
+
+// Writes a row in COPY's CSV format. NULLs are left empty and every other value is quoted (so an empty string is "").
+func writeCSVRecord(w *bufio.Writer, values []sql.NullString) error {
+	for i, v := range values {
+		if i > 0 {
+			w.WriteByte(',')
+		}
+		if v.Valid {
+			w.WriteByte('"')
+			w.WriteString(strings.ReplaceAll(v.String, `"`, `""`))
+			w.WriteByte('"')
+		}
+	}
+	return w.WriteByte('\n')
+}
+
+// Reads a row written by writeCSVRecord(). Quoted values are strings (which may span lines), empty unquoted values are NULL (nil).
+func readCSVRecord(r *bufio.Reader) ([]interface{}, error) {
+	record := []interface{}{}
+	for {
+		c, err := r.ReadByte()
+		if err == io.EOF && len(record) == 0 {
+			return nil, io.EOF
+		}
+		var value interface{}
+		if err == nil && c == '"' {
+			var sb strings.Builder
+			for {
+				if c, err = r.ReadByte(); err != nil {
+					return nil, fmt.Errorf("unterminated value in row: %s", err.Error())
+				}
+				if c == '"' {
+					if c, err = r.ReadByte(); err != nil || c != '"' {
+						break
+					}
+				}
+				sb.WriteByte(c)
+			}
+			value = sb.String()
+		}
+		record = append(record, value)
+		switch {
+		case err == io.EOF || (err == nil && c == '\n'):
+			return record, nil
+		case err != nil:
+			return nil, err
+		case c != ',':
+			return nil, fmt.Errorf("unexpected %q after a value", c)
+		}
+	}
+}
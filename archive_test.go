@@ -0,0 +1,92 @@
+package gopartman
+
+import (
+	"bufio"
+	"bytes"
+	"database/sql"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCSVRecordRoundTrip(t *testing.T) {
+	null := sql.NullString{}
+	value := func(s string) sql.NullString { return sql.NullString{String: s, Valid: true} }
+	tests := []struct {
+		values  []sql.NullString
+		written string
+	}{
+		{[]sql.NullString{value("1"), value("hello")}, `"1","hello"` + "\n"},
+		{[]sql.NullString{value("1"), null, value("")}, `"1",,""` + "\n"},
+		{[]sql.NullString{null}, "\n"},
+		{[]sql.NullString{null, null}, ",\n"},
+		{[]sql.NullString{value(`say "hi"`), value("a,b")}, `"say ""hi""","a,b"` + "\n"},
+		{[]sql.NullString{value("two\nlines"), value("\r\n")}, "\"two\nlines\",\"\r\n\"\n"},
+		{[]sql.NullString{value(`""`), value(`"`)}, `"""""",""""` + "\n"},
+	}
+	for _, test := range tests {
+		var buf bytes.Buffer
+		w := bufio.NewWriter(&buf)
+		if err := writeCSVRecord(w, test.values); err != nil {
+			t.Fatalf("writeCSVRecord(%v) returned %v", test.values, err)
+		}
+		w.Flush()
+		if buf.String() != test.written {
+			t.Errorf("writeCSVRecord(%v) wrote %q, want %q", test.values, buf.String(), test.written)
+		}
+
+		want := make([]interface{}, len(test.values))
+		for i, v := range test.values {
+			if v.Valid {
+				want[i] = v.String
+			}
+		}
+		r := bufio.NewReader(&buf)
+		got, err := readCSVRecord(r)
+		if err != nil || !reflect.DeepEqual(got, want) {
+			t.Errorf("readCSVRecord(%q) returned %#v, %v, want %#v", test.written, got, err, want)
+		}
+		if _, err := readCSVRecord(r); err != io.EOF {
+			t.Errorf("readCSVRecord(%q) after the last row returned %v, want io.EOF", test.written, err)
+		}
+	}
+}
+
+func TestReadCSVRecord(t *testing.T) {
+	tests := []struct {
+		data  string
+		want  [][]interface{}
+		valid bool
+	}{
+		{"", nil, true},
+		{`"1","a"` + "\n" + `"2",` + "\n", [][]interface{}{{"1", "a"}, {"2", nil}}, true},
+		// The last row doesn't need a newline
+		{`"1","a"`, [][]interface{}{{"1", "a"}}, true},
+		{`"1",`, [][]interface{}{{"1", nil}}, true},
+		{`"unterminated`, nil, false},
+		{`"1"x,"2"` + "\n", nil, false},
+		{`1,2` + "\n", nil, false},
+	}
+	for _, test := range tests {
+		r := bufio.NewReader(strings.NewReader(test.data))
+		var got [][]interface{}
+		var err error
+		for {
+			var record []interface{}
+			if record, err = readCSVRecord(r); err != nil {
+				break
+			}
+			got = append(got, record)
+		}
+		if !test.valid {
+			if err == io.EOF {
+				t.Errorf("readCSVRecord(%q) read %#v, want an error", test.data, got)
+			}
+			continue
+		}
+		if err != io.EOF || !reflect.DeepEqual(got, test.want) {
+			t.Errorf("readCSVRecord(%q) read %#v, %v, want %#v", test.data, got, err, test.want)
+		}
+	}
+}
@@ -0,0 +1,139 @@
+/**
+ * This file contains functions for working out the range of values each child table of a pg_partman partition set holds.
+ * pg_partman names child tables after the start of their range, formatted with the partition set's datetime_string (or the first id),
+ * so these work the ranges out from the names the same way pg_partman's own functions do.
+ */
+
+package gopartman
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The datetime_string formats pg_partman names time child tables with, as time.Format layouts.
+// Quarterly ("YYYY"q"Q") and weekly ("IYYY"w"IW") child tables don't have one, see partmanChildTime().
+var datetimeLayouts = map[string]string{
+	"YYYY":                "2006",
+	"YYYY_MM":             "2006_01",
+	"YYYY_MM_DD":          "2006_01_02",
+	"YYYY_MM_DD_HH24MI":   "2006_01_02_1504",
+	"YYYY_MM_DD_HH24MISS": "2006_01_02_150405",
+}
+
+// The range of values a pg_partman child table holds, from the start up to (but not including) the end.
+// Only the times or the ids are set, depending on the partition set's type.
+type childBounds struct {
+	From   time.Time
+	To     time.Time
+	FromId int64
+	ToId   int64
+}
+
+// Returns the part of a child table's name after the last "_p", which is the start of its range.
+func partmanChildSuffix(child string) (string, error) {
+	i := strings.LastIndex(child, "_p")
+	if i < 0 {
+		return "", fmt.Errorf("%s is not named like a pg_partman child table", child)
+	}
+	return child[i+2:], nil
+}
+
+// Works out the range of values a child table of a pg_partman partition set holds from its name.
+func partmanChildBounds(pc PartConfig, child string) (childBounds, error) {
+	ni, err := parseNativeInterval(pc.PartInterval)
+	if err != nil {
+		return childBounds{}, err
+	}
+	suffix, err := partmanChildSuffix(child)
+	if err != nil {
+		return childBounds{}, err
+	}
+	if strings.HasPrefix(pc.Type, "id-") {
+		from, err := strconv.ParseInt(suffix, 10, 64)
+		if err != nil || ni.id == 0 {
+			return childBounds{}, fmt.Errorf("%s is not named like a child table of an id partition", child)
+		}
+		return childBounds{FromId: from, ToId: from + ni.id}, nil
+	}
+	if ni.id > 0 {
+		return childBounds{}, fmt.Errorf("%s is not a time interval", pc.PartInterval)
+	}
+	from, err := partmanChildTime(pc.DatetimeString, suffix)
+	if err != nil {
+		return childBounds{}, fmt.Errorf("%s is not named like a child table of a time partition: %s", child, err.Error())
+	}
+	return childBounds{From: from, To: ni.next(from)}, nil
+}
+
+// Parses the start of a time child table's range from the suffix of its name (a wall clock time, like pg_partman's to_timestamp()).
+func partmanChildTime(datetimeString string, suffix string) (time.Time, error) {
+	switch datetimeString {
+	case `YYYY"q"Q`:
+		parts := strings.Split(suffix, "q")
+		if len(parts) != 2 {
+			return time.Time{}, fmt.Errorf("%s is not a quarter", suffix)
+		}
+		year, err := strconv.Atoi(parts[0])
+		if err != nil {
+			return time.Time{}, err
+		}
+		quarter, err := strconv.Atoi(parts[1])
+		if err != nil || quarter < 1 || quarter > 4 {
+			return time.Time{}, fmt.Errorf("%s is not a quarter", suffix)
+		}
+		return time.Date(year, time.Month((quarter-1)*3+1), 1, 0, 0, 0, 0, time.UTC), nil
+	case `IYYY"w"IW`:
+		parts := strings.Split(suffix, "w")
+		if len(parts) != 2 {
+			return time.Time{}, fmt.Errorf("%s is not an ISO week", suffix)
+		}
+		year, err := strconv.Atoi(parts[0])
+		if err != nil {
+			return time.Time{}, err
+		}
+		week, err := strconv.Atoi(parts[1])
+		if err != nil || week < 1 || week > 53 {
+			return time.Time{}, fmt.Errorf("%s is not an ISO week", suffix)
+		}
+		// Week 1 is the one with January 4th in it, weeks start on Monday
+		jan4 := time.Date(year, time.January, 4, 0, 0, 0, 0, time.UTC)
+		weekday := int(jan4.Weekday())
+		if weekday == 0 {
+			weekday = 7
+		}
+		return jan4.AddDate(0, 0, 1-weekday+(week-1)*7), nil
+	}
+	layout, ok := datetimeLayouts[datetimeString]
+	if !ok {
+		return time.Time{}, fmt.Errorf("unknown datetime_string %s", datetimeString)
+	}
+	return time.ParseInLocation(layout, suffix, time.UTC)
+}
+
+// Formats the start of a time child table's range the way pg_partman puts it in the child table's name.
+func partmanTimeSuffix(datetimeString string, t time.Time) string {
+	switch datetimeString {
+	case `YYYY"q"Q`:
+		return fmt.Sprintf("%dq%d", t.Year(), (int(t.Month())-1)/3+1)
+	case `IYYY"w"IW`:
+		year, week := t.ISOWeek()
+		return fmt.Sprintf("%dw%02d", year, week)
+	}
+	return t.Format(datetimeLayouts[datetimeString])
+}
+
+// Returns the name pg_partman gives a child table of a parent table (see partman.check_name_length()).
+// The parent table's name is cut short so the child table's name fits in Postgres' 63 characters.
+func partmanChildName(parent string, suffix string) string {
+	schema, table := "public", parent
+	if i := strings.Index(parent, "."); i >= 0 {
+		schema, table = parent[:i], parent[i+1:]
+	}
+	if len(table)+len(suffix) >= 61 {
+		table = table[:61-len(suffix)]
+	}
+	return schema + "." + table + "_p" + suffix
+}
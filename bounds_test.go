@@ -0,0 +1,141 @@
+package gopartman
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPartmanChildBounds(t *testing.T) {
+	day := func(year int, month time.Month, d int) time.Time {
+		return time.Date(year, month, d, 0, 0, 0, 0, time.UTC)
+	}
+	tests := []struct {
+		pc    PartConfig
+		child string
+		want  childBounds
+		valid bool
+	}{
+		{
+			PartConfig{Type: "time-static", PartInterval: "1 day", DatetimeString: "YYYY_MM_DD"},
+			"public.events_p2020_02_28",
+			childBounds{From: day(2020, time.February, 28), To: day(2020, time.February, 29)},
+			true,
+		},
+		{
+			PartConfig{Type: "time-static", PartInterval: "1 mon", DatetimeString: "YYYY_MM"},
+			"public.events_p2020_12",
+			childBounds{From: day(2020, time.December, 1), To: day(2021, time.January, 1)},
+			true,
+		},
+		{
+			PartConfig{Type: "time-dynamic", PartInterval: "1 year", DatetimeString: "YYYY"},
+			"public.events_p2019",
+			childBounds{From: day(2019, time.January, 1), To: day(2020, time.January, 1)},
+			true,
+		},
+		{
+			PartConfig{Type: "time-static", PartInterval: "3 mons", DatetimeString: `YYYY"q"Q`},
+			"public.events_p2020q3",
+			childBounds{From: day(2020, time.July, 1), To: day(2020, time.October, 1)},
+			true,
+		},
+		{
+			// Week 1 of 2021 starts on Monday January 4th
+			PartConfig{Type: "time-static", PartInterval: "7 days", DatetimeString: `IYYY"w"IW`},
+			"public.events_p2021w01",
+			childBounds{From: day(2021, time.January, 4), To: day(2021, time.January, 11)},
+			true,
+		},
+		{
+			// Week 1 of 2020 starts on Monday December 30th 2019
+			PartConfig{Type: "time-static", PartInterval: "7 days", DatetimeString: `IYYY"w"IW`},
+			"public.events_p2020w01",
+			childBounds{From: day(2019, time.December, 30), To: day(2020, time.January, 6)},
+			true,
+		},
+		{
+			PartConfig{Type: "time-static", PartInterval: "01:00:00", DatetimeString: "YYYY_MM_DD_HH24MI"},
+			"public.events_p2020_01_01_2300",
+			childBounds{From: time.Date(2020, time.January, 1, 23, 0, 0, 0, time.UTC), To: day(2020, time.January, 2)},
+			true,
+		},
+		{
+			PartConfig{Type: "time-custom", PartInterval: "00:00:30", DatetimeString: "YYYY_MM_DD_HH24MISS"},
+			"public.events_p2020_01_01_000030",
+			childBounds{From: time.Date(2020, time.January, 1, 0, 0, 30, 0, time.UTC), To: time.Date(2020, time.January, 1, 0, 1, 0, 0, time.UTC)},
+			true,
+		},
+		{
+			PartConfig{Type: "id-static", PartInterval: "1000"},
+			"public.orders_p3000",
+			childBounds{FromId: 3000, ToId: 4000},
+			true,
+		},
+		{
+			// Parent tables with "_p" in their name are cut at the last one, like pg_partman does
+			PartConfig{Type: "id-dynamic", PartInterval: "500"},
+			"public.tmp_pings_p0",
+			childBounds{FromId: 0, ToId: 500},
+			true,
+		},
+		{PartConfig{Type: "id-static", PartInterval: "1000"}, "public.orders_pabc", childBounds{}, false},
+		{PartConfig{Type: "id-static", PartInterval: "1 day"}, "public.orders_p3000", childBounds{}, false},
+		{PartConfig{Type: "time-static", PartInterval: "1000", DatetimeString: "YYYY"}, "public.events_p2020", childBounds{}, false},
+		{PartConfig{Type: "time-static", PartInterval: "1 day", DatetimeString: "YYYY_MM_DD"}, "public.events", childBounds{}, false},
+		{PartConfig{Type: "time-static", PartInterval: "1 day", DatetimeString: "YYYY_MM_DD"}, "public.events_p2020_13_01", childBounds{}, false},
+		{PartConfig{Type: "time-static", PartInterval: "3 mons", DatetimeString: `YYYY"q"Q`}, "public.events_p2020q5", childBounds{}, false},
+		{PartConfig{Type: "time-static", PartInterval: "1 day", DatetimeString: "DD_MM_YYYY"}, "public.events_p01_01_2020", childBounds{}, false},
+		{PartConfig{Type: "time-static", PartInterval: "whenever", DatetimeString: "YYYY"}, "public.events_p2020", childBounds{}, false},
+	}
+	for _, test := range tests {
+		got, err := partmanChildBounds(test.pc, test.child)
+		if !test.valid {
+			if err == nil {
+				t.Errorf("partmanChildBounds(%s) for %s returned %+v, want an error", test.child, test.pc.PartInterval, got)
+			}
+			continue
+		}
+		if err != nil || !got.From.Equal(test.want.From) || !got.To.Equal(test.want.To) || got.FromId != test.want.FromId || got.ToId != test.want.ToId {
+			t.Errorf("partmanChildBounds(%s) for %s returned %+v, %v, want %+v", test.child, test.pc.PartInterval, got, err, test.want)
+		}
+	}
+}
+
+func TestPartmanChildName(t *testing.T) {
+	long := "a_very_long_table_name_that_goes_on_and_on_for_quite_some_time"
+	tests := []struct {
+		parent string
+		suffix string
+		want   string
+	}{
+		{"public.events", "2020_01_01", "public.events_p2020_01_01"},
+		{"events", "3000", "public.events_p3000"},
+		{"stats." + long, "2020_01_01", "stats." + long[:51] + "_p2020_01_01"},
+	}
+	for _, test := range tests {
+		if got := partmanChildName(test.parent, test.suffix); got != test.want {
+			t.Errorf("partmanChildName(%s, %s) returned %s, want %s", test.parent, test.suffix, got, test.want)
+		}
+	}
+}
+
+func TestPartmanTimeSuffix(t *testing.T) {
+	at := time.Date(2020, time.November, 5, 13, 45, 10, 0, time.UTC)
+	tests := []struct {
+		datetimeString string
+		want           string
+	}{
+		{"YYYY", "2020"},
+		{"YYYY_MM", "2020_11"},
+		{"YYYY_MM_DD", "2020_11_05"},
+		{"YYYY_MM_DD_HH24MI", "2020_11_05_1345"},
+		{"YYYY_MM_DD_HH24MISS", "2020_11_05_134510"},
+		{`YYYY"q"Q`, "2020q4"},
+		{`IYYY"w"IW`, "2020w45"},
+	}
+	for _, test := range tests {
+		if got := partmanTimeSuffix(test.datetimeString, at); got != test.want {
+			t.Errorf("partmanTimeSuffix(%s) returned %s, want %s", test.datetimeString, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,341 @@
+/**
+ * This file contains charts of a partition's child tables, rendered as SVG or PNG without anything beyond the standard library.
+ * They're simple horizontal bar charts (one bar for each child table, or each day of snapshots) meant to be embedded in wiki pages and dashboards.
+ * PNG text is drawn with a tiny built in pixel font, which only has one case and the characters table names and values need.
+ */
+
+package gopartman
+
+import (
+	"fmt"
+	"html"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// What a chart of child tables can show.
+const (
+	ChartRows  = "rows"
+	ChartBytes = "bytes"
+)
+
+// The smallest and largest charts that will be drawn, in pixels.
+const (
+	minChartSize = 100
+	maxChartSize = 4000
+)
+
+// The most bars a chart can have, so each one still gets a few pixels in the tallest chart.
+const maxChartBars = 1000
+
+// A bar in a chart.
+type ChartBar struct {
+	Label string  `json:"label"`
+	Value float64 `json:"value"`
+}
+
+// A horizontal bar chart. With no height, it's as tall as the bars need (up to the largest chart).
+type Chart struct {
+	Title  string     `json:"title"`
+	Metric string     `json:"metric"`
+	Bars   []ChartBar `json:"bars"`
+	Width  int        `json:"width"`
+	Height int        `json:"height"`
+}
+
+// What to chart for a partition's child tables.
+type ChartOptions struct {
+	// ChartRows (the default) or ChartBytes
+	Metric string
+	// Only child tables holding values from this many days ago onwards (time partitions only, 0 for every child table).
+	// For daily charts, how many days to show (30 if not set).
+	Days int
+	// Charts the partition's totals for each day from its snapshots (see stats.go) instead of each child table
+	Daily bool
+	// In pixels, 800 wide if not set. With no height, the chart is as tall as the bars need.
+	Width  int
+	Height int
+}
+
+// Returns a chart of the rows (or bytes on disk) in each of a partition's child tables.
+func (db DB) ChildChart(p *Partition, opts ChartOptions) (Chart, error) {
+	c := Chart{Metric: opts.Metric, Width: opts.Width, Height: opts.Height, Bars: []ChartBar{}}
+	if c.Metric == "" {
+		c.Metric = ChartRows
+	}
+	if c.Width == 0 {
+		c.Width = 800
+	}
+	if c.Metric != ChartRows && c.Metric != ChartBytes {
+		return c, fmt.Errorf("%w: metric must be %s or %s", ErrInvalidChart, ChartRows, ChartBytes)
+	}
+	if c.Width < minChartSize || c.Width > maxChartSize || (c.Height != 0 && (c.Height < minChartSize || c.Height > maxChartSize)) {
+		return c, fmt.Errorf("%w: width and height must be between %d and %d pixels", ErrInvalidChart, minChartSize, maxChartSize)
+	}
+	if opts.Days < 0 {
+		return c, fmt.Errorf("%w: days can't be negative", ErrInvalidChart)
+	}
+	if opts.Daily {
+		return db.dailyChart(p, c, opts.Days)
+	}
+	if opts.Days > 0 && (p.idBased() || p.Type == ListType || p.Type == HashType) {
+		return c, fmt.Errorf("%w: days only applies to time partitions", ErrInvalidChart)
+	}
+
+	children, err := db.GetChildPartitions(p)
+	if err != nil {
+		return c, err
+	}
+	// Child tables which hold values from before the window are left out (as is the default child table, which has no range)
+	var from time.Time
+	var bounds func(child string) (childBounds, error)
+	if opts.Days > 0 {
+		if bounds, err = db.childRanges(p); err != nil {
+			return c, err
+		}
+		now, err := db.partitionNow(p)
+		if err != nil {
+			return c, err
+		}
+		from = now.AddDate(0, 0, -opts.Days)
+	}
+	for _, child := range children {
+		if bounds != nil {
+			b, err := bounds(child.Table)
+			if err != nil || !b.To.After(from) {
+				continue
+			}
+		}
+		bar := ChartBar{Label: strings.TrimPrefix(child.Table, strings.SplitN(p.Table, ".", 2)[0]+"."), Value: float64(child.Records)}
+		if c.Metric == ChartBytes {
+			bar.Value = float64(child.BytesOnDisk)
+		}
+		c.Bars = append(c.Bars, bar)
+	}
+
+	c.Title = p.Table + " " + c.Metric + " per child table"
+	if opts.Days > 0 {
+		c.Title += " (last " + strconv.Itoa(opts.Days) + " days)"
+	}
+	return c, c.checkBars()
+}
+
+// Fills in a chart of a partition's totals for each of the last given number of days.
+func (db DB) dailyChart(p *Partition, c Chart, days int) (Chart, error) {
+	if days == 0 {
+		days = 30
+	}
+	stats, err := db.DailyStats(p, days)
+	if err != nil {
+		return c, err
+	}
+	for _, day := range stats {
+		bar := ChartBar{Label: day.Day.Format("2006-01-02"), Value: float64(day.Rows)}
+		if c.Metric == ChartBytes {
+			bar.Value = float64(day.Bytes)
+		}
+		c.Bars = append(c.Bars, bar)
+	}
+	c.Title = p.Table + " " + c.Metric + " per day (last " + strconv.Itoa(days) + " days)"
+	return c, c.checkBars()
+}
+
+// Checks that a chart doesn't have more bars than fit in it.
+func (c Chart) checkBars() error {
+	if len(c.Bars) > maxChartBars {
+		return fmt.Errorf("%w: there are %d bars to show, a chart can show at most %d (ask for fewer days)", ErrInvalidChart, len(c.Bars), maxChartBars)
+	}
+	return nil
+}
+
+// Where everything in a chart goes, in pixels.
+type chartLayout struct {
+	width, height int
+	// The bars start below the title and after the labels, leaving room for the values after them
+	top, left, barWidth  int
+	barHeight, rowHeight int
+	max                  float64
+	// How many characters of a label fit before the bars
+	labelChars int
+}
+
+const chartMargin = 10
+
+// Works out where everything in a chart goes, given how wide each character of text is and how tall a line is.
+func (c Chart) layout(charWidth int, lineHeight int) chartLayout {
+	l := chartLayout{width: c.Width, height: c.Height, top: chartMargin + lineHeight*2}
+	longest := 0
+	for _, bar := range c.Bars {
+		if len(bar.Label) > longest {
+			longest = len(bar.Label)
+		}
+		if bar.Value > l.max {
+			l.max = bar.Value
+		}
+	}
+	l.left = chartMargin + longest*charWidth + charWidth
+	if l.left > c.Width/2 {
+		l.left = c.Width / 2
+	}
+	l.labelChars = (l.left - chartMargin - charWidth) / charWidth
+	// Room for values like "123.4 MB" after the longest bar
+	l.barWidth = c.Width - l.left - chartMargin - 10*charWidth
+	if l.barWidth < 1 {
+		l.barWidth = 1
+	}
+	l.rowHeight = lineHeight + lineHeight/2
+	// A chart that's as tall as the bars need is still no taller than the largest chart, the bars are squeezed in instead
+	if l.height == 0 {
+		l.height = l.top + len(c.Bars)*l.rowHeight + chartMargin
+		if l.height > maxChartSize {
+			l.height = maxChartSize
+			l.rowHeight = (l.height - l.top - chartMargin) / len(c.Bars)
+		}
+	} else if len(c.Bars) > 0 {
+		l.rowHeight = (l.height - l.top - chartMargin) / len(c.Bars)
+	}
+	if l.rowHeight < 1 {
+		l.rowHeight = 1
+	}
+	l.barHeight = l.rowHeight * 3 / 4
+	if l.barHeight < 1 {
+		l.barHeight = 1
+	}
+	return l
+}
+
+// Cuts the start off a label which is too long to fit before the bars (the end of a child table's name is what tells them apart).
+func (l chartLayout) label(s string) string {
+	if len(s) > l.labelChars && l.labelChars > 0 {
+		return s[len(s)-l.labelChars:]
+	}
+	return s
+}
+
+// How long a bar is, in pixels.
+func (l chartLayout) length(v float64) int {
+	if l.max <= 0 {
+		return 0
+	}
+	return int(v / l.max * float64(l.barWidth))
+}
+
+// Formats a chart value, with units for bytes and abbreviated for rows (1.5M).
+func (c Chart) format(v float64) string {
+	units, base := []string{"", "k", "M", "B", "T"}, 1000.0
+	if c.Metric == ChartBytes {
+		units, base = []string{"B", "kB", "MB", "GB", "TB"}, 1024.0
+	}
+	i := 0
+	for v >= base && i < len(units)-1 {
+		v /= base
+		i++
+	}
+	s := strconv.FormatFloat(v, 'f', 1, 64)
+	if i == 0 {
+		s = strconv.FormatFloat(v, 'f', 0, 64)
+	}
+	if c.Metric == ChartBytes {
+		return s + " " + units[i]
+	}
+	return s + units[i]
+}
+
+var (
+	chartBarColor  = color.RGBA{0x4e, 0x79, 0xa7, 0xff}
+	chartTextColor = color.RGBA{0x33, 0x33, 0x33, 0xff}
+)
+
+// Writes the chart as an SVG image.
+func (c Chart) SVG(w io.Writer) error {
+	const fontSize = 12
+	// A monospace character is about 0.6em wide
+	l := c.layout(fontSize*6/10+1, fontSize+4)
+	var b strings.Builder
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" font-family="monospace" font-size="%d">`+"\n",
+		l.width, l.height, l.width, l.height, fontSize)
+	fmt.Fprintf(&b, `<rect width="100%%" height="100%%" fill="#ffffff"/>`+"\n")
+	fmt.Fprintf(&b, `<text x="%d" y="%d" font-size="%d" fill="#333333">%s</text>`+"\n", chartMargin, chartMargin+fontSize, fontSize+2, html.EscapeString(c.Title))
+	if len(c.Bars) == 0 {
+		fmt.Fprintf(&b, `<text x="%d" y="%d" fill="#333333">nothing to show</text>`+"\n", chartMargin, l.top+fontSize)
+	}
+	for i, bar := range c.Bars {
+		y := l.top + i*l.rowHeight
+		textY := y + l.barHeight/2 + fontSize/3
+		fmt.Fprintf(&b, `<text x="%d" y="%d" text-anchor="end" fill="#333333">%s</text>`+"\n", l.left-fontSize/2, textY, html.EscapeString(l.label(bar.Label)))
+		length := l.length(bar.Value)
+		fmt.Fprintf(&b, `<rect x="%d" y="%d" width="%d" height="%d" fill="#4e79a7"><title>%s: %s</title></rect>`+"\n",
+			l.left, y, length, l.barHeight, html.EscapeString(bar.Label), strconv.FormatFloat(bar.Value, 'f', -1, 64))
+		fmt.Fprintf(&b, `<text x="%d" y="%d" fill="#333333">%s</text>`+"\n", l.left+length+fontSize/2, textY, c.format(bar.Value))
+	}
+	b.WriteString("</svg>\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// Writes the chart as a PNG image.
+func (c Chart) PNG(w io.Writer) error {
+	const scale = 2
+	charWidth, lineHeight := (glyphWidth+1)*scale, (glyphHeight+3)*scale
+	l := c.layout(charWidth, lineHeight)
+	img := image.NewRGBA(image.Rect(0, 0, l.width, l.height))
+	draw.Draw(img, img.Bounds(), image.White, image.Point{}, draw.Src)
+
+	drawText(img, chartMargin, chartMargin, c.Title, scale)
+	if len(c.Bars) == 0 {
+		drawText(img, chartMargin, l.top, "nothing to show", scale)
+	}
+	for i, bar := range c.Bars {
+		y := l.top + i*l.rowHeight
+		textY := y + (l.barHeight-glyphHeight*scale)/2
+		label := l.label(bar.Label)
+		drawText(img, l.left-charWidth-len(label)*charWidth, textY, label, scale)
+		length := l.length(bar.Value)
+		draw.Draw(img, image.Rect(l.left, y, l.left+length, y+l.barHeight), &image.Uniform{chartBarColor}, image.Point{}, draw.Src)
+		drawText(img, l.left+length+charWidth, textY, c.format(bar.Value), scale)
+	}
+	return png.Encode(w, img)
+}
+
+// The size of the pixel font's characters, before they're scaled.
+const (
+	glyphWidth  = 3
+	glyphHeight = 5
+)
+
+// A 3x5 pixel font. Each row of a character is 3 bits, the highest is the left most pixel.
+var glyphs = map[rune][glyphHeight]uint8{
+	'0': {7, 5, 5, 5, 7}, '1': {2, 6, 2, 2, 7}, '2': {7, 1, 7, 4, 7}, '3': {7, 1, 7, 1, 7}, '4': {5, 5, 7, 1, 1},
+	'5': {7, 4, 7, 1, 7}, '6': {7, 4, 7, 5, 7}, '7': {7, 1, 2, 2, 2}, '8': {7, 5, 7, 5, 7}, '9': {7, 5, 7, 1, 7},
+	'a': {2, 5, 7, 5, 5}, 'b': {6, 5, 6, 5, 6}, 'c': {3, 4, 4, 4, 3}, 'd': {6, 5, 5, 5, 6}, 'e': {7, 4, 6, 4, 7},
+	'f': {7, 4, 6, 4, 4}, 'g': {3, 4, 5, 5, 3}, 'h': {5, 5, 7, 5, 5}, 'i': {7, 2, 2, 2, 7}, 'j': {1, 1, 1, 5, 2},
+	'k': {5, 5, 6, 5, 5}, 'l': {4, 4, 4, 4, 7}, 'm': {5, 7, 7, 5, 5}, 'n': {6, 5, 5, 5, 5}, 'o': {2, 5, 5, 5, 2},
+	'p': {6, 5, 6, 4, 4}, 'q': {2, 5, 5, 6, 3}, 'r': {6, 5, 6, 5, 5}, 's': {3, 4, 2, 1, 6}, 't': {7, 2, 2, 2, 2},
+	'u': {5, 5, 5, 5, 7}, 'v': {5, 5, 5, 5, 2}, 'w': {5, 5, 7, 7, 5}, 'x': {5, 5, 2, 5, 5}, 'y': {5, 5, 2, 2, 2},
+	'z': {7, 1, 2, 4, 7}, '_': {0, 0, 0, 0, 7}, '.': {0, 0, 0, 0, 2}, ',': {0, 0, 0, 2, 4}, ':': {0, 2, 0, 2, 0},
+	'-': {0, 0, 7, 0, 0}, '+': {0, 2, 7, 2, 0}, '/': {1, 1, 2, 4, 4}, '(': {1, 2, 2, 2, 1}, ')': {4, 2, 2, 2, 4},
+	'%': {5, 1, 2, 4, 5}, '$': {3, 6, 2, 3, 6},
+}
+
+// Draws text in the pixel font with its top left corner at x, y. Characters it doesn't have are left blank.
+func drawText(img *image.RGBA, x int, y int, text string, scale int) {
+	for _, r := range strings.ToLower(text) {
+		g := glyphs[r]
+		for row := 0; row < glyphHeight; row++ {
+			for col := 0; col < glyphWidth; col++ {
+				if g[row]&(1<<uint(glyphWidth-1-col)) == 0 {
+					continue
+				}
+				px, py := x+col*scale, y+row*scale
+				draw.Draw(img, image.Rect(px, py, px+scale, py+scale), &image.Uniform{chartTextColor}, image.Point{}, draw.Src)
+			}
+		}
+		x += (glyphWidth + 1) * scale
+	}
+}
@@ -0,0 +1,47 @@
+package gopartman
+
+import (
+	"errors"
+	"strconv"
+	"testing"
+)
+
+func TestChartLayoutHeight(t *testing.T) {
+	bars := func(n int) []ChartBar {
+		b := make([]ChartBar, n)
+		for i := range b {
+			b[i] = ChartBar{Label: "public.events_p" + strconv.Itoa(i), Value: float64(i)}
+		}
+		return b
+	}
+	tests := []struct {
+		name      string
+		chart     Chart
+		height    int
+		rowHeight int
+	}{
+		{"as tall as the bars need", Chart{Width: 800, Bars: bars(10)}, 10 + 32 + 10*24 + 10, 24},
+		{"no taller than the largest chart", Chart{Width: 800, Bars: bars(5000)}, maxChartSize, 1},
+		{"squeezed into the largest chart", Chart{Width: 800, Bars: bars(390)}, maxChartSize, 10},
+		{"given a height", Chart{Width: 800, Height: 500, Bars: bars(10)}, 500, 44},
+		{"no bars", Chart{Width: 800}, 10 + 32 + 10, 24},
+	}
+	for _, test := range tests {
+		l := test.chart.layout(8, 16)
+		if l.height != test.height || l.rowHeight != test.rowHeight {
+			t.Errorf("%s: layout() made a chart %d high with %d pixel rows, want %d high with %d pixel rows", test.name, l.height, l.rowHeight, test.height, test.rowHeight)
+		}
+		if l.height > maxChartSize {
+			t.Errorf("%s: layout() made a chart %d high, more than %d", test.name, l.height, maxChartSize)
+		}
+	}
+}
+
+func TestChartCheckBars(t *testing.T) {
+	if err := (Chart{Bars: make([]ChartBar, maxChartBars)}).checkBars(); err != nil {
+		t.Errorf("checkBars() with %d bars returned %v, want no error", maxChartBars, err)
+	}
+	if err := (Chart{Bars: make([]ChartBar, maxChartBars+1)}).checkBars(); !errors.Is(err, ErrInvalidChart) {
+		t.Errorf("checkBars() with %d bars returned %v, want ErrInvalidChart", maxChartBars+1, err)
+	}
+}
@@ -0,0 +1,74 @@
+/**
+ * This file contains what's known about each child table besides its name: its size on disk (and what that's made of), estimated
+ * rows, the range of values it holds, when it was last vacuumed and analyzed and whether it's still part of the partition set.
+ * It all comes from the catalog and Postgres' statistics in one query, so it's cheap however big the child tables are.
+ */
+
+package gopartman
+
+import (
+	"strconv"
+
+	"github.com/lib/pq"
+)
+
+// Fills in the details of child tables from the catalog. Records are estimated from pg_class.reltuples (as of the last ANALYZE,
+// VACUUM or CREATE INDEX), or the live tuples pg_stat_user_tables has seen when a child table hasn't been analyzed yet. Vacuums
+// and analyzes are whichever was last, manual or automatic.
+func (db DB) describeChildren(c []ChildInfo) error {
+	if len(c) == 0 {
+		return nil
+	}
+	tables := make([]string, len(c))
+	for i, child := range c {
+		tables[i] = child.Table
+	}
+	details := []ChildInfo{}
+	err := db.Select(&details, `SELECT t.c AS "table",
+			CASE WHEN cl.reltuples > 0 THEN cl.reltuples::bigint ELSE COALESCE(s.n_live_tup, 0) END AS records,
+			pg_total_relation_size(cl.oid) AS "bytesOnDisk",
+			pg_relation_size(cl.oid) AS "heapBytes",
+			pg_indexes_size(cl.oid) AS "indexBytes",
+			CASE WHEN cl.reltoastrelid = 0 THEN 0 ELSE pg_total_relation_size(cl.reltoastrelid) END AS "toastBytes",
+			GREATEST(s.last_vacuum, s.last_autovacuum) AS "lastVacuum",
+			GREATEST(s.last_analyze, s.last_autoanalyze) AS "lastAnalyze",
+			EXISTS (SELECT 1 FROM pg_inherits i WHERE i.inhrelid = cl.oid) AS inherited
+		FROM unnest($1::text[]) WITH ORDINALITY AS t(c, i) JOIN pg_class cl ON cl.oid = t.c::regclass
+		LEFT JOIN pg_stat_user_tables s ON s.relid = cl.oid
+		ORDER BY t.i`, pq.StringArray(tables))
+	if err != nil {
+		return &SQLError{Op: "describe child tables", Err: err}
+	}
+	for i := range c {
+		if i < len(details) {
+			details[i].Estimated, details[i].From, details[i].To = true, c[i].From, c[i].To
+			c[i] = details[i]
+		}
+	}
+	return nil
+}
+
+// Fills in the range of values each child table holds, worked out from its name the same way maintenance does it. List and hash
+// partitions (and child tables not named like maintenance names them, such as the default child table) have no range.
+func (db DB) addChildBounds(p *Partition, c []ChildInfo) error {
+	if p.Type == ListType || p.Type == HashType || len(c) == 0 {
+		return nil
+	}
+	bounds, err := db.childRanges(p)
+	if err != nil {
+		return err
+	}
+	for i, child := range c {
+		b, err := bounds(child.Table)
+		if err != nil {
+			continue
+		}
+		// Sub-partition levels don't have a type here, but only time ranges have a start time
+		if b.From.IsZero() {
+			c[i].From, c[i].To = strconv.FormatInt(b.FromId, 10), strconv.FormatInt(b.ToId, 10)
+		} else {
+			c[i].From, c[i].To = b.From.Format("2006-01-02 15:04:05"), b.To.Format("2006-01-02 15:04:05")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,686 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/fatih/color"
+	"github.com/lib/pq"
+	"github.com/olekukonko/tablewriter"
+	"github.com/spf13/cobra"
+	"github.com/tmaiaroto/gopartman"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Checks to see if the server and partition passed from the command line has actually been configured and returns it if so.
+func getFlaggedPartition() (*gopartman.DB, *gopartman.Partition, error) {
+	return mgr.GetPartition(flags.server, flags.partition)
+}
+
+// Gets just the database server connection passed from the command line
+func getFlaggedServer() (*gopartman.DB, error) {
+	return mgr.GetServer(flags.server)
+}
+
+// Displays the error (if any) and exits with a non-zero status so that scripts and cron wrappers can tell that a command failed.
+func exitOnError(err error) {
+	if err != nil {
+		l.Critical(err)
+		printDryRun()
+		os.Exit(1)
+	}
+}
+
+// With --dry-run, prints the statements that would have been run (as SQL which could be run by hand) and what pg_partman would have done.
+func printDryRun() {
+	if mgr == nil || mgr.DryRun == nil {
+		return
+	}
+	for _, s := range mgr.DryRun.Statements() {
+		query := s.Query
+		if !strings.HasSuffix(query, ";") {
+			query += ";"
+		}
+		fmt.Println(query)
+		if len(s.Args) > 0 {
+			args := make([]string, len(s.Args))
+			for i, arg := range s.Args {
+				args[i] = "$" + strconv.Itoa(i+1) + " = " + sqlLiteral(arg)
+			}
+			fmt.Println("-- " + strings.Join(args, ", "))
+		}
+	}
+	for _, preview := range mgr.DryRun.Previews() {
+		fmt.Println("-- " + preview)
+	}
+}
+
+// Shows an argument the way it would be written in SQL.
+func sqlLiteral(arg interface{}) string {
+	switch v := arg.(type) {
+	case nil:
+		return "NULL"
+	case string:
+		return pq.QuoteLiteral(v)
+	case []byte:
+		return pq.QuoteLiteral(string(v))
+	case time.Time:
+		return pq.QuoteLiteral(v.Format(time.RFC3339Nano))
+	}
+	return fmt.Sprint(arg)
+}
+
+var versionCmd = &cobra.Command{
+	Use:   "version",
+	Short: "Print the version number of gopartman",
+	Run: func(cmd *cobra.Command, args []string) {
+		fmt.Println(color.YellowString("gopartman v" + gopartman.Version))
+	},
+}
+
+// Installs the partman schema and its objects.
+var installPartmanCmd = &cobra.Command{
+	Use:   "install",
+	Short: "Installs pg_partman",
+	Long:  "\nInstalls pg_partman into a `partman` schema with its objects to manage partitions\n(Note: This is automatically installed, if not installed, when creating a partition).",
+	Run: func(cmd *cobra.Command, args []string) {
+		fServer, err := getFlaggedServer()
+		exitOnError(err)
+		if !fServer.SqlFunctionsExist() {
+			l.Info("Installing pg_partman on " + flags.server)
+			exitOnError(fServer.LoadPgPartman())
+		} else {
+			l.Info("pg_partman has already been installed on " + flags.server)
+		}
+	},
+}
+
+// Reinstalls the partman schema and its objects by first dropping the `partman` schema and then installing again.
+var reinstallPartmanCmd = &cobra.Command{
+	Use:   "reinstall",
+	Short: "Re-installs pg_partman",
+	Long:  "\nNote that re-installing pg_partman will drop the `partman` schema and all objects.\nSo any existing partitions on the database will cease to be managed.",
+	Run: func(cmd *cobra.Command, args []string) {
+		fServer, err := getFlaggedServer()
+		exitOnError(err)
+		l.Info("Re-installing pg_partman on " + flags.server)
+		exitOnError(fServer.UnloadPartman())
+		exitOnError(fServer.LoadPgPartman())
+	},
+}
+
+// Create a partition.
+var createParentCmd = &cobra.Command{
+	Use:   "create",
+	Short: "Creates a partition",
+	Long: "\n" + `Creates a partition for a given table based on the ` + "\x1b[33m\x1b[40m" + `gopartman.yml` + "\x1b[0m\x1b[0m" + ` configuration file.
+	
+	Example: ./gopartman create -c /some/other/gopartman.yml -p mypartition
+
+	That call would create a daily partition on a posts table with 4 days before and 4 days ahead of the current date. 
+	Of course, more tables would need to be created for the future. If gopartman is not running as a daemon, you will manually 
+	need to call additional maintenance commands (on crontab perhaps).
+
+	So one might then run: ./gopartman maintenance -c /some/other/gopartman.yml -p mypartition
+	`,
+	Run: func(cmd *cobra.Command, args []string) {
+		fServer, fPartition, err := getFlaggedPartition()
+		exitOnError(err)
+		if !fServer.SqlFunctionsExist() {
+			exitOnError(fServer.LoadPgPartman())
+		}
+
+		l.Info("Creating a partition on " + flags.server + " for table " + fPartition.Table + " (" + flags.partition + ")")
+		exitOnError(fServer.CreateParent(fPartition))
+	},
+}
+
+// Runs maintenance on partitions.
+var runMaintenanceCmd = &cobra.Command{
+	Use:   "maintenance",
+	Short: "Runs maintenance on partitions",
+	Long:  "\nRuns maintenance on all tables if no table name was given. Maintenance includes adding new partition tables and removing old ones if a retention policy was set.",
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(flags.partition) == 0 && len(flags.server) > 0 {
+			fServer, err := getFlaggedServer()
+			exitOnError(err)
+			l.Info("Running maintenance on " + flags.server + " for all tables")
+			exitOnError(fServer.RunMaintenance(&gopartman.Partition{Table: ""}))
+		} else {
+			fServer, fPartition, err := getFlaggedPartition()
+			exitOnError(err)
+			if !fServer.SqlFunctionsExist() {
+				exitOnError(gopartman.ErrNotInstalled)
+			}
+
+			l.Info("Running maintenance on " + flags.server + " for table " + fPartition.Table)
+			exitOnError(fServer.RunMaintenance(fPartition))
+		}
+	},
+}
+
+// Undo a partition.
+var undoPartitionCmd = &cobra.Command{
+	Use:   "undo",
+	Short: "Undo a partition",
+	Long:  "\nReverts a partition back to only using its parent table.",
+	Run: func(cmd *cobra.Command, args []string) {
+		fServer, fPartition, err := getFlaggedPartition()
+		exitOnError(err)
+		if !fServer.SqlFunctionsExist() {
+			exitOnError(fServer.LoadPgPartman())
+		}
+
+		l.Info("Reverting a partition on " + flags.server + " for table " + flags.partition)
+		rows, err := fServer.UndoPartition(fPartition)
+		exitOnError(err)
+		fmt.Println(strconv.FormatInt(rows, 10) + " rows moved from child partition tables to the parent table " + fPartition.Table)
+	},
+}
+
+// Get information about a partition for a given table.
+var getPartitionInfoCmd = &cobra.Command{
+	Use:   "info",
+	Short: "Info about a partition",
+	Long:  "\nDisplays information about a partition.",
+	Run: func(cmd *cobra.Command, args []string) {
+		fServer, fPartition, err := getFlaggedPartition()
+		exitOnError(err)
+
+		info, err := fServer.PartitionInfo(fPartition)
+		exitOnError(err)
+		table := tablewriter.NewWriter(os.Stdout)
+		table.SetHeader([]string{"Table", "Control Column", "Type", "Interval", "# of Tables to Premake"})
+		table.Append([]string{info.ParentTable, info.Control, info.Type, info.PartInterval, strconv.Itoa(info.Premake)})
+		table.Render()
+
+		if fPartition.SubPartition == nil {
+			return
+		}
+		subs, err := fServer.SubPartitionInfo(fPartition)
+		exitOnError(err)
+		table = tablewriter.NewWriter(os.Stdout)
+		table.SetHeader([]string{"Level", "Control Column", "Type", "Interval", "# of Tables to Premake", "Retention"})
+		for _, sub := range subs {
+			table.Append([]string{strconv.Itoa(sub.Depth + 1), sub.SubControl, sub.SubType, sub.SubPartInterval, strconv.Itoa(sub.SubPremake), sub.SubRetention})
+		}
+		table.Render()
+	},
+}
+
+// Get information about a partition's children.
+var getPartitionChildrenCmd = &cobra.Command{
+	Use:   "children",
+	Short: "Child table info for a partition",
+	Long:  "\nDisplays information about a partition's child tables." + "\n" + `The number of records is estimated from Postgres' statistics unless ` + "\x1b[33m\x1b[40m" + `--exact` + "\x1b[0m\x1b[0m" + ` is given.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		fServer, fPartition, err := getFlaggedPartition()
+		exitOnError(err)
+
+		children, err := fServer.GetChildPartitions(fPartition, map[string]interface{}{"exact": flags.exact, "workers": flags.workers, "statementTimeout": flags.timeout})
+		exitOnError(err)
+		table := tablewriter.NewWriter(os.Stdout)
+		table.SetHeader([]string{"Table", "From", "To", "# of Records", "Estimated", "Size (bytes)", "Heap", "Indexes", "TOAST", "Last Vacuum", "Last Analyze", "Inherited"})
+		appendChildren(table, children, "")
+		table.Render()
+	},
+}
+
+// Adds child tables to the table, indenting the children of sub-partitioned child tables below them.
+func appendChildren(table *tablewriter.Table, children []gopartman.ChildInfo, indent string) {
+	for _, child := range children {
+		table.Append([]string{indent + child.Table, child.From, child.To, strconv.Itoa(child.Records), yesNo(child.Estimated),
+			strconv.FormatUint(child.BytesOnDisk, 10), strconv.FormatUint(child.HeapBytes, 10), strconv.FormatUint(child.IndexBytes, 10),
+			strconv.FormatUint(child.ToastBytes, 10), formatLastTime(child.LastVacuum), formatLastTime(child.LastAnalyze), yesNo(child.Inherited)})
+		appendChildren(table, child.Children, indent+"  ")
+	}
+}
+
+func yesNo(b bool) string {
+	if b {
+		return "yes"
+	}
+	return "no"
+}
+
+// Formats when a child table was last vacuumed or analyzed.
+func formatLastTime(t *time.Time) string {
+	if t == nil {
+		return "never"
+	}
+	return t.Local().Format("2006-01-02 15:04:05")
+}
+
+// Shows number of records inserted into the parent tables instead of child partition tables.
+var checkParentCmd = &cobra.Command{
+	Use:   "check",
+	Short: "Number of records left in parent tables",
+	Long:  "\nDisplays number of records inserted into parent tables instead of child partition tables." + "\n" + `Records can be moved with the ` + "\x1b[33m\x1b[40m" + `fix` + "\x1b[0m\x1b[0m" + ` command if child partition tables exist.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		fServer, _, err := getFlaggedPartition()
+		exitOnError(err)
+
+		parents, err := fServer.CheckParent()
+		exitOnError(err)
+		table := tablewriter.NewWriter(os.Stdout)
+		table.SetHeader([]string{"Parent Table", "# of Records"})
+		for _, parent := range parents {
+			table.Append([]string{parent.Table, strconv.Itoa(parent.Records)})
+
+		}
+		table.Render()
+	},
+}
+
+// Set a retention period for a partition.
+var setPartitionRetentionCmd = &cobra.Command{
+	Use:   "set-retention",
+	Short: "Set a partition retention period",
+	Long:  "\nSets a retention period for a partition. Maintenance will now remove old child partition tables and the data within them.",
+	Run: func(cmd *cobra.Command, args []string) {
+		fServer, fPartition, err := getFlaggedPartition()
+		exitOnError(err)
+		if !fServer.SqlFunctionsExist() {
+			exitOnError(fServer.LoadPgPartman())
+		}
+
+		exitOnError(fServer.SetRetention(fPartition))
+	},
+}
+
+// Removes a retention period for a partition.
+var removePartitionRetentionCmd = &cobra.Command{
+	Use:   "remove-retention",
+	Short: "Remove a partition retention period",
+	Long:  "\nRemoves a retention period for a partition. Maintenance will create new partition tables, but no tables or data will be removed.",
+	Run: func(cmd *cobra.Command, args []string) {
+		fServer, fPartition, err := getFlaggedPartition()
+		exitOnError(err)
+		if !fServer.SqlFunctionsExist() {
+			exitOnError(fServer.LoadPgPartman())
+		}
+
+		exitOnError(fServer.RemoveRetention(fPartition))
+	},
+}
+
+// Cleans up a partition, moving any records from the parent table into child partition tables where possible.
+var fixPartitionCmd = &cobra.Command{
+	Use:   "fix",
+	Short: "Fix and clean up parent table",
+	Long:  "\nMoves data that accidentally gets inserted into the parent (or existing data before partitioning) into the proper child partition tables if available.",
+	Run: func(cmd *cobra.Command, args []string) {
+		fServer, fPartition, err := getFlaggedPartition()
+		exitOnError(err)
+		if !fServer.SqlFunctionsExist() {
+			exitOnError(fServer.LoadPgPartman())
+		}
+
+		rows, err := fServer.PartitionData(fPartition)
+		exitOnError(err)
+		fmt.Println(strconv.FormatInt(rows, 10) + " rows moved from the parent table " + fPartition.Table + " to child partition tables")
+	},
+}
+
+// Returns the configured partitions selected by the command line flags. One partition, every partition on a server, or every partition.
+func getFlaggedPartitions() ([]gopartman.PartitionRef, error) {
+	if flags.partition != "" {
+		if _, _, err := getFlaggedPartition(); err != nil {
+			return nil, err
+		}
+		return []gopartman.PartitionRef{{Server: flags.server, Partition: flags.partition}}, nil
+	}
+	if flags.server != "" {
+		if _, err := getFlaggedServer(); err != nil {
+			return nil, err
+		}
+	}
+
+	refs := []gopartman.PartitionRef{}
+	mgr.RLock()
+	for serverName, db := range mgr.Connections {
+		if flags.server != "" && serverName != flags.server {
+			continue
+		}
+		for partitionName := range db.Partitions {
+			refs = append(refs, gopartman.PartitionRef{Server: serverName, Partition: partitionName})
+		}
+	}
+	mgr.RUnlock()
+	sort.Slice(refs, func(i, j int) bool {
+		if refs[i].Server != refs[j].Server {
+			return refs[i].Server < refs[j].Server
+		}
+		return refs[i].Partition < refs[j].Partition
+	})
+	return refs, nil
+}
+
+// Adds a partition's plan to the table, one row for each setting that differs.
+func appendPlan(table *tablewriter.Table, ref gopartman.PartitionRef, plan gopartman.PartitionPlan) {
+	row := []string{ref.Server, ref.Partition, plan.Table}
+	switch {
+	case plan.Create:
+		table.Append(append(row, "", "", "", "create"))
+	case plan.InSync():
+		table.Append(append(row, "", "", "", "in sync"))
+	}
+	for _, d := range plan.Drift {
+		change := "in place"
+		if !d.Safe {
+			change = "needs migration"
+		}
+		table.Append(append(row, d.Setting, d.Configured, d.Current, change))
+	}
+}
+
+var planHeader = []string{"Server", "Partition", "Table", "Setting", "Configured", "Current", "Change"}
+
+// Shows how the database differs from the configuration.
+var planCmd = &cobra.Command{
+	Use:   "plan",
+	Short: "Compare the configuration with the database",
+	Long: "\nShows how each configured partition differs from its partition set in the database, without changing anything." + "\n" +
+		`Changes made "in place" are made by the ` + "\x1b[33m\x1b[40m" + `reconcile` + "\x1b[0m\x1b[0m" + ` command, those that need migration mean the partition set must be created again.` + "\n" +
+		"Checks every configured partition unless a server (and partition) is given.",
+	Run: func(cmd *cobra.Command, args []string) {
+		refs, err := getFlaggedPartitions()
+		exitOnError(err)
+
+		table := tablewriter.NewWriter(os.Stdout)
+		table.SetHeader(planHeader)
+		failed := false
+		for _, ref := range refs {
+			db, p, err := mgr.GetPartition(ref.Server, ref.Partition)
+			if err == nil {
+				var plan gopartman.PartitionPlan
+				if plan, err = db.Plan(p); err == nil {
+					appendPlan(table, ref, plan)
+					continue
+				}
+			}
+			l.Error(ref.Partition + " on " + ref.Server + ": " + err.Error())
+			failed = true
+		}
+		table.Render()
+		if failed {
+			printDryRun()
+			os.Exit(1)
+		}
+	},
+}
+
+// Brings the database in line with the configuration.
+var reconcileCmd = &cobra.Command{
+	Use:   "reconcile",
+	Short: "Apply safe configuration changes to the database",
+	Long: "\nCreates configured partitions which don't exist and changes settings which can be changed in place (premake, retention and so on)." + "\n" +
+		"Changes to the column, type, interval or sub-partitioning of a partition set are shown, but not made.",
+	Run: func(cmd *cobra.Command, args []string) {
+		refs, err := getFlaggedPartitions()
+		exitOnError(err)
+
+		table := tablewriter.NewWriter(os.Stdout)
+		table.SetHeader(planHeader)
+		failed := false
+		for _, ref := range refs {
+			db, p, err := mgr.GetPartition(ref.Server, ref.Partition)
+			if err != nil {
+				l.Error(err)
+				failed = true
+				continue
+			}
+			plan, err := db.Reconcile(p)
+			appendPlan(table, ref, plan)
+			if err != nil {
+				l.Error(ref.Partition + " on " + ref.Server + ": " + err.Error())
+				failed = true
+			}
+		}
+		table.Render()
+		if failed {
+			printDryRun()
+			os.Exit(1)
+		}
+	},
+}
+
+// Changes the column, type or interval of a partition set to what's configured.
+var repartitionCmd = &cobra.Command{
+	Use:   "repartition",
+	Short: "Change the interval, type or column of a partition",
+	Long: "\nChanges an existing partition set to the column, type and interval in the configuration without undoing it first." + "\n" +
+		"A new partition set is created on the parent table and rows are moved from the old child tables in batches, newest first." + "\n" +
+		"Rows which haven't been moved yet can't be seen through the parent table. If it's interrupted, run it again to carry on.",
+	Run: func(cmd *cobra.Command, args []string) {
+		fServer, fPartition, err := getFlaggedPartition()
+		exitOnError(err)
+		if !fServer.SqlFunctionsExist() {
+			exitOnError(gopartman.ErrNotInstalled)
+		}
+
+		if flags.status {
+			rp, err := fServer.RepartitionStatus(fPartition.Table)
+			exitOnError(err)
+			printRepartitionProgress(rp)
+			return
+		}
+		l.Info("Re-partitioning " + fPartition.Table + " on " + flags.server + " by " + fPartition.Interval + " on " + fPartition.Column)
+		rp, err := fServer.Repartition(fPartition, printRepartitionProgress, map[string]interface{}{"batchSize": flags.batchSize, "lockWait": flags.lockWait})
+		exitOnError(err)
+		if rp.Done {
+			fmt.Println(fPartition.Table + " has been re-partitioned, " + strconv.FormatInt(rp.Moved, 10) + " rows moved")
+		}
+	},
+}
+
+func printRepartitionProgress(rp gopartman.RepartitionProgress) {
+	fmt.Println(strconv.FormatInt(rp.Moved, 10) + " rows moved to the new child tables of " + rp.Table + ", " + strconv.Itoa(len(rp.Remaining)) + " old child tables left")
+}
+
+// Shows which child tables maintenance will remove under the retention period, and when.
+var retentionReportCmd = &cobra.Command{
+	Use:   "retention-report",
+	Short: "Show which child tables retention will remove",
+	Long: "\nShows the child tables which are past their partition's retention period (maintenance will remove them the next time it runs)" + "\n" +
+		"and those which will be within --days, with their record counts and sizes. Checks every configured partition with a retention" + "\n" +
+		"period unless a server (and partition) is given.",
+	Run: func(cmd *cobra.Command, args []string) {
+		refs, err := getFlaggedPartitions()
+		exitOnError(err)
+
+		table := tablewriter.NewWriter(os.Stdout)
+		table.SetHeader([]string{"Server", "Partition", "Child Table", "From", "To", "# of Records", "Size (bytes)", "Expires", "Retention"})
+		failed := false
+		for _, ref := range refs {
+			db, p, err := mgr.GetPartition(ref.Server, ref.Partition)
+			if err == nil {
+				var report gopartman.RetentionReport
+				if report, err = db.RetentionReport(p, flags.days); err == nil {
+					appendRetentionReport(table, ref, report)
+					continue
+				}
+			}
+			// Only complain about partitions without a retention period when one was asked for
+			if errors.Is(err, gopartman.ErrNoRetention) && flags.partition == "" {
+				l.Info(ref.Partition + " on " + ref.Server + ": " + err.Error())
+				continue
+			}
+			l.Error(ref.Partition + " on " + ref.Server + ": " + err.Error())
+			failed = true
+		}
+		table.Render()
+		if failed {
+			os.Exit(1)
+		}
+	},
+}
+
+// Adds the expired and expiring child tables of a partition to the table.
+func appendRetentionReport(table *tablewriter.Table, ref gopartman.PartitionRef, report gopartman.RetentionReport) {
+	add := func(children []gopartman.RetentionChild, status string) {
+		for _, child := range children {
+			expires := ""
+			switch {
+			case child.Expires != nil:
+				expires = child.Expires.Format("2006-01-02 15:04:05")
+			case child.ExpiresAtId != nil:
+				expires = "id " + strconv.FormatInt(*child.ExpiresAtId, 10)
+			}
+			table.Append([]string{ref.Server, ref.Partition, child.Table, child.From, child.To, strconv.Itoa(child.Records),
+				strconv.FormatUint(child.BytesOnDisk, 10), expires, status + " (" + report.Action + ")"})
+		}
+	}
+	add(report.Expired, "expired")
+	add(report.Expiring, "expiring")
+}
+
+// Re-creates a child table from an archive made before retention removed it.
+var restoreArchiveCmd = &cobra.Command{
+	Use:   "restore-archive <manifest>",
+	Short: "Restore an archived child table",
+	Long: "\nCreates an archived child table again from its manifest (the .json file beside the archive), loads its records and" + "\n" +
+		"attaches it to its parent table. The archive's checksum and record count are checked first. Maintenance will remove it" + "\n" +
+		"again if it's still past the retention period, so extend or remove the retention period first to keep it.",
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) != 1 {
+			exitOnError(errors.New("the path of an archive manifest is required"))
+		}
+		fServer, fPartition, err := getFlaggedPartition()
+		exitOnError(err)
+
+		m, err := fServer.RestoreArchive(fPartition, args[0])
+		exitOnError(err)
+		if !flags.dryRun {
+			fmt.Println(m.Table + " has been restored to " + m.Parent + ", " + strconv.FormatInt(m.Rows, 10) + " records loaded")
+		}
+	},
+}
+
+// Checks that partitions have enough child tables made ahead of the current time (or id).
+var healthCmd = &cobra.Command{
+	Use:   "health",
+	Short: "Check partitions aren't running out of premade child tables",
+	Long: "\nCompares the end of each partition's newest child table with the current time (or its highest id) to show how many child" + "\n" +
+		"tables' worth of room is left before new rows have nowhere to go. It's a warning below premakeWarning (half of premake if not set)" + "\n" +
+		"and critical below premakeCritical (1 if not set). Exits with 0 when everything is ok, 1 for a warning, 2 when critical and 3 if" + "\n" +
+		"a partition couldn't be checked. Checks every configured partition unless a server (and partition) is given.",
+	Run: func(cmd *cobra.Command, args []string) {
+		refs, err := getFlaggedPartitions()
+		exitOnError(err)
+
+		table := tablewriter.NewWriter(os.Stdout)
+		table.SetHeader([]string{"Server", "Partition", "Status", "Newest Child Table", "Until", "Current", "Runway", "Premade", "Message"})
+		exitCode := 0
+		for _, ref := range refs {
+			db, p, err := mgr.GetPartition(ref.Server, ref.Partition)
+			if err == nil {
+				var h gopartman.PartitionHealth
+				if h, err = db.CheckHealth(p); err == nil {
+					table.Append([]string{ref.Server, ref.Partition, h.Status, h.NewestChild, h.Until, h.Current,
+						strconv.FormatFloat(h.Runway, 'f', -1, 64), strconv.Itoa(h.Premade), h.Message})
+					if level := gopartman.HealthLevel(h.Status); level > exitCode {
+						exitCode = level
+					}
+					continue
+				}
+			}
+			// List and hash partitions don't run out, so they're only complained about when asked for
+			if errors.Is(err, gopartman.ErrNotSupported) && flags.partition == "" {
+				continue
+			}
+			l.Error(ref.Partition + " on " + ref.Server + ": " + err.Error())
+			exitCode = 3
+		}
+		table.Render()
+		os.Exit(exitCode)
+	},
+}
+
+// Shows the history of child table sizes (see the stats section of the configuration).
+var statsCmd = &cobra.Command{
+	Use:   "stats",
+	Short: "Show how partitions have grown",
+	Long: "\nShows each partition's rows and size for each of the last --days days (from the snapshots the daemon takes when stats.interval" + "\n" +
+		"is configured) and how much they grew each day. With --largest, shows the largest child tables instead, with how much they grew over" + "\n" +
+		"--days. --snapshot takes a snapshot first. Checks every configured partition unless a server (and partition) is given.",
+	Run: func(cmd *cobra.Command, args []string) {
+		refs, err := getFlaggedPartitions()
+		exitOnError(err)
+
+		failed := false
+		if flags.snapshot {
+			mgr.RLock()
+			keep := mgr.Config.Stats.Keep
+			mgr.RUnlock()
+			for _, ref := range refs {
+				db, p, err := mgr.GetPartition(ref.Server, ref.Partition)
+				if err == nil {
+					err = db.SnapshotStats(p, keep)
+				}
+				if err != nil {
+					l.Error(ref.Partition + " on " + ref.Server + ": " + err.Error())
+					failed = true
+				}
+			}
+		}
+
+		table := tablewriter.NewWriter(os.Stdout)
+		if flags.largest > 0 {
+			type child struct {
+				ref    gopartman.PartitionRef
+				growth gopartman.ChildGrowth
+			}
+			children := []child{}
+			for _, ref := range refs {
+				db, p, err := mgr.GetPartition(ref.Server, ref.Partition)
+				if err == nil {
+					var growth []gopartman.ChildGrowth
+					if growth, err = db.ChildGrowth(p, flags.days); err == nil {
+						for _, g := range growth {
+							children = append(children, child{ref, g})
+						}
+						continue
+					}
+				}
+				l.Error(ref.Partition + " on " + ref.Server + ": " + err.Error())
+				failed = true
+			}
+			sort.SliceStable(children, func(i, j int) bool { return children[i].growth.Bytes > children[j].growth.Bytes })
+			if len(children) > flags.largest {
+				children = children[:flags.largest]
+			}
+			table.SetHeader([]string{"Server", "Partition", "Child Table", "# of Records", "Growth", "Size (bytes)", "Growth (bytes)", "Dead Tuples", "As Of"})
+			for _, c := range children {
+				g := c.growth
+				table.Append([]string{c.ref.Server, c.ref.Partition, g.Table, strconv.FormatInt(g.Rows, 10), strconv.FormatInt(g.RowsGrowth, 10),
+					strconv.FormatInt(g.Bytes, 10), strconv.FormatInt(g.BytesGrowth, 10), strconv.FormatInt(g.DeadTuples, 10), g.Taken.Format("2006-01-02 15:04")})
+			}
+		} else {
+			table.SetHeader([]string{"Server", "Partition", "Day", "# of Records", "Growth", "Size (bytes)", "Growth (bytes)", "Index Size (bytes)", "Dead Tuples"})
+			for _, ref := range refs {
+				db, p, err := mgr.GetPartition(ref.Server, ref.Partition)
+				if err == nil {
+					var days []gopartman.StatsDay
+					if days, err = db.DailyStats(p, flags.days); err == nil {
+						for _, d := range days {
+							table.Append([]string{ref.Server, ref.Partition, d.Day.Format("2006-01-02"), strconv.FormatInt(d.Rows, 10), strconv.FormatInt(d.RowsGrowth, 10),
+								strconv.FormatInt(d.Bytes, 10), strconv.FormatInt(d.BytesGrowth, 10), strconv.FormatInt(d.IndexBytes, 10), strconv.FormatInt(d.DeadTuples, 10)})
+						}
+						continue
+					}
+				}
+				l.Error(ref.Partition + " on " + ref.Server + ": " + err.Error())
+				failed = true
+			}
+		}
+		table.Render()
+		if failed {
+			printDryRun()
+			os.Exit(1)
+		}
+	},
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// How long API requests in progress get to finish when shutting down.
+const apiShutdownTimeout = 30 * time.Second
+
+// Blocks until SIGINT or SIGTERM is received and then shuts the daemon down gracefully: the API (if srv isn't nil) stops
+// taking requests, no more maintenance is started, maintenance already running is waited for and the connections are closed.
+// A second signal while waiting exits right away.
+func runUntilStopped(srv *http.Server) {
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
+	s := <-sig
+	l.Info("Received " + s.String() + ", shutting down (send it again to exit right away)")
+
+	go func() {
+		<-sig
+		l.Critical("Exiting without waiting for maintenance to finish")
+		os.Exit(1)
+	}()
+
+	if srv != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), apiShutdownTimeout)
+		defer cancel()
+		if err := srv.Shutdown(ctx); err != nil {
+			l.Error(err)
+		}
+	}
+	stopSchedule()
+	mgr.Close()
+	l.Info("gopartman stopped")
+}
@@ -0,0 +1,325 @@
+// gopartman will manage Postgres partitions. It is a command line interface and daemon built on the gopartman package.
+//
+// - Partitions to be managed are defined in gopartman.yml
+// - Maintenance is regularly performed so there's no need to set any commands to run in a crontab or anything like that
+// - An API can optionally be configured to allow:
+// 		- CORS and Basic Auth settings for access to the API (configured in gopartman.yml)
+// 		- Changes to configuration
+// 		- Addition of new partitions
+// 		- Reporting with information about partition settings and state
+
+package main
+
+import (
+	"github.com/ant0ine/go-json-rest/rest"
+	"github.com/spf13/cobra"
+	"github.com/tmaiaroto/gopartman"
+	"log"
+	"net/http"
+	"os"
+	"reflect"
+	"runtime"
+	"strconv"
+	"time"
+)
+
+var GoPartManCmd = &cobra.Command{
+	Use:   "gopartman",
+	Short: "A Postgres Partition Manager",
+	//Long: ``,
+	Run: func(cmd *cobra.Command, args []string) {
+		// Do Stuff Here
+	},
+}
+
+type GoPartManFlags struct {
+	verbose    bool
+	daemon     bool
+	server     string
+	partition  string
+	configFile string
+	watch      time.Duration
+	reconcile  bool
+	batchSize  int
+	lockWait   int
+	status     bool
+	dryRun     bool
+	days       int
+	snapshot   bool
+	largest    int
+	exact      bool
+	workers    int
+	timeout    int
+}
+
+var flags = GoPartManFlags{}
+
+// The manager holds the configuration and connections. Connection information, what to partition, and when.
+var mgr *gopartman.Manager
+
+// Global logging; l.Info(), l.Error() etc. (some functions always display output while others only if `verbose` was flagged)
+var l gopartman.Logger = gopartman.StdLogger{}
+
+// Loads the configuration (once flags have been parsed) and connects to the configured servers.
+func initManager() {
+	l = gopartman.StdLogger{Verbose: flags.verbose}
+
+	// Load the configured partitions
+	cfgPath := "/etc/gopartman.yml"
+	if _, err := os.Stat(cfgPath); err != nil {
+		cfgPath = "./gopartman.yml"
+	}
+	// If a specific path was given
+	if flags.configFile != "" {
+		cfgPath = flags.configFile
+	}
+	cfgFile, cfg, err := gopartman.OpenConfigFile(cfgPath)
+	if err != nil {
+		l.Critical("Configuration could not be loaded.")
+		panic(err)
+	}
+
+	// Set up all of the connections from the configuration and ensure they have the pg_partman schema, table, and functions loaded.
+	// Then create the partitions based on the config.
+	mgr = gopartman.NewManager(cfg, l)
+	mgr.ConfigFile = cfgFile
+	if flags.dryRun {
+		mgr.DryRun = &gopartman.DryRun{}
+	}
+	if err := mgr.Connect(); err != nil {
+		l.Error(err)
+	}
+}
+
+// --------- API Basic Auth Middleware (valid keys are defined in the gopartman.yml config, there are no roles or anything like that)
+type BasicAuthMw struct {
+	Realm string
+	Key   string
+}
+
+func (bamw *BasicAuthMw) MiddlewareFunc(handler rest.HandlerFunc) rest.HandlerFunc {
+	return func(writer rest.ResponseWriter, request *rest.Request) {
+
+		authHeader := request.Header.Get("Authorization")
+		log.Println(authHeader)
+		if authHeader == "" {
+			queryParams := request.URL.Query()
+			if len(queryParams["apiKey"]) > 0 {
+				bamw.Key = queryParams["apiKey"][0]
+			} else {
+				bamw.unauthorized(writer)
+				return
+			}
+		} else {
+			bamw.Key = authHeader
+		}
+
+		if !apiKeyAllowed(bamw.Key) {
+			bamw.unauthorized(writer)
+			return
+		}
+
+		handler(writer, request)
+	}
+}
+
+// Checks whether a key is one of the configured API keys.
+func apiKeyAllowed(k string) bool {
+	mgr.RLock()
+	defer mgr.RUnlock()
+	for _, key := range mgr.Config.Api.AuthKeys {
+		if k == key {
+			return true
+		}
+	}
+	return false
+}
+
+// Response to handle an unauthorized, unauthenticated request
+func (bamw *BasicAuthMw) unauthorized(writer rest.ResponseWriter) {
+	writer.Header().Set("WWW-Authenticate", "Basic realm="+bamw.Realm)
+	rest.Error(writer, "Not Authorized", http.StatusUnauthorized)
+}
+
+// Helper function to get the name of a function (primarily used to show scheduled tasks)
+func getFunctionName(i interface{}) string {
+	return runtime.FuncForPC(reflect.ValueOf(i).Pointer()).Name()
+}
+
+func main() {
+	GoPartManCmd.PersistentFlags().BoolVarP(&flags.daemon, "daemon", "m", false, "daemon mode")
+	GoPartManCmd.PersistentFlags().StringVarP(&flags.configFile, "config", "c", "", "An optional path to the YML configuration file")
+	GoPartManCmd.PersistentFlags().StringVarP(&flags.server, "server", "s", "", "The configured server")
+	GoPartManCmd.PersistentFlags().StringVarP(&flags.partition, "partition", "p", "", "The configured partition")
+	GoPartManCmd.PersistentFlags().BoolVarP(&flags.verbose, "verbose", "v", false, "verbose output")
+	GoPartManCmd.PersistentFlags().BoolVar(&flags.reconcile, "reconcile", false, "Apply safe configuration changes to the database before each scheduled maintenance run in daemon mode")
+	GoPartManCmd.PersistentFlags().BoolVar(&flags.dryRun, "dry-run", false, "Print the SQL that would be run (and what pg_partman would do) without changing anything")
+	GoPartManCmd.PersistentFlags().DurationVarP(&flags.watch, "watch", "w", 10*time.Second, "How often to check the configuration file for changes in daemon mode (0 to only reload on SIGHUP)")
+
+	// Load the configuration and connect once the flags above have been parsed
+	cobra.OnInitialize(initManager)
+
+	GoPartManCmd.AddCommand(versionCmd)
+	GoPartManCmd.AddCommand(installPartmanCmd)
+	GoPartManCmd.AddCommand(reinstallPartmanCmd)
+	GoPartManCmd.AddCommand(createParentCmd)
+	GoPartManCmd.AddCommand(runMaintenanceCmd)
+	GoPartManCmd.AddCommand(undoPartitionCmd)
+	GoPartManCmd.AddCommand(getPartitionInfoCmd)
+	getPartitionChildrenCmd.Flags().BoolVar(&flags.exact, "exact", false, "Count the records in each child table instead of using Postgres' estimates")
+	getPartitionChildrenCmd.Flags().IntVar(&flags.workers, "workers", 4, "Child tables counted at a time with --exact")
+	getPartitionChildrenCmd.Flags().IntVar(&flags.timeout, "timeout", 60, "Seconds to count a child table for with --exact before using the estimate (0 waits forever)")
+	GoPartManCmd.AddCommand(getPartitionChildrenCmd)
+	GoPartManCmd.AddCommand(setPartitionRetentionCmd)
+	GoPartManCmd.AddCommand(checkParentCmd)
+	GoPartManCmd.AddCommand(removePartitionRetentionCmd)
+	GoPartManCmd.AddCommand(fixPartitionCmd)
+	GoPartManCmd.AddCommand(planCmd)
+	GoPartManCmd.AddCommand(reconcileCmd)
+	repartitionCmd.Flags().IntVar(&flags.batchSize, "batch-size", 10000, "Rows moved in each transaction")
+	repartitionCmd.Flags().IntVar(&flags.lockWait, "lock-wait", 0, "Seconds to wait for locks before giving up (0 waits forever)")
+	repartitionCmd.Flags().BoolVar(&flags.status, "status", false, "Show the progress of a repartition instead of running it")
+	GoPartManCmd.AddCommand(repartitionCmd)
+	retentionReportCmd.Flags().IntVar(&flags.days, "days", 7, "Also show child tables which will be past the retention period within this many days")
+	GoPartManCmd.AddCommand(retentionReportCmd)
+	GoPartManCmd.AddCommand(restoreArchiveCmd)
+	GoPartManCmd.AddCommand(healthCmd)
+	statsCmd.Flags().IntVar(&flags.days, "days", 7, "How many days of history to show")
+	statsCmd.Flags().BoolVar(&flags.snapshot, "snapshot", false, "Take a snapshot of the child tables first")
+	statsCmd.Flags().IntVar(&flags.largest, "largest", 0, "Show this many of the largest child tables instead of each day's totals")
+	GoPartManCmd.AddCommand(statsCmd)
+
+	GoPartManCmd.Execute()
+
+	// Nothing was initialized (ie. help was requested)
+	if mgr == nil {
+		return
+	}
+
+	// A dry run only shows what would be done, the daemon isn't started
+	if flags.dryRun {
+		printDryRun()
+		return
+	}
+
+	// Notify, but keep running because it is possible that partitions will be added later via the API.
+	if len(mgr.Connections) == 0 {
+		l.Info("No configured partitions.")
+	}
+
+	// Then schedule maintenance for the partitions and optionally start API server if running forever
+	if flags.daemon {
+		// Create a schedule for jobs
+		newSchedule()
+
+		mgr.RLock()
+		names := map[string][]string{}
+		for conn, db := range mgr.Connections {
+			for pName := range db.Partitions {
+				names[conn] = append(names[conn], pName)
+			}
+		}
+		mgr.RUnlock()
+		for conn, pNames := range names {
+			for _, pName := range pNames {
+				if err := schedulePartition(conn, pName); err != nil {
+					l.Error(err)
+				}
+			}
+		}
+
+		// Keep a history of child table sizes, if configured
+		if err := scheduleStats(); err != nil {
+			l.Error(err)
+		}
+
+		// Pick up changes to the configuration file without restarting
+		go watchConfig(flags.watch)
+
+		var srv *http.Server
+		p := strconv.Itoa(mgr.Config.Api.Port)
+		// But if it can't be parsed (maybe wasn't set) then just run the daemon without the API server.
+		// This means partitions will be managed, but nothing can be changed unless the configuration file is changed (or the daemon is restarted).
+		if p != "0" {
+			restMiddleware := []rest.Middleware{}
+
+			// If additional origins were allowed for CORS, handle them
+			if len(mgr.Config.Api.Cors.AllowedOrigins) > 0 {
+				restMiddleware = append(restMiddleware,
+					&rest.CorsMiddleware{
+						RejectNonCorsRequests: false,
+						OriginValidator: func(origin string, request *rest.Request) bool {
+							mgr.RLock()
+							defer mgr.RUnlock()
+							for _, allowedOrigin := range mgr.Config.Api.Cors.AllowedOrigins {
+								// If the request origin matches one of the allowed origins, return true
+								if origin == allowedOrigin {
+									return true
+								}
+							}
+							return false
+						},
+						AllowedMethods: []string{"GET", "POST", "PUT", "DELETE"},
+						AllowedHeaders: []string{
+							"Accept", "Content-Type", "X-Custom-Header", "Origin"},
+						AccessControlAllowCredentials: true,
+						AccessControlMaxAge:           3600,
+					},
+				)
+			}
+			// If api keys are defined, setup basic auth (any key listed allows full access, there are no roles for now, this is just very basic auth)
+			if len(mgr.Config.Api.AuthKeys) > 0 {
+				restMiddleware = append(restMiddleware,
+					&BasicAuthMw{
+						Realm: "gopartman API",
+						Key:   "",
+					},
+				)
+			}
+
+			handler := rest.ResourceHandler{
+				EnableRelaxedContentType: true,
+				PreRoutingMiddlewares:    restMiddleware,
+			}
+			err := handler.SetRoutes(
+				&rest.Route{"GET", "/partitions", showPartitions},
+				&rest.Route{"GET", "/schedule", showSchedule},
+				&rest.Route{"GET", "/partition/:server/:partition", showPartition},
+				&rest.Route{"GET", "/partition/:server/:partition/config", showPartitionConfig},
+				&rest.Route{"POST", "/partition/:server/:partition/fix", fixPartition},
+				&rest.Route{"GET", "/partition/:server/:partition/retention", showRetentionReport},
+				&rest.Route{"GET", "/partition/:server/:partition/health", showPartitionHealth},
+				&rest.Route{"GET", "/health", showHealth},
+				&rest.Route{"GET", "/partition/:server/:partition/chart.svg", showChartSVG},
+				&rest.Route{"GET", "/partition/:server/:partition/chart.png", showChartPNG},
+				&rest.Route{"GET", "/partition/:server/:partition/stats", showStats},
+				&rest.Route{"GET", "/stats/largest", showLargestChildren},
+				&rest.Route{"POST", "/partitions/add", addPartition},
+				&rest.Route{"GET", "/partitions/read/:server/:partition", showPartition},
+				&rest.Route{"PUT", "/partitions/update/:server/:partition", updatePartition},
+				&rest.Route{"DELETE", "/partitions/delete/:server/:partition", deletePartition},
+			)
+			if err != nil {
+				log.Fatal(err)
+			}
+
+			// Prometheus metrics are plain text, so they're served beside the API rather than by it
+			mux := http.NewServeMux()
+			mux.HandleFunc("/metrics", serveMetrics)
+			mux.Handle("/", &handler)
+			srv = &http.Server{Addr: ":" + p, Handler: mux}
+			go func() {
+				log.Println("gopartman API listening on port " + p)
+				if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+					log.Fatal(err)
+				}
+			}()
+		} else {
+			log.Println("gopartman running without API")
+		}
+
+		// Run until told to stop
+		runUntilStopped(srv)
+	}
+
+}
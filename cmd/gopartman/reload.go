@@ -0,0 +1,61 @@
+package main
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// Reloads the configuration on SIGHUP and, if interval isn't 0, whenever the configuration file changes (checked every interval).
+func watchConfig(interval time.Duration) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+
+	// A nil channel never receives, so without an interval only SIGHUP reloads
+	var tick <-chan time.Time
+	if interval > 0 {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	for {
+		select {
+		case <-hup:
+			l.Info("Received SIGHUP, reloading the configuration")
+			reloadConfig()
+		case <-tick:
+			mgr.RLock()
+			f := mgr.ConfigFile
+			mgr.RUnlock()
+			changed, err := f.Changed()
+			if err != nil {
+				l.Error(err)
+				continue
+			}
+			if changed {
+				l.Info("The configuration file changed, reloading it")
+				reloadConfig()
+			}
+		}
+	}
+}
+
+// Reloads the configuration file and schedules (or unschedules) maintenance for the partitions that changed.
+func reloadConfig() {
+	changes, err := mgr.ReloadConfigFile()
+	if err != nil {
+		l.Error(err)
+	}
+	for _, ref := range changes.Removed {
+		l.Info("No longer managing " + ref.Partition + " on " + ref.Server)
+		unschedulePartition(ref.Server, ref.Partition)
+	}
+	for _, ref := range append(changes.Added, changes.Updated...) {
+		l.Info("Scheduling maintenance for " + ref.Partition + " on " + ref.Server)
+		if err := schedulePartition(ref.Server, ref.Partition); err != nil {
+			l.Error(err)
+		}
+	}
+}
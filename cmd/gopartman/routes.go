@@ -0,0 +1,790 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"github.com/ant0ine/go-json-rest/rest"
+	"github.com/tmaiaroto/gopartman"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// API: Shows the partitions managed by this server
+func showPartitions(w rest.ResponseWriter, r *rest.Request) {
+	res := NewHypermediaResource()
+	res.AddCurie("partitions", "/docs/rels/{rel}", true)
+
+	res.Links["self"] = HypermediaLink{
+		Href: "/partitions",
+	}
+	res.Links["partitions:add"] = HypermediaLink{
+		Href: "/partitions/add",
+	}
+	res.Links["partitions:delete"] = HypermediaLink{
+		Href:      "/partitions/delete/{server}/{partition}",
+		Templated: true,
+	}
+	res.Links["partitions:read"] = HypermediaLink{
+		Href:      "/partitions/read/{server}/{partition}",
+		Templated: true,
+	}
+	res.Links["partitions:update"] = HypermediaLink{
+		Href:      "/partitions/update/{server}/{partition}",
+		Templated: true,
+	}
+
+	type partitionInfo struct {
+		Name      string              `json:"name"`
+		Partition gopartman.Partition `json:"partition"`
+		Host      string              `json:"host"`
+		Database  string              `json:"database"`
+		Port      string              `json:"port"`
+	}
+
+	partitions := []partitionInfo{}
+	mgr.RLock()
+	for _, s := range mgr.Config.Servers {
+		for k, v := range s.Partitions {
+			partitions = append(partitions, partitionInfo{
+				Name:      k,
+				Partition: v,
+				Host:      s.Host,
+				Database:  s.Database,
+				Port:      s.Port,
+			})
+		}
+	}
+	mgr.RUnlock()
+	res.Data["totalPartitions"] = len(partitions)
+	res.Data["partitions"] = partitions
+
+	res.Success()
+	w.WriteJson(res.End("There are " + strconv.Itoa(len(partitions)) + " partitions managed."))
+}
+
+// API: Shows the maintenance schedule as currently configured
+func showSchedule(w rest.ResponseWriter, r *rest.Request) {
+	res := NewHypermediaResource()
+	res.AddCurie("schedule", "/docs/rels/{rel}", true)
+
+	res.Links["self"] = HypermediaLink{
+		Href: "/schedule",
+	}
+	res.Links["schedule:add"] = HypermediaLink{
+		Href: "/schedule/add",
+	}
+	res.Links["schedule:delete"] = HypermediaLink{
+		Href:      "/schedule/delete/{id}",
+		Templated: true,
+	}
+
+	jobs := []map[string]interface{}{}
+	for _, item := range c.Entries() {
+		// Skip jobs for partitions which have since been removed or rescheduled
+		if !isScheduled(item.Id) {
+			continue
+		}
+		m := make(map[string]interface{})
+		m["id"] = item.Id
+		m["name"] = item.Name
+		m["next"] = item.Next
+		m["prev"] = item.Prev
+		m["job"] = getFunctionName(item.Job)
+		jobs = append(jobs, m)
+	}
+	res.Data["totalJobs"] = len(jobs)
+	res.Data["jobs"] = jobs
+
+	res.Success()
+	w.WriteJson(res.End("There are " + strconv.Itoa(len(jobs)) + " jobs scheduled."))
+}
+
+// API: Shows detailed information about a specific partition
+func showPartition(w rest.ResponseWriter, r *rest.Request) {
+	res := NewHypermediaResource()
+
+	res.Links["self"] = HypermediaLink{
+		Href:      "/partition/{server}/{partition}{?exact,workers,timeout}",
+		Templated: true,
+	}
+
+	partitionName := r.PathParam("partition")
+	serverName := r.PathParam("server")
+
+	// Record counts are estimates unless ?exact=true, then each child table is counted for up to 60 seconds (or ?timeout)
+	queryParams := r.URL.Query()
+	opts := map[string]interface{}{"exact": queryParams.Get("exact") == "true", "statementTimeout": 60}
+	for param, opt := range map[string]string{"workers": "workers", "timeout": "statementTimeout"} {
+		if v := queryParams.Get(param); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				writeError(w, res, http.StatusBadRequest, errors.New(param+" must be a whole number"))
+				return
+			}
+			opts[opt] = n
+		}
+	}
+
+	db, partition, err := mgr.GetPartition(serverName, partitionName)
+	if err != nil {
+		l.Error(err)
+		w.WriteJson(res.End("The partition was not found."))
+		return
+	}
+	children, err := db.GetChildPartitions(partition, opts)
+	if err != nil {
+		l.Error(err)
+		w.WriteJson(res.End(err.Error()))
+		return
+	}
+	config, err := db.PartitionInfo(partition)
+	if err != nil {
+		l.Error(err)
+		w.WriteJson(res.End(err.Error()))
+		return
+	}
+	res.Data["totalChildren"] = len(children)
+	res.Data["children"] = children
+	res.Data["config"] = config
+	if partition.SubPartition != nil {
+		subs, err := db.SubPartitionInfo(partition)
+		if err != nil {
+			l.Error(err)
+			w.WriteJson(res.End(err.Error()))
+			return
+		}
+		res.Data["subPartitions"] = subs
+	}
+	res.Success()
+	w.WriteJson(res.End("There are " + strconv.Itoa(len(children)) + " children for this partition."))
+}
+
+// API: Shows just the configuration for a specific partition
+func showPartitionConfig(w rest.ResponseWriter, r *rest.Request) {
+	res := NewHypermediaResource()
+
+	res.Links["self"] = HypermediaLink{
+		Href: "/partition/{server}/{partition}/config",
+	}
+
+	partitionName := r.PathParam("partition")
+	serverName := r.PathParam("server")
+
+	db, partition, err := mgr.GetPartition(serverName, partitionName)
+	if err != nil {
+		l.Error(err)
+		w.WriteJson(res.End("The partition was not found."))
+		return
+	}
+	config, err := db.PartitionInfo(partition)
+	if err != nil {
+		l.Error(err)
+		w.WriteJson(res.End(err.Error()))
+		return
+	}
+	res.Data["config"] = config
+	res.Data["maintenanceJobId"] = partition.MaintenanceJobId
+
+	for _, item := range c.Entries() {
+		if item.Id == partition.MaintenanceJobId {
+			res.Data["nextScheduledMaintenance"] = item.Next
+		}
+	}
+	res.Success()
+	w.WriteJson(res.End("The partition was found."))
+}
+
+// API: Moves any records from the parent table into child partition tables and reports how many were moved
+func fixPartition(w rest.ResponseWriter, r *rest.Request) {
+	res := NewHypermediaResource()
+
+	res.Links["self"] = HypermediaLink{
+		Href: "/partition/{server}/{partition}/fix",
+	}
+
+	partitionName := r.PathParam("partition")
+	serverName := r.PathParam("server")
+
+	db, partition, err := mgr.GetPartition(serverName, partitionName)
+	if err != nil {
+		writeError(w, res, errorStatus(err), err)
+		return
+	}
+	rows, err := db.PartitionData(partition)
+	if err != nil {
+		writeError(w, res, errorStatus(err), err)
+		return
+	}
+	res.Data["rowsMoved"] = rows
+	res.Success()
+	w.WriteJson(res.End(strconv.FormatInt(rows, 10) + " rows were moved from the parent table to child partition tables."))
+}
+
+// API: Shows which child tables are past the partition's retention period and which will be within ?days= (7 if not given)
+func showRetentionReport(w rest.ResponseWriter, r *rest.Request) {
+	res := NewHypermediaResource()
+
+	res.Links["self"] = HypermediaLink{
+		Href: "/partition/{server}/{partition}/retention{?days}",
+	}
+
+	days, err := daysParam(r)
+	if err != nil {
+		writeError(w, res, http.StatusBadRequest, err)
+		return
+	}
+
+	db, partition, err := mgr.GetPartition(r.PathParam("server"), r.PathParam("partition"))
+	if err != nil {
+		writeError(w, res, errorStatus(err), err)
+		return
+	}
+	report, err := db.RetentionReport(partition, days)
+	if err != nil {
+		writeError(w, res, errorStatus(err), err)
+		return
+	}
+	res.Data["report"] = report
+	res.Success()
+	w.WriteJson(res.End(strconv.Itoa(len(report.Expired)) + " child tables are past the retention period and " + strconv.Itoa(len(report.Expiring)) +
+		" more will be within " + strconv.Itoa(days) + " days."))
+}
+
+// API: Shows how much room a partition has left in the child tables made ahead of the current time (or id).
+// Responds with 503 when it's critical, so a load balancer or uptime check can use it as is.
+func showPartitionHealth(w rest.ResponseWriter, r *rest.Request) {
+	res := NewHypermediaResource()
+
+	res.Links["self"] = HypermediaLink{
+		Href: "/partition/{server}/{partition}/health",
+	}
+
+	db, partition, err := mgr.GetPartition(r.PathParam("server"), r.PathParam("partition"))
+	if err != nil {
+		writeError(w, res, errorStatus(err), err)
+		return
+	}
+	h, err := db.CheckHealth(partition)
+	if err != nil {
+		writeError(w, res, errorStatus(err), err)
+		return
+	}
+	res.Data["health"] = h
+	res.Success()
+	if h.Status == gopartman.HealthCritical {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	w.WriteJson(res.End(h.Table + " is " + h.Status + ": " + h.Message))
+}
+
+// API: Shows the health check of every configured partition (list and hash partitions don't run out, so they're left out).
+// Responds with 503 when any of them is critical or couldn't be checked.
+func showHealth(w rest.ResponseWriter, r *rest.Request) {
+	res := NewHypermediaResource()
+
+	res.Links["self"] = HypermediaLink{
+		Href: "/health",
+	}
+	res.Links["partition:health"] = HypermediaLink{
+		Href:      "/partition/{server}/{partition}/health",
+		Templated: true,
+	}
+
+	type partitionHealth struct {
+		Server    string                     `json:"server"`
+		Partition string                     `json:"partition"`
+		Health    *gopartman.PartitionHealth `json:"health,omitempty"`
+		Error     string                     `json:"error,omitempty"`
+	}
+
+	mgr.RLock()
+	refs := []gopartman.PartitionRef{}
+	for server, db := range mgr.Connections {
+		for name := range db.Partitions {
+			refs = append(refs, gopartman.PartitionRef{Server: server, Partition: name})
+		}
+	}
+	mgr.RUnlock()
+	sort.Slice(refs, func(i, j int) bool {
+		return refs[i].Server+"/"+refs[i].Partition < refs[j].Server+"/"+refs[j].Partition
+	})
+
+	checks := []partitionHealth{}
+	status := gopartman.HealthOK
+	for _, ref := range refs {
+		check := partitionHealth{Server: ref.Server, Partition: ref.Partition}
+		db, p, err := mgr.GetPartition(ref.Server, ref.Partition)
+		if err == nil {
+			var h gopartman.PartitionHealth
+			if h, err = db.CheckHealth(p); err == nil {
+				check.Health = &h
+				if gopartman.HealthLevel(h.Status) > gopartman.HealthLevel(status) {
+					status = h.Status
+				}
+			}
+		}
+		if errors.Is(err, gopartman.ErrNotSupported) {
+			continue
+		}
+		if err != nil {
+			l.Error(err)
+			check.Error = err.Error()
+			status = gopartman.HealthCritical
+		}
+		checks = append(checks, check)
+	}
+	res.Data["status"] = status
+	res.Data["partitions"] = checks
+	res.Success()
+	if status == gopartman.HealthCritical {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	w.WriteJson(res.End("Partitions are " + status + "."))
+}
+
+// Reads the days query parameter (7 if not given).
+func daysParam(r *rest.Request) (int, error) {
+	days := 7
+	if d := r.URL.Query().Get("days"); d != "" {
+		var err error
+		if days, err = strconv.Atoi(d); err != nil {
+			return 0, errors.New("days must be a whole number")
+		}
+	}
+	return days, nil
+}
+
+// API: Shows a partition's rows and size for each of the last few days, and its largest child tables, from the snapshots taken.
+func showStats(w rest.ResponseWriter, r *rest.Request) {
+	res := NewHypermediaResource()
+
+	res.Links["self"] = HypermediaLink{
+		Href:      "/partition/{server}/{partition}/stats{?days}",
+		Templated: true,
+	}
+
+	days, err := daysParam(r)
+	if err != nil {
+		writeError(w, res, http.StatusBadRequest, err)
+		return
+	}
+	db, partition, err := mgr.GetPartition(r.PathParam("server"), r.PathParam("partition"))
+	if err != nil {
+		writeError(w, res, errorStatus(err), err)
+		return
+	}
+	daily, err := db.DailyStats(partition, days)
+	if err != nil {
+		writeError(w, res, errorStatus(err), err)
+		return
+	}
+	children, err := db.ChildGrowth(partition, days)
+	if err != nil {
+		writeError(w, res, errorStatus(err), err)
+		return
+	}
+	res.Data["days"] = daily
+	res.Data["children"] = children
+	res.Success()
+	w.WriteJson(res.End(strconv.Itoa(len(daily)) + " days of snapshots of " + partition.Table + "."))
+}
+
+// API: Shows the largest child tables of every configured partition (10 unless limit is given) with how much they grew over the last few days.
+func showLargestChildren(w rest.ResponseWriter, r *rest.Request) {
+	res := NewHypermediaResource()
+
+	res.Links["self"] = HypermediaLink{
+		Href:      "/stats/largest{?days,limit}",
+		Templated: true,
+	}
+
+	days, err := daysParam(r)
+	if err != nil {
+		writeError(w, res, http.StatusBadRequest, err)
+		return
+	}
+	limit := 10
+	if v := r.URL.Query().Get("limit"); v != "" {
+		if limit, err = strconv.Atoi(v); err != nil || limit < 1 {
+			writeError(w, res, http.StatusBadRequest, errors.New("limit must be a positive whole number"))
+			return
+		}
+	}
+
+	type childGrowth struct {
+		Server    string `json:"server"`
+		Partition string `json:"partition"`
+		gopartman.ChildGrowth
+	}
+	mgr.RLock()
+	refs := []gopartman.PartitionRef{}
+	for server, db := range mgr.Connections {
+		for name := range db.Partitions {
+			refs = append(refs, gopartman.PartitionRef{Server: server, Partition: name})
+		}
+	}
+	mgr.RUnlock()
+
+	children := []childGrowth{}
+	for _, ref := range refs {
+		db, p, err := mgr.GetPartition(ref.Server, ref.Partition)
+		if err != nil {
+			continue
+		}
+		growth, err := db.ChildGrowth(p, days)
+		if err != nil {
+			writeError(w, res, errorStatus(err), err)
+			return
+		}
+		for _, g := range growth {
+			children = append(children, childGrowth{ref.Server, ref.Partition, g})
+		}
+	}
+	sort.SliceStable(children, func(i, j int) bool { return children[i].Bytes > children[j].Bytes })
+	if len(children) > limit {
+		children = children[:limit]
+	}
+	res.Data["children"] = children
+	res.Success()
+	w.WriteJson(res.End("The " + strconv.Itoa(len(children)) + " largest child tables over the last " + strconv.Itoa(days) + " days."))
+}
+
+// API: Renders a bar chart of the rows (or bytes) in each of a partition's child tables as SVG.
+func showChartSVG(w rest.ResponseWriter, r *rest.Request) {
+	showChart(w, r, "svg")
+}
+
+// API: Renders a bar chart of the rows (or bytes) in each of a partition's child tables as PNG.
+func showChartPNG(w rest.ResponseWriter, r *rest.Request) {
+	showChart(w, r, "png")
+}
+
+// Renders a chart for the query parameters: metric (rows or bytes), days (only child tables holding values from that many days
+// ago onwards), by (day for the partition's totals each day from its snapshots), width and height. Errors are still JSON, like the rest of the API.
+func showChart(w rest.ResponseWriter, r *rest.Request, format string) {
+	res := NewHypermediaResource()
+
+	res.Links["self"] = HypermediaLink{
+		Href:      "/partition/{server}/{partition}/chart." + format + "{?metric,days,by,width,height}",
+		Templated: true,
+	}
+
+	q := r.URL.Query()
+	opts := gopartman.ChartOptions{Metric: q.Get("metric"), Daily: q.Get("by") == "day"}
+	for name, dest := range map[string]*int{"days": &opts.Days, "width": &opts.Width, "height": &opts.Height} {
+		if v := q.Get(name); v != "" {
+			var err error
+			if *dest, err = strconv.Atoi(v); err != nil {
+				writeError(w, res, http.StatusBadRequest, errors.New(name+" must be a whole number"))
+				return
+			}
+		}
+	}
+
+	db, partition, err := mgr.GetPartition(r.PathParam("server"), r.PathParam("partition"))
+	if err != nil {
+		writeError(w, res, errorStatus(err), err)
+		return
+	}
+	chart, err := db.ChildChart(partition, opts)
+	if err != nil {
+		writeError(w, res, errorStatus(err), err)
+		return
+	}
+	var b bytes.Buffer
+	if format == "png" {
+		w.Header().Set("Content-Type", "image/png")
+		err = chart.PNG(&b)
+	} else {
+		w.Header().Set("Content-Type", "image/svg+xml")
+		err = chart.SVG(&b)
+	}
+	if err != nil {
+		w.Header().Del("Content-Type")
+		writeError(w, res, http.StatusInternalServerError, err)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	w.(http.ResponseWriter).Write(b.Bytes())
+}
+
+// Serves Prometheus metrics for the partitions and their maintenance. When API keys are configured, one is needed here too
+// (in the Authorization header or the apiKey query parameter, like the rest of the API).
+func serveMetrics(w http.ResponseWriter, r *http.Request) {
+	mgr.RLock()
+	keys := len(mgr.Config.Api.AuthKeys)
+	mgr.RUnlock()
+	if keys > 0 {
+		key := r.Header.Get("Authorization")
+		if key == "" {
+			key = r.URL.Query().Get("apiKey")
+		}
+		if !apiKeyAllowed(key) {
+			w.Header().Set("WWW-Authenticate", "Basic realm=gopartman API")
+			http.Error(w, "Not Authorized", http.StatusUnauthorized)
+			return
+		}
+	}
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	if err := mgr.WriteMetrics(w); err != nil {
+		l.Error(err)
+	}
+}
+
+// API: Adds a new partition, creates it in the database and schedules its maintenance
+func addPartition(w rest.ResponseWriter, r *rest.Request) {
+	res := NewHypermediaResource()
+
+	res.Links["self"] = HypermediaLink{
+		Href: "/partitions/add",
+	}
+
+	body := struct {
+		Server    string              `json:"server"`
+		Name      string              `json:"name"`
+		Partition gopartman.Partition `json:"partition"`
+	}{}
+	if err := r.DecodeJsonPayload(&body); err != nil {
+		writeError(w, res, http.StatusBadRequest, err)
+		return
+	}
+	if body.Name == "" {
+		writeError(w, res, http.StatusBadRequest, errors.New("a name is required for the partition"))
+		return
+	}
+
+	if err := mgr.AddPartition(body.Server, body.Name, body.Partition); err != nil {
+		writeError(w, res, errorStatus(err), err)
+		return
+	}
+	if err := schedulePartition(body.Server, body.Name); err != nil {
+		l.Error(err)
+	}
+
+	_, partition, _ := mgr.GetPartition(body.Server, body.Name)
+	res.Data["partition"] = partition
+	res.Success()
+	w.WriteJson(res.End("The partition was added." + saveConfig(res)))
+}
+
+// API: Updates a partition's settings (such as its retention period)
+func updatePartition(w rest.ResponseWriter, r *rest.Request) {
+	res := NewHypermediaResource()
+
+	res.Links["self"] = HypermediaLink{
+		Href: "/partitions/update/{server}/{partition}",
+	}
+
+	partitionName := r.PathParam("partition")
+	serverName := r.PathParam("server")
+
+	partition := gopartman.Partition{}
+	if err := r.DecodeJsonPayload(&partition); err != nil {
+		writeError(w, res, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := mgr.UpdatePartition(serverName, partitionName, partition); err != nil {
+		writeError(w, res, errorStatus(err), err)
+		return
+	}
+	if err := schedulePartition(serverName, partitionName); err != nil {
+		l.Error(err)
+	}
+
+	_, updated, _ := mgr.GetPartition(serverName, partitionName)
+	res.Data["partition"] = updated
+	res.Success()
+	w.WriteJson(res.End("The partition was updated." + saveConfig(res)))
+}
+
+// API: Undoes a partition (moving data back into the parent table), stops its maintenance and removes it from the configuration
+func deletePartition(w rest.ResponseWriter, r *rest.Request) {
+	res := NewHypermediaResource()
+
+	res.Links["self"] = HypermediaLink{
+		Href: "/partitions/delete/{server}/{partition}",
+	}
+
+	partitionName := r.PathParam("partition")
+	serverName := r.PathParam("server")
+
+	rows, err := mgr.RemovePartition(serverName, partitionName)
+	if err != nil {
+		writeError(w, res, errorStatus(err), err)
+		return
+	}
+	unschedulePartition(serverName, partitionName)
+
+	res.Data["rowsMoved"] = rows
+	res.Success()
+	w.WriteJson(res.End("The partition was removed. " + strconv.FormatInt(rows, 10) + " rows were moved to the parent table." + saveConfig(res)))
+}
+
+// Saves runtime changes back to the configuration file so they aren't lost on restart. The change has already been
+// made, so a failure to save is only noted in the response (returned as a message to append) and "configSaved" is set.
+func saveConfig(res *HypermediaResource) string {
+	if err := mgr.SaveConfig(); err != nil {
+		l.Error(err)
+		res.Data["configSaved"] = false
+		return " However, the configuration file could not be updated: " + err.Error()
+	}
+	res.Data["configSaved"] = true
+	return ""
+}
+
+// Returns the HTTP status code for an error from the gopartman package.
+func errorStatus(err error) int {
+	switch {
+	case errors.Is(err, gopartman.ErrServerNotConfigured), errors.Is(err, gopartman.ErrPartitionNotConfigured), errors.Is(err, gopartman.ErrNoPartitionSet),
+		errors.Is(err, gopartman.ErrNoRetention):
+		return http.StatusNotFound
+	case errors.Is(err, gopartman.ErrPartitionConfigured), errors.Is(err, gopartman.ErrPartitionExists), errors.Is(err, gopartman.ErrUnsafeChange), errors.Is(err, gopartman.ErrLockTimeout),
+		errors.Is(err, gopartman.ErrRepartitionInProgress), errors.Is(err, gopartman.ErrPartitionBusy):
+		return http.StatusConflict
+	case errors.Is(err, gopartman.ErrInvalidPartition), errors.Is(err, gopartman.ErrNotSupported), errors.Is(err, gopartman.ErrInvalidChart):
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
+
+// Logs the error and responds with it as the message.
+func writeError(w rest.ResponseWriter, res *HypermediaResource, status int, err error) {
+	l.Error(err)
+	w.WriteHeader(status)
+	w.WriteJson(res.End(err.Error()))
+}
+
+// Inspired by a few hypermedia formats, this is a structure for Social Harvest API responses.
+// Storing data into Social Harvest is easy...Getting it back out and having other widgets for the dashboard be able to talk with the API is the hard part.
+// So a self documenting API that can be navigated automatically is super handy.
+// NOTE: This is going to change a good bit at first.
+
+// A resource is the root level item being returned. It can contain embedded resources if necessary. It's possible to return more than one resource at a time too (though won't be common).
+// Within each resource there is "_meta" data
+type HypermediaResource struct {
+	Meta     HypermediaMeta                `json:"_meta"`
+	Links    map[string]HypermediaLink     `json:"_links,omitempty"`
+	Curies   map[string]HypermediaCurie    `json:"_curies,omitempty"`
+	Data     map[string]interface{}        `json:"_data,omitempty"`
+	Embedded map[string]HypermediaResource `json:"_embedded,omitempty"`
+	Forms    map[string]HypermediaForm     `json:"_forms,omitempty"`
+}
+
+// The Meta structure provides some common information helpful to the application and also resource state.
+type HypermediaMeta struct {
+	startTime    time.Time
+	Success      bool    `json:"success"`
+	Message      string  `json:"message"`
+	ResponseTime float32 `json:"responseTime,omitempty"`
+	To           string  `json:"to,omitempty"`
+	From         string  `json:"from,omitempty"`
+}
+
+// A simple web link structure (somewhat modeled after HAL's links and http://tools.ietf.org/html/rfc5988).
+// NOTE: in HAL format, links can be an array with aliases - our format has no such support, but this doens't break HAL compatibility.
+// Why not support it? Because that changes from {} to [] and changing data types is a burden for others. Plus we have HTTP 301/302.
+// Also, each "_links" key name using this struct should be one of: http://www.iana.org/assignments/link-relations/link-relations.xhtml unless using CURIEs.
+type HypermediaLink struct {
+	Href        string `json:"href,omitempty"`
+	Type        string `json:"type,omitempty"`
+	Deprecation string `json:"deprecation,omitempty"`
+	Name        string `json:"name,omitempty"`
+	Profile     string `json:"profile,omitempty"`
+	Title       string `json:"title,omitempty"`
+	Hreflang    string `json:"hreflang,omitempty"`
+	Templated   bool   `json:"templated,omitempty"`
+}
+
+// Defines a CURIE
+type HypermediaCurie struct {
+	Name      string `json:"name,omitempty"`
+	Href      string `json:"href,omitempty"`
+	Templated bool   `json:"templated,omitempty"`
+}
+
+// Form structure defines attributes that match HTML. This tells applications how to work with resources in order to manipulate state.
+// Any attribute not found in HTML should be prefixed with an underscore (for example, "_fields").
+type HypermediaForm struct {
+	Name          string                         `json:"name,omitempty"`
+	Method        string                         `json:"method,omitempty"`
+	Enctype       string                         `json:"enctype"`
+	AcceptCharset string                         `json:"accept-charset,omitempty"`
+	Target        string                         `json:"target,omitempty"`
+	Action        string                         `json:"action,omitempty"`
+	Autocomplete  bool                           `json:"autocomplete,omitempty"`
+	Fields        map[string]HypermediaFormField `json:"_fields,omitempty"`
+}
+
+// Defines properties for a field (HTML attributes) as well as holds the "_errors" and validation "_rules" for that field.
+// "_rules" have key names that map to HypermediaFormField.Name, like { "fieldName": HypermediaFormFieldRule } and the rules themself are named.
+// "_errors" have key names that also map to HypermediaFormField.Name
+type HypermediaFormField struct {
+	Name         string                              `json:"name,omitempty"`
+	Value        string                              `json:"value,omitempty"`
+	Type         string                              `json:"type,omitempty"`
+	Src          string                              `json:"src,omitempty"`
+	Checked      bool                                `json:"checked,omitempty"`
+	Disabled     bool                                `json:"disabled,omitempty"`
+	ReadOnly     bool                                `json:"readonly,omitempty"`
+	Required     bool                                `json:"required,omitempty"`
+	Autocomplete bool                                `json:"autocomplete,omitempty"`
+	Tabindex     int                                 `json:"tabindex,omitempty"`
+	Multiple     bool                                `json:"multiple,omitempty"`
+	Accept       string                              `json:"accept,omitempty"`
+	Errors       map[string]HypermediaFormFieldError `json:"_errors,omitempty"`
+	Rules        map[string]HypermediaFormFieldRule  `json:"_rules,omitempty"`
+}
+
+// Error messages from validation failures (optional) "name" is the HypermediaFormFieldRule.Name in this case and "message" is returned on failure.
+type HypermediaFormFieldError struct {
+	Name    string `json:"name"`
+	Failed  bool   `json:"name"`
+	Message string `json:"message,omitempty"`
+}
+
+// Simple validation rules. Easily nested into "_rules" on "_fields" (optional). Of course front-end validation is merely convenience and not a trustable process.
+// So remember to sanitize and validate any data on the server side of things. However, this does help tremendously in reducing the number of HTTP requests to the API.
+type HypermediaFormFieldRule struct {
+	Name        string                                         `json:"name"`
+	Description string                                         `json:"description,omitempty"`
+	Pattern     string                                         `json:"pattern"`
+	Function    func(value string) (fail bool, message string) // not for JSON
+}
+
+// Conveniently sets a few things up for a resource
+func NewHypermediaResource() *HypermediaResource {
+	r := HypermediaResource{}
+	r.Meta.startTime = time.Now()
+	r.Links = make(map[string]HypermediaLink)
+	r.Data = make(map[string]interface{})
+
+	return &r
+}
+
+// Not necessary... But there may be some other functions that make sense...
+func (h *HypermediaResource) Success() {
+	h.Meta.Success = true
+}
+
+func (h *HypermediaResource) AddCurie(name string, href string, templated bool) {
+	c := HypermediaCurie{}
+	c.Name = name
+	c.Href = href
+	c.Templated = templated
+	if len(h.Curies) < 1 {
+		h.Curies = make(map[string]HypermediaCurie)
+	}
+	h.Curies[name] = c
+}
+
+// Conveniently sets a few things before returning the resource and optionally allows a passed string to set HypermediaResource.Meta.Message
+func (h *HypermediaResource) End(message ...string) *HypermediaResource {
+	if len(message) > 0 {
+		h.Meta.Message = message[0]
+	}
+	h.Meta.ResponseTime = float32(time.Since(h.Meta.startTime).Seconds())
+	return h
+}
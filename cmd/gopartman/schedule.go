@@ -0,0 +1,198 @@
+package main
+
+import (
+	"fmt"
+	"github.com/tmaiaroto/cron"
+	"github.com/tmaiaroto/gopartman"
+	"sync"
+	"time"
+)
+
+// Global job pool
+var c *cron.Cron
+
+// The maintenance job currently scheduled for each partition, keyed by jobKey(). Jobs replaced by rescheduling (or unscheduled)
+// are removed from the cron instance by name. A job also only does anything while it's the registered job for its partition,
+// in case it was already running when it was replaced.
+var jobs = struct {
+	sync.Mutex
+	ids   map[string]int64
+	names map[string]string
+}{ids: map[string]int64{}, names: map[string]string{}}
+
+// Closed when the daemon is shutting down, so that no more maintenance is started.
+var stopping = make(chan struct{})
+
+// Maintenance currently being run by scheduled jobs.
+var running sync.WaitGroup
+
+// Set up the schedule.
+func newSchedule() {
+	c = cron.New()
+	c.Start()
+}
+
+func jobKey(serverName string, partitionName string) string {
+	return serverName + "/" + partitionName
+}
+
+// Schedules maintenance for a configured partition, replacing any job already scheduled for it.
+func schedulePartition(serverName string, partitionName string) error {
+	db, p, err := mgr.GetPartition(serverName, partitionName)
+	if err != nil {
+		return err
+	}
+	spec, err := db.MaintenanceSchedule(p)
+	if err != nil {
+		unschedulePartition(serverName, partitionName)
+		return fmt.Errorf("%s on %s is not scheduled for maintenance: %w", partitionName, serverName, err)
+	}
+
+	key := jobKey(serverName, partitionName)
+	// Names are unique to the partition, the old job is removed by name
+	jobName := partitionName + " " + p.Interval + " partition on " + p.Table + " table maintenance on " + serverName + " (" + spec + ")"
+	var id int64
+	// The job reads id under the same lock, so it can't run before id is set
+	jobs.Lock()
+	removeJob(key)
+	id, err = c.AddFunc(spec, func() {
+		jobs.Lock()
+		if jobs.ids[key] != id || isStopping() {
+			jobs.Unlock()
+			return
+		}
+		running.Add(1)
+		jobs.Unlock()
+		defer running.Done()
+
+		db, p, err := mgr.GetPartition(serverName, partitionName)
+		if err != nil {
+			l.Error(err)
+			return
+		}
+		select {
+		case <-time.After(p.MaintenanceDelay()):
+		case <-stopping:
+			return
+		}
+		// Another daemon may be running this partition's maintenance
+		if leader, err := mgr.IsLeader(serverName, partitionName); !leader {
+			if err != nil {
+				l.Error(err)
+			}
+			l.Debug("Skipping maintenance for " + partitionName + " on " + serverName + ", another process holds the lock")
+			return
+		}
+		if flags.reconcile {
+			reconcileScheduled(*db, p)
+		}
+		runScheduledMaintenance(*db, serverName, partitionName, p)
+
+		// A derived schedule for id partitions follows how fast ids are being used, so it may need to change
+		if next, err := db.MaintenanceSchedule(p); err == nil && next != spec {
+			l.Info("Rescheduling maintenance for " + partitionName + " on " + serverName + " to " + next)
+			if err := schedulePartition(serverName, partitionName); err != nil {
+				l.Error(err)
+			}
+		}
+	}, jobName)
+	if err != nil {
+		jobs.Unlock()
+		return err
+	}
+	jobs.ids[key] = id
+	jobs.names[key] = jobName
+	jobs.Unlock()
+	return mgr.SetMaintenanceJobId(serverName, partitionName, id)
+}
+
+// Removes the job scheduled for a partition from the cron instance and the registry. The caller must hold the jobs lock.
+func removeJob(key string) {
+	if name, ok := jobs.names[key]; ok {
+		c.RemoveJob(name)
+	}
+	delete(jobs.ids, key)
+	delete(jobs.names, key)
+}
+
+// Schedules snapshots of child table sizes (see gopartman.Manager.SnapshotStats()), if stats.interval is configured.
+// The interval only changes on restart.
+func scheduleStats() error {
+	mgr.RLock()
+	interval := mgr.Config.Stats.Interval
+	mgr.RUnlock()
+	if interval == "" {
+		return nil
+	}
+	d, err := time.ParseDuration(interval)
+	if err != nil || d <= 0 {
+		return fmt.Errorf("no snapshots of child tables will be taken, stats.interval must be a duration like 1h: %s", interval)
+	}
+	_, err = c.AddFunc("@every "+d.String(), func() {
+		jobs.Lock()
+		if isStopping() {
+			jobs.Unlock()
+			return
+		}
+		running.Add(1)
+		jobs.Unlock()
+		defer running.Done()
+
+		mgr.SnapshotStats()
+	}, "child table snapshots (every "+d.String()+")")
+	return err
+}
+
+// Stops any scheduled maintenance for a partition.
+func unschedulePartition(serverName string, partitionName string) {
+	jobs.Lock()
+	removeJob(jobKey(serverName, partitionName))
+	jobs.Unlock()
+}
+
+// Stops the schedule and waits for any maintenance that is running to finish.
+func stopSchedule() {
+	jobs.Lock()
+	close(stopping)
+	jobs.Unlock()
+	c.Stop()
+	running.Wait()
+}
+
+func isStopping() bool {
+	select {
+	case <-stopping:
+		return true
+	default:
+		return false
+	}
+}
+
+// Checks whether a cron entry is the scheduled job for some partition (rather than one that was unscheduled).
+func isScheduled(id int64) bool {
+	jobs.Lock()
+	defer jobs.Unlock()
+	for _, jobId := range jobs.ids {
+		if jobId == id {
+			return true
+		}
+	}
+	return false
+}
+
+// Runs maintenance from a scheduled job. There is nothing to return an error to, so it is logged (and counted in the metrics).
+func runScheduledMaintenance(db gopartman.DB, serverName string, partitionName string, p *gopartman.Partition) {
+	started := time.Now()
+	err := db.RunMaintenance(p)
+	mgr.ObserveMaintenance(serverName, partitionName, time.Since(started), err)
+	if err != nil {
+		l.Error(err)
+	}
+}
+
+// Applies safe configuration changes before scheduled maintenance. Changes which need a migration are logged on every run until they're dealt with.
+func reconcileScheduled(db gopartman.DB, p *gopartman.Partition) {
+	if _, err := db.Reconcile(p); err != nil {
+		l.Error(err)
+	}
+}
@@ -0,0 +1,119 @@
+/**
+ * This file contains functions for reading and writing the YAML configuration.
+ */
+
+package gopartman
+
+import (
+	"crypto/sha256"
+	"errors"
+	"gopkg.in/yaml.v2"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// A configuration file on disk. It remembers a checksum of what was last read from (or written to) the file so that
+// changes made by hand in the meantime aren't silently overwritten.
+type ConfigFile struct {
+	Path     string
+	checksum [sha256.Size]byte
+	// What was last read, even if it couldn't all be applied (see ReloadConfigFile()), so the same changes aren't tried over and over
+	seen [sha256.Size]byte
+}
+
+// Reads and parses a YAML configuration file.
+func LoadConfig(path string) (Config, error) {
+	_, cfg, err := OpenConfigFile(path)
+	return cfg, err
+}
+
+// Reads and parses a YAML configuration file, returning the file so that the configuration can be saved back to it.
+func OpenConfigFile(path string) (*ConfigFile, Config, error) {
+	cfg := Config{}
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, cfg, err
+	}
+	err = yaml.Unmarshal(b, &cfg)
+	sum := sha256.Sum256(b)
+	return &ConfigFile{Path: path, checksum: sum, seen: sum}, cfg, err
+}
+
+// Checks whether the file on disk is still what was last read or written.
+func (f *ConfigFile) Changed() (bool, error) {
+	b, err := ioutil.ReadFile(f.Path)
+	if err != nil {
+		return false, err
+	}
+	return sha256.Sum256(b) != f.seen, nil
+}
+
+// Writes the configuration to the file. The previous version is kept with a ".bak" extension and the new version is
+// written to a temporary file which then replaces the original, so the file is never left half written.
+// Returns ErrConfigConflict (and writes nothing) if the file was changed since it was last read or written.
+func (f *ConfigFile) Save(cfg Config) error {
+	b, err := yaml.Marshal(&cfg)
+	if err != nil {
+		return err
+	}
+
+	old, err := ioutil.ReadFile(f.Path)
+	if err != nil {
+		return err
+	}
+	if sha256.Sum256(old) != f.checksum {
+		return ErrConfigConflict
+	}
+	mode := os.FileMode(0600)
+	if info, err := os.Stat(f.Path); err == nil {
+		mode = info.Mode().Perm()
+	}
+
+	// Keep a backup of the previous version
+	if err := writeFileAtomic(f.Path+".bak", old, mode); err != nil {
+		return err
+	}
+	if err := writeFileAtomic(f.Path, b, mode); err != nil {
+		return err
+	}
+	f.checksum = sha256.Sum256(b)
+	f.seen = f.checksum
+	return nil
+}
+
+// Writes to a temporary file in the same directory and renames it over the destination.
+func writeFileAtomic(path string, b []byte, mode os.FileMode) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	// Does nothing once renamed
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), mode); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// Saves the current configuration back to the file it was loaded from.
+func (m *Manager) SaveConfig() error {
+	m.Lock()
+	defer m.Unlock()
+	if m.ConfigFile == nil {
+		return errors.New("the configuration was not loaded from a file")
+	}
+	return m.ConfigFile.Save(m.Config)
+}
@@ -0,0 +1,79 @@
+/**
+ * This file contains functions for counting the rows in child tables. Counting every row of a large partition set takes a long time
+ * (and a lot of I/O), so by default the counts are estimates from Postgres' statistics (see children.go). Exact counts are made a few child tables
+ * at a time, each with a statement timeout, and fall back to the estimate for any child table which can't be counted in time.
+ */
+
+package gopartman
+
+import (
+	"errors"
+	"strconv"
+	"sync"
+)
+
+// Counts the records in child tables exactly, with the given number of queries running at a time. With a timeout (in seconds),
+// a count which takes longer is cancelled and the child table keeps its estimate.
+func (db DB) countChildren(c []ChildInfo, workers int, timeout int) error {
+	type count struct {
+		i       int
+		records int
+		err     error
+	}
+	next := make(chan int)
+	counts := make(chan count, len(c))
+	var wg sync.WaitGroup
+	for w := 0; w < workers && w < len(c); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				records, err := db.countRecords(c[i].Table, timeout)
+				counts <- count{i, records, err}
+			}
+		}()
+	}
+	for i := range c {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+	close(counts)
+
+	var firstErr error
+	for n := range counts {
+		switch {
+		case n.err == nil:
+			c[n.i].Records, c[n.i].Estimated = n.records, false
+		case errors.Is(n.err, ErrStatementTimeout):
+			db.Log.Info("Counting the records in " + c[n.i].Table + " took longer than " + strconv.Itoa(timeout) + " seconds, using the estimate.")
+		case firstErr == nil:
+			firstErr = n.err
+		}
+	}
+	return firstErr
+}
+
+// Counts the records in a table, giving up after timeout seconds (0 waits forever).
+func (db DB) countRecords(table string, timeout int) (int, error) {
+	var records int
+	if timeout == 0 {
+		if err := db.Get(&records, "SELECT COUNT(*) FROM "+table); err != nil {
+			return 0, &SQLError{Op: "count records", Table: table, Err: err}
+		}
+		return records, nil
+	}
+	// The timeout only lasts as long as the transaction, so it doesn't stay on the pooled connection
+	tx, err := db.Beginx()
+	if err != nil {
+		return 0, &SQLError{Op: "begin", Table: table, Err: err}
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec("SELECT set_config('statement_timeout', $1, true)", strconv.Itoa(timeout*1000)); err != nil {
+		return 0, &SQLError{Op: "set statement_timeout", Table: table, Err: err}
+	}
+	if err := tx.Get(&records, "SELECT COUNT(*) FROM "+table); err != nil {
+		return 0, &SQLError{Op: "count records", Table: table, Err: err}
+	}
+	return records, nil
+}
@@ -0,0 +1,376 @@
+/**
+ * This file contains dry-run mode. When a DB has a DryRun, the statements its methods would run to change anything are recorded
+ * (in order, with their arguments) instead of being run. Queries which only read still run, so what's recorded is what would be
+ * run right now. What pg_partman's functions would do depends on what's in the database, so that's previewed where it can be.
+ */
+
+package gopartman
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+// A statement which would have been run, with the values bound to its $1, $2... placeholders.
+type Statement struct {
+	Query string        `json:"query"`
+	Args  []interface{} `json:"args,omitempty"`
+}
+
+// Where a DB in dry-run mode records the statements it would have run. It's safe to share between connections and goroutines.
+type DryRun struct {
+	mu         sync.Mutex
+	statements []Statement
+	previews   []string
+}
+
+// Returns the statements recorded so far, in the order they would have been run.
+func (d *DryRun) Statements() []Statement {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]Statement{}, d.statements...)
+}
+
+// Returns what the recorded pg_partman function calls would have done, like which child tables would be created or dropped.
+func (d *DryRun) Previews() []string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]string{}, d.previews...)
+}
+
+func (d *DryRun) record(query string, args []interface{}) {
+	// Arguments are recorded as the values sent to Postgres (so null.String{} is nil and arrays are "{a,b}")
+	values := make([]interface{}, len(args))
+	for i, arg := range args {
+		values[i] = arg
+		if v, ok := arg.(driver.Valuer); ok {
+			if value, err := v.Value(); err == nil {
+				values[i] = value
+			}
+		}
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.statements = append(d.statements, Statement{Query: strings.TrimSpace(query), Args: values})
+}
+
+func (d *DryRun) preview(msg string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.previews = append(d.previews, msg)
+}
+
+// What Exec returns in dry-run mode, nothing was changed.
+type dryRunResult struct{}
+
+func (dryRunResult) LastInsertId() (int64, error) { return 0, nil }
+func (dryRunResult) RowsAffected() (int64, error) { return 0, nil }
+
+// Runs a statement, or records it in dry-run mode. Everything which changes the database goes through here (or NamedExec or a transaction from begin()).
+func (db DB) Exec(query string, args ...interface{}) (sql.Result, error) {
+	if db.DryRun != nil {
+		db.DryRun.record(query, args)
+		return dryRunResult{}, nil
+	}
+	return db.DB.Exec(query, args...)
+}
+
+// Runs a named statement, or records it (with its names bound to placeholders) in dry-run mode.
+func (db DB) NamedExec(query string, arg interface{}) (sql.Result, error) {
+	if db.DryRun != nil {
+		q, args, err := db.BindNamed(query, arg)
+		if err != nil {
+			return nil, err
+		}
+		db.DryRun.record(q, args)
+		return dryRunResult{}, nil
+	}
+	return db.DB.NamedExec(query, arg)
+}
+
+// A transaction which records its statements instead of running them in dry-run mode.
+type dryRunTx struct {
+	*sqlx.Tx
+	dryRun *DryRun
+}
+
+// Begins a transaction. In dry-run mode nothing is begun, its statements are recorded between BEGIN and COMMIT.
+func (db DB) begin() (*dryRunTx, error) {
+	if db.DryRun != nil {
+		db.DryRun.record("BEGIN", nil)
+		return &dryRunTx{dryRun: db.DryRun}, nil
+	}
+	tx, err := db.Beginx()
+	if err != nil {
+		return nil, err
+	}
+	return &dryRunTx{Tx: tx}, nil
+}
+
+func (tx *dryRunTx) Exec(query string, args ...interface{}) (sql.Result, error) {
+	if tx.dryRun != nil {
+		tx.dryRun.record(query, args)
+		return dryRunResult{}, nil
+	}
+	return tx.Tx.Exec(query, args...)
+}
+
+// Runs a statement which changes something and returns a value. In dry-run mode it's recorded and dest is left alone.
+func (tx *dryRunTx) Get(dest interface{}, query string, args ...interface{}) error {
+	if tx.dryRun != nil {
+		tx.dryRun.record(query, args)
+		return nil
+	}
+	return tx.Tx.Get(dest, query, args...)
+}
+
+// Runs a named statement, or records it (with its names bound to placeholders) in dry-run mode.
+func (tx *dryRunTx) NamedExec(query string, arg interface{}) (sql.Result, error) {
+	if tx.dryRun != nil {
+		q, args, err := sqlx.BindNamed(sqlx.DOLLAR, query, arg)
+		if err != nil {
+			return nil, err
+		}
+		tx.dryRun.record(q, args)
+		return dryRunResult{}, nil
+	}
+	return tx.Tx.NamedExec(query, arg)
+}
+
+func (tx *dryRunTx) Commit() error {
+	if tx.dryRun != nil {
+		tx.dryRun.record("COMMIT", nil)
+		return nil
+	}
+	return tx.Tx.Commit()
+}
+
+func (tx *dryRunTx) Rollback() error {
+	if tx.dryRun != nil {
+		tx.dryRun.record("ROLLBACK", nil)
+		return nil
+	}
+	return tx.Tx.Rollback()
+}
+
+// Previews what run_maintenance() would do to a pg_partman partition set: the child tables it would premake and those it would
+// remove under the retention period. With no table, every partition set run_maintenance() maintains on its own is previewed.
+func (db DB) previewMaintenance(table string) error {
+	tables := []string{table}
+	if table == "" {
+		tables = []string{}
+		if err := db.Select(&tables, "SELECT parent_table FROM partman.part_config WHERE use_run_maintenance OR retention IS NOT NULL ORDER BY parent_table"); err != nil {
+			return &SQLError{Op: "read partman.part_config", Err: err}
+		}
+	}
+	for _, t := range tables {
+		pc, err := db.partConfig(t)
+		if err != nil {
+			return err
+		}
+		if pc.UndoInProgress {
+			continue
+		}
+		if table != "" || pc.UseRunMaintenance {
+			premade, err := db.premadeChildren(pc)
+			if err != nil {
+				return err
+			}
+			for _, child := range premade {
+				db.DryRun.preview("run_maintenance() would create " + child + " for " + pc.ParentTable)
+			}
+		}
+		if pc.Retention == "" {
+			continue
+		}
+		expired, err := db.expiredPartmanChildren(pc, pc.Retention)
+		if err != nil {
+			return err
+		}
+		db.previewRemoval("run_maintenance()", pc, expired, pc.RetentionKeepTable, pc.RetentionSchema)
+	}
+	return nil
+}
+
+// Finds the child tables drop_partition_time() or drop_partition_id() will remove with the given arguments (which default to the partition
+// set's own retention settings, like they do in pg_partman), then previews removing them in dry-run mode and archives them if the partition
+// has an archive directory. Returns the number of child tables which will be removed.
+func (db DB) beforeDrop(function string, p *Partition, m map[string]interface{}) (int, error) {
+	table := p.Table
+	pc, err := db.partConfig(table)
+	if err != nil {
+		return 0, err
+	}
+	retention, keepTable, schema := pc.Retention, pc.RetentionKeepTable, pc.RetentionSchema
+	if s := argString(m["retention"]); s != "" {
+		retention = s
+	}
+	if s := argString(m["keepTable"]); s != "" {
+		keepTable, _ = strconv.ParseBool(s)
+	}
+	if s := argString(m["retentionSchema"]); s != "" {
+		schema = s
+	}
+	if retention == "" {
+		return 0, fmt.Errorf("%w for %s", ErrNoRetention, table)
+	}
+	expired, err := db.expiredPartmanChildren(pc, retention)
+	if err != nil {
+		return 0, err
+	}
+	if db.DryRun != nil {
+		db.previewRemoval(function, pc, expired, keepTable, schema)
+	}
+	return len(expired), db.archiveChildren(p, expired)
+}
+
+func (db DB) previewRemoval(function string, pc PartConfig, expired []string, keepTable bool, schema string) {
+	for _, child := range expired {
+		switch {
+		case schema != "":
+			db.DryRun.preview(function + " would take " + child + " out of " + pc.ParentTable + " and move it to the " + schema + " schema")
+		case keepTable:
+			db.DryRun.preview(function + " would take " + child + " out of " + pc.ParentTable + " (and keep it)")
+		default:
+			db.DryRun.preview(function + " would drop " + child + " from " + pc.ParentTable)
+		}
+	}
+}
+
+// Returns the child tables of a pg_partman partition set which are past a retention period, the way drop_partition_time()
+// and drop_partition_id() find them. For id partitions, the retention period is a number of ids below the highest one.
+func (db DB) expiredPartmanChildren(pc PartConfig, retention string) ([]string, error) {
+	children := []string{}
+	if err := db.Select(&children, "SELECT partman.show_partitions($1)", pc.ParentTable); err != nil {
+		return nil, &SQLError{Op: "show_partitions", Table: pc.ParentTable, Err: err}
+	}
+	expired := []string{}
+
+	if strings.HasPrefix(pc.Type, "id-") {
+		keep, err := strconv.ParseInt(retention, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%w: retention must be a number of ids for id partitions", ErrInvalidPartition)
+		}
+		var max sql.NullInt64
+		if err := db.Get(&max, "SELECT max("+pq.QuoteIdentifier(pc.Control)+") FROM "+pc.ParentTable); err != nil {
+			return nil, &SQLError{Op: "get the current id", Table: pc.ParentTable, Err: err}
+		}
+		if !max.Valid {
+			return expired, nil
+		}
+		for _, child := range children {
+			b, err := partmanChildBounds(pc, child)
+			if err == nil && keep <= max.Int64-b.ToId {
+				expired = append(expired, child)
+			}
+		}
+		return expired, nil
+	}
+
+	// pg_partman compares the wall clock times in the child tables' names, so the cutoff is read without a time zone too
+	var cutoff time.Time
+	if err := db.Get(&cutoff, "SELECT localtimestamp - $1::interval", retention); err != nil {
+		return nil, &SQLError{Op: "get the retention cutoff", Table: pc.ParentTable, Err: err}
+	}
+	cutoff = wallClock(cutoff)
+	for _, child := range children {
+		b, err := partmanChildBounds(pc, child)
+		if err == nil && b.To.Before(cutoff) {
+			expired = append(expired, child)
+		}
+	}
+	return expired, nil
+}
+
+// Returns the child tables run_maintenance() would premake for a pg_partman partition set, so there are premake of them after the current one.
+func (db DB) premadeChildren(pc PartConfig) ([]string, error) {
+	ni, err := parseNativeInterval(pc.PartInterval)
+	if err != nil {
+		return nil, err
+	}
+	last := []string{}
+	if err := db.Select(&last, "SELECT partman.show_partitions($1, 'DESC') LIMIT 1", pc.ParentTable); err != nil {
+		return nil, &SQLError{Op: "show_partitions", Table: pc.ParentTable, Err: err}
+	}
+	if len(last) == 0 {
+		return nil, nil
+	}
+	b, err := partmanChildBounds(pc, last[0])
+	if err != nil {
+		return nil, err
+	}
+	premade := []string{}
+
+	if strings.HasPrefix(pc.Type, "id-") {
+		var current sql.NullInt64
+		err := db.Get(&current, "SELECT max("+pq.QuoteIdentifier(pc.Control)+") FROM "+pc.ParentTable)
+		if err != nil {
+			return nil, &SQLError{Op: "get the current id", Table: pc.ParentTable, Err: err}
+		}
+		// Nothing is premade until there are rows, or when rows are past the last child table (pg_partman warns about that instead)
+		if !current.Valid || b.FromId < current.Int64-current.Int64%ni.id {
+			return premade, nil
+		}
+		start := current.Int64 - current.Int64%ni.id
+		for next := b.ToId; (next-start)/ni.id <= int64(pc.Premake); next += ni.id {
+			premade = append(premade, partmanChildName(pc.ParentTable, strconv.FormatInt(next, 10)))
+		}
+		return premade, nil
+	}
+
+	var now time.Time
+	if err := db.Get(&now, "SELECT localtimestamp"); err != nil {
+		return nil, &SQLError{Op: "get the current time", Err: err}
+	}
+	now = wallClock(now)
+	current := ni.start(now)
+	if pc.Type == "time-custom" {
+		// Custom intervals aren't aligned, the current child table is whichever one holds the current time
+		var table string
+		err := db.Get(&table, "SELECT child_table FROM partman.custom_time_partitions WHERE parent_table = $1 AND partition_range @> CURRENT_TIMESTAMP", pc.ParentTable)
+		if err == sql.ErrNoRows {
+			return premade, nil
+		}
+		if err != nil {
+			return nil, &SQLError{Op: "read partman.custom_time_partitions", Table: pc.ParentTable, Err: err}
+		}
+		cb, err := partmanChildBounds(pc, table)
+		if err != nil {
+			return nil, err
+		}
+		current = cb.From
+	}
+	for next := b.From; intervalsBetween(ni, current, next) < pc.Premake; {
+		next = ni.next(next)
+		premade = append(premade, partmanChildName(pc.ParentTable, partmanTimeSuffix(pc.DatetimeString, next)))
+	}
+	return premade, nil
+}
+
+// Returns how many intervals apart two times are, rounded to the nearest whole one (and never negative, like run_maintenance()).
+func intervalsBetween(ni nativeInterval, from time.Time, to time.Time) int {
+	var n float64
+	if ni.months > 0 {
+		months := (to.Year()-from.Year())*12 + int(to.Month()) - int(from.Month())
+		n = float64(months) / float64(ni.months)
+	} else {
+		n = float64(to.Sub(from)) / float64(ni.every)
+	}
+	if n < 0 {
+		n = -n
+	}
+	return int(n + 0.5)
+}
+
+// Returns the wall clock time of a timestamp read from Postgres as if it were in UTC, to compare with times parsed from child table names.
+func wallClock(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), time.UTC)
+}
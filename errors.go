@@ -0,0 +1,68 @@
+package gopartman
+
+import (
+	"errors"
+	"github.com/lib/pq"
+)
+
+// Errors returned by DB and Manager methods. Compare with errors.Is(), since most are wrapped with more detail.
+var (
+	ErrPartitionNotConfigured = errors.New("that partition does not seem to be configured in gopartman.yml")
+	ErrServerNotConfigured    = errors.New("that server does not seem to be configured in gopartman.yml")
+	ErrNotInstalled           = errors.New("pg_partman is not installed, please run the `install` command first")
+	ErrNoPartitionSet         = errors.New("there appears to be no partition set")
+	ErrPartitionExists        = errors.New("partition already exists, you must first run `undo` on it")
+	ErrNoRetention            = errors.New("no retention period configured")
+	ErrLockTimeout            = errors.New("unable to obtain a lock in the time allowed")
+	ErrInvalidPartition       = errors.New("invalid partition")
+	ErrPartitionConfigured    = errors.New("that partition is already configured in gopartman.yml")
+	ErrPartitionBusy          = errors.New("that partition is being added or removed")
+	ErrUnsafeChange           = errors.New("the table, column, type, interval, modulus, existing lists or sub-partitioning of a partition can not be changed in place, it must be re-partitioned (or removed and added again)")
+	ErrConfigConflict         = errors.New("the configuration file was changed by something else since it was loaded, it will not be overwritten")
+	ErrNotSupported           = errors.New("not supported for native partitions")
+	ErrNoRepartition          = errors.New("there is no repartition in progress")
+	ErrRepartitionInProgress  = errors.New("a repartition is already in progress")
+	ErrArchiveCorrupt         = errors.New("the archive does not match its manifest")
+	ErrTableExists            = errors.New("the table already exists")
+	ErrInvalidChart           = errors.New("invalid chart")
+	ErrStatementTimeout       = errors.New("the statement took longer than the time allowed")
+)
+
+// A failed SQL statement or pg_partman function call. Op describes what was being done and Table is the parent table (if any).
+type SQLError struct {
+	Op    string
+	Table string
+	Err   error
+}
+
+func (e *SQLError) Error() string {
+	msg := e.Op
+	if e.Table != "" {
+		msg += " on " + e.Table
+	}
+	return msg + ": " + e.Err.Error()
+}
+
+func (e *SQLError) Unwrap() error {
+	return e.Err
+}
+
+// Allows errors.Is() to match Postgres errors which have a gopartman equivalent.
+func (e *SQLError) Is(target error) bool {
+	pqErr, ok := e.Err.(*pq.Error)
+	if !ok {
+		return false
+	}
+	switch target {
+	case ErrLockTimeout:
+		// lock_not_available
+		return pqErr.Code == "55P03"
+	case ErrNotInstalled:
+		// invalid_schema_name (the partman schema doesn't exist)
+		return pqErr.Code == "3F000"
+	case ErrStatementTimeout:
+		// query_canceled (statement_timeout is the only reason gopartman's statements are cancelled)
+		return pqErr.Code == "57014"
+	}
+	return false
+}
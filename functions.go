@@ -3,156 +3,345 @@
  * Creating, removing, and displaying.
  */
 
-package main
+package gopartman
 
 import (
+	"errors"
+	"fmt"
 	"github.com/imdario/mergo"
 	"gopkg.in/guregu/null.v2"
 	"regexp"
 	"strconv"
 )
 
-// Creates a parent from a given table and creatse partitions based on the given settings.
-func (db DB) CreateParent(p *Partition) {
+// Checks whether or not a partition set exists (has a `partman.part_config` record) for the given parent table.
+func (db DB) partitionSetExists(table string) (bool, error) {
 	var count int
-	err := db.Get(&count, "SELECT COUNT(*) FROM partman.part_config WHERE parent_table = $1", p.Table)
+	err := db.Get(&count, "SELECT COUNT(*) FROM partman.part_config WHERE parent_table = $1", table)
+	if err != nil {
+		return false, &SQLError{Op: "read partman.part_config", Table: table, Err: err}
+	}
+	return count > 0, nil
+}
+
+// Returns ErrNoPartitionSet unless a partition set exists for the given partition's table.
+func (db DB) requirePartitionSet(p *Partition) error {
+	exists, err := db.partitionSetExists(p.Table)
 	if err != nil {
-		l.Error(err)
+		return err
 	}
-	if count > 0 {
-		l.Info("Partition already exists for " + p.Table + " you must first run `undo` on it.")
-		return
+	if !exists {
+		return fmt.Errorf("%w for %s", ErrNoPartitionSet, p.Table)
 	}
+	return nil
+}
 
+// Merges function arguments in order of precedence: overrides passed to the function, then custom function arguments set in configuration, then defaults.
+func mergeArgs(m map[string]interface{}, opts []map[string]interface{}, configured map[string]interface{}, defaults map[string]interface{}) error {
+	// Pull overrides passed to the function (won't come from standalone gopartman, but could from any other package which may use it)
+	if len(opts) > 0 {
+		if err := mergo.Merge(&m, opts[0]); err != nil {
+			return err
+		}
+	}
+	// Pull custom function arguments if set in configuration
+	if configured != nil {
+		if err := mergo.Merge(&m, configured); err != nil {
+			return err
+		}
+	}
+	if defaults != nil {
+		if err := mergo.Merge(&m, defaults); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Runs a named query which returns a single value and scans it into dest.
+// These call pg_partman functions which change things, so in dry-run mode the query is recorded and dest is left alone.
+func (db DB) getNamed(dest interface{}, query string, arg interface{}) error {
+	if db.DryRun != nil {
+		q, args, err := db.BindNamed(query, arg)
+		if err != nil {
+			return err
+		}
+		db.DryRun.record(q, args)
+		return nil
+	}
+	rows, err := db.NamedQuery(query, arg)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		return errors.New("no result returned")
+	}
+	return rows.Scan(dest)
+}
+
+// Creates a parent from a given table and creatse partitions based on the given settings.
+func (db DB) CreateParent(p *Partition, opts ...map[string]interface{}) error {
+	if err := p.Validate(); err != nil {
+		return err
+	}
+	if p.isNative() {
+		return db.createNativeParent(p)
+	}
+	exists, err := db.partitionSetExists(p.Table)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return fmt.Errorf("%w (%s)", ErrPartitionExists, p.Table)
+	}
+	return db.createParent(p, opts...)
+}
+
+// The call to create_parent(), with its arguments named the way createParentCall() names them.
+const createParentSQL = `SELECT partman.create_parent(:table, :column, :type, :interval, :constraintCols, :premake, :useRunMaintenance, :startPartition, :inheritFk, :jobmon, :debug);`
+
+// Returns the arguments to call create_parent() with for a partition.
+func (p Partition) createParentCall(opts []map[string]interface{}) (map[string]interface{}, error) {
 	// SELECT partman.create_parent('test.part_test', 'col3', 'time-static', 'daily');
-	_, err = db.NamedExec(`SELECT partman.create_parent(:table, :column, :type, :interval);`, p)
+	m := map[string]interface{}{"table": p.Table, "column": p.Column, "type": p.Type, "interval": p.Interval}
+	if err := mergeArgs(m, opts, p.Options.Functions.CreateParent, p.createParentArgs()); err != nil {
+		return m, err
+	}
+	// Every level of a sub-partitioned set must be maintained by run_maintenance(), even id partitions
+	if p.SubPartition != nil {
+		m["useRunMaintenance"] = true
+	}
+	return m, validateCreateParentArgs(p.Type, m)
+}
+
+// Creates a pg_partman partition set, without checking whether there already is one (see CreateParent()).
+func (db DB) createParent(p *Partition, opts ...map[string]interface{}) error {
+	m, err := p.createParentCall(opts)
 	if err != nil {
-		l.Error(err)
+		return err
+	}
+	_, err = db.NamedExec(createParentSQL, m)
+	if err != nil {
+		return &SQLError{Op: "create_parent", Table: p.Table, Err: err}
 	}
 
 	// If a retention period was set, the record in partman.part_config table must be updated to include it. It does not get set with create_parent()
-	db.SetRetention(p)
+	if p.Retention != "" {
+		if err := db.setRetention(p); err != nil {
+			return err
+		}
+	}
+	if p.SubPartition != nil {
+		return db.createSubParents(p.Table, p.SubPartition)
+	}
+	return nil
 }
 
-// Creates parents from all configured partitions for a database.
-func (db DB) CreateParents() {
+// Creates parents from all configured partitions for a database. Partitions which already exist are skipped.
+// Every partition is attempted, the last error (if any) is returned.
+func (db DB) CreateParents() error {
+	var lastErr error
 	if len(db.Partitions) == 0 {
-		l.Info("There are no configured partitions to be created.")
+		db.Log.Info("There are no configured partitions to be created.")
 	} else {
 		for _, p := range db.Partitions {
-			db.CreateParent(&p)
+			err := db.CreateParent(&p)
+			if errors.Is(err, ErrPartitionExists) {
+				db.Log.Info(err)
+				continue
+			}
+			if err != nil {
+				db.Log.Error(err)
+				lastErr = err
+			}
 		}
 	}
+	return lastErr
 }
 
-// Calls the `run_maintenance()` function and adds new partition tables and drops old partitions if a retention period was set. If a partition name is passed, it will run maintenance for that partition table ONLY. "NULL" will run maintenance on all tables.
-func (db DB) RunMaintenance(p *Partition, opts ...map[string]interface{}) {
+// Calls the `run_maintenance()` function and adds new partition tables and drops old partitions if a retention period was set. If a partition name is passed, it will run maintenance for that partition table ONLY. "NULL" will run maintenance on all tables, including the configured native partitions.
+func (db DB) RunMaintenance(p *Partition, opts ...map[string]interface{}) error {
 	// Pull basic arguments
 	m := map[string]interface{}{"table": p.Table}
-	// Pull overrides passed to this function (won't come from standalone gopartman, but could from any other package which may use it)
-	if len(opts) > 0 {
-		if err := mergo.Merge(&m, opts[0]); err != nil {
-			l.Error(err)
+	if err := mergeArgs(m, opts, p.Options.Functions.RunMaintenance, map[string]interface{}{"analyze": true, "jobmon": true}); err != nil {
+		return err
+	}
+	if p.isNative() {
+		return db.nativeMaintenance(p)
+	}
+	// No table means all tables. run_maintenance() only maintains pg_partman's partition sets, so native partitions are maintained
+	// first (an error is returned once everything else has been maintained)
+	var nativeErr error
+	if p.Table == "" {
+		m["table"] = null.String{}
+		for _, np := range db.nativePartitions() {
+			if err := db.nativeMaintenance(&np); err != nil {
+				db.Log.Error(err)
+				nativeErr = err
+			}
 		}
 	}
-	// Pull custom function arguments if set in configuration
-	if err := mergo.Merge(&m, p.Options.Functions.RunMaintenance); err != nil {
-		l.Error(err)
+	if db.DryRun != nil {
+		if err := db.previewMaintenance(p.Table); err != nil {
+			return err
+		}
 	}
-	// Defaults
-	if err := mergo.Merge(&m, map[string]interface{}{"analyze": true, "jobmon": true}); err != nil {
-		l.Error(err)
+	// Archive whatever the retention period is about to remove first, run_maintenance() removes it without asking
+	if err := db.archiveExpired(p); err != nil {
+		return err
 	}
 
 	_, err := db.NamedExec(`SELECT partman.run_maintenance(:table, :analyze, :jobmon);`, m)
 	if err != nil {
-		l.Error(err)
+		return &SQLError{Op: "run_maintenance", Table: p.Table, Err: err}
+	}
+	if p.SubPartition == nil || p.Table == "" {
+		return nativeErr
+	}
+
+	// run_maintenance() only maintains the table it's given, so every sub-parent needs it too (top down, since new child tables are sub-partitioned as they're made)
+	subs, err := db.subParents(p.Table)
+	if err != nil {
+		return err
 	}
+	for _, sub := range subs {
+		m["table"] = sub
+		if db.DryRun != nil {
+			if err := db.previewMaintenance(sub); err != nil {
+				return err
+			}
+		}
+		if _, err := db.NamedExec(`SELECT partman.run_maintenance(:table, :analyze, :jobmon);`, m); err != nil {
+			return &SQLError{Op: "run_maintenance", Table: sub, Err: err}
+		}
+	}
+	return nil
 }
 
 // Undo any partition by copying data from the child partition tables to the parent. Note: Batches can not be smaller than the partition interval because this copies entire tables.
-func (db DB) UndoPartition(p *Partition, opts ...map[string]interface{}) {
+// Returns the number of rows moved to the parent.
+func (db DB) UndoPartition(p *Partition, opts ...map[string]interface{}) (int64, error) {
+	if p.isNative() {
+		return 0, fmt.Errorf("undo_partition on %s: %w", p.Table, ErrNotSupported)
+	}
 	// Pull basic arguments
 	m := map[string]interface{}{"table": p.Table}
-	// Pull overrides passed to this function (won't come from standalone gopartman, but could from any other package which may use it)
-	if len(opts) > 0 {
-		if err := mergo.Merge(&m, opts[0]); err != nil {
-			l.Error(err)
-		}
-	}
-	// Pull custom function arguments if set in configuration
-	if err := mergo.Merge(&m, p.Options.Functions.UndoPartition); err != nil {
-		l.Error(err)
-	}
 	// Defaults (https://github.com/keithf4/pg_partman/blob/master/sql/functions/undo_partition.sql#L5)
-	if err := mergo.Merge(&m, map[string]interface{}{"batchCount": 1, "keepTable": true, "jobmon": true, "lockWait": 0}); err != nil {
-		l.Error(err)
+	if err := mergeArgs(m, opts, p.Options.Functions.UndoPartition, map[string]interface{}{"batchCount": 1, "keepTable": true, "jobmon": true, "lockWait": 0}); err != nil {
+		return 0, err
 	}
 
-	_, err := db.NamedExec(`SELECT partman.undo_partition(:table, :batchCount, :keepTable, :jobmon, :lockWait);`, m)
-	if err != nil {
-		l.Error(err)
+	var rows int64
+	if err := db.getNamed(&rows, `SELECT partman.undo_partition(:table, :batchCount, :keepTable, :jobmon, :lockWait);`, m); err != nil {
+		return 0, &SQLError{Op: "undo_partition", Table: p.Table, Err: err}
+	}
+	// undo_partition() returns -1 when it couldn't obtain a lock within lockWait
+	if rows < 0 {
+		return 0, fmt.Errorf("undo_partition on %s: %w", p.Table, ErrLockTimeout)
 	}
 
 	// undo_partition() doesn't seem to remove the part_config record. It seems as if it should be removed too because a new partition on the same table can't be made until it is.
-	_, err = db.NamedExec(`DELETE FROM partman.part_config WHERE parent_table = :table;`, m)
+	_, err := db.NamedExec(`DELETE FROM partman.part_config WHERE parent_table = :table;`, m)
 	if err != nil {
-		l.Error(err)
+		return rows, &SQLError{Op: "remove partman.part_config record", Table: p.Table, Err: err}
 	}
-
+	return rows, nil
 }
 
 // Gets information about a partition.
-func (db DB) PartitionInfo(p *Partition) PartConfig {
+func (db DB) PartitionInfo(p *Partition) (PartConfig, error) {
+	if p.isNative() {
+		return db.nativePartitionInfo(p)
+	}
+	if err := db.requirePartitionSet(p); err != nil {
+		return PartConfig{}, err
+	}
+	return db.partConfig(p.Table)
+}
+
+// Reads the partman.part_config record for a parent table (NULLs are read as empty strings).
+func (db DB) partConfig(table string) (PartConfig, error) {
 	pc := PartConfig{}
-	err := db.Get(&pc, "SELECT parent_table,control,type,part_interval,premake FROM partman.part_config WHERE parent_table = $1 LIMIT 1", p.Table)
+	err := db.Get(&pc, `SELECT parent_table, control, type, part_interval, premake, COALESCE(array_to_string(constraint_cols, ','), '') AS constraint_cols,
+		COALESCE(datetime_string, '') AS datetime_string, COALESCE(retention, '') AS retention, COALESCE(retention_schema, '') AS retention_schema,
+		retention_keep_table, retention_keep_index, use_run_maintenance, inherit_fk, jobmon, undo_in_progress
+		FROM partman.part_config WHERE parent_table = $1 LIMIT 1`, table)
 	if err != nil {
-		l.Error(err)
+		return pc, &SQLError{Op: "read partman.part_config", Table: table, Err: err}
 	}
-	return pc
+	return pc, nil
 }
 
-// Shows child partitions for a partition table.
-func (db DB) GetChildPartitions(p *Partition) []ChildInfo {
+// Shows child partitions for a partition table. The child tables of a sub-partitioned partition include their own children.
+// Record counts are estimates from Postgres' statistics unless the "exact" option is true. Then they're counted, with "workers"
+// (4 if not set) counts running at a time, each cancelled after "statementTimeout" seconds (no limit if not set) in which case
+// the estimate is kept. ChildInfo.Estimated says which it is.
+func (db DB) GetChildPartitions(p *Partition, opts ...map[string]interface{}) ([]ChildInfo, error) {
 	c := []ChildInfo{}
-	err := db.Select(&c, "SELECT partman.show_partitions($1) AS table", p.Table)
-	if err != nil {
-		l.Error(err)
-	} else {
-		// Also get the record count and size on disk for each partition
-		for i, child := range c {
-			err := db.Get(&c[i].Records, "SELECT COUNT(*) FROM "+child.Table)
-			if err != nil {
-				l.Error(err)
-			}
-			// pg_size_pretty() will say "bytes" or "kB" etc.
-			//err = db.Get(&bytesStr, "SELECT pg_size_pretty(pg_total_relation_size('"+child.Table+"'));")
-			err = db.Get(&c[i].BytesOnDisk, "SELECT pg_total_relation_size('"+child.Table+"');")
-			if err != nil {
-				l.Error(err)
-			}
+	m := map[string]interface{}{}
+	if err := mergeArgs(m, opts, nil, map[string]interface{}{"exact": false, "workers": 4, "statementTimeout": 0}); err != nil {
+		return c, err
+	}
+	workers, err := intArg(m["workers"])
+	if err != nil || workers < 1 {
+		return c, fmt.Errorf("%w: workers must be a positive number", ErrInvalidPartition)
+	}
+	timeout, err := intArg(m["statementTimeout"])
+	if err != nil || timeout < 0 {
+		return c, fmt.Errorf("%w: statementTimeout must be a number of seconds", ErrInvalidPartition)
+	}
+
+	if p.isNative() {
+		tables, err := db.nativeChildTables(p.Table)
+		if err != nil {
+			return c, err
+		}
+		for _, table := range tables {
+			c = append(c, ChildInfo{Table: table})
 		}
+	} else if err := db.Select(&c, "SELECT partman.show_partitions($1) AS table", p.Table); err != nil {
+		return c, &SQLError{Op: "show_partitions", Table: p.Table, Err: err}
+	}
+	// Also get the record count, size on disk and the rest for each partition
+	if err := db.addChildBounds(p, c); err != nil {
+		return c, err
 	}
-	return c
+	if err := db.describeChildren(c); err != nil {
+		return c, err
+	}
+	if argString(m["exact"]) == "true" {
+		if err := db.countChildren(c, workers, timeout); err != nil {
+			return c, err
+		}
+	}
+	if p.SubPartition != nil {
+		subs, err := db.subParents(p.Table)
+		if err != nil {
+			return c, err
+		}
+		return c, db.addSubPartitionChildren(c, subs, m)
+	}
+	return c, nil
 }
 
 // Checks parent partition tables to see if any records were inserted there instead of the proper child partition tables. Can be fixed with PartitionDataTime() or PartitionDataId().
-func (db DB) CheckParent() []ParentInfo {
+func (db DB) CheckParent() ([]ParentInfo, error) {
 	ps := []ParentInfo{}
 	// check_parent() returns a string: (parentTable,4) ... meaning a "parentTable" has 4 records. This needs to be parsed.
-	res := []struct {
-		value string `db:"value"`
-	}{}
+	res := []string{}
 	// Make the query and get the row(s)
-	err := db.Select(&res, "SELECT partman.check_parent() AS value")
+	err := db.Select(&res, "SELECT partman.check_parent()::text AS value")
 	if err != nil {
-		l.Error(err)
-		return ps
+		return ps, &SQLError{Op: "check_parent", Err: err}
 	}
 	// Parse each row with regex
 	r, _ := regexp.Compile(`\((.*)\,([0-9]*)\)`)
 	for _, record := range res {
-		pInfo := r.FindStringSubmatch(record.value)
+		pInfo := r.FindStringSubmatch(record)
 		if len(pInfo) == 3 {
 			recordCount, err := strconv.Atoi(pInfo[2])
 			if err == nil {
@@ -161,250 +350,229 @@ func (db DB) CheckParent() []ParentInfo {
 		}
 	}
 
-	return ps
+	return ps, nil
 }
 
 // This function is used to reapply ownership & grants on all child tables based on what the parent table has set (for large partition sets, this can be a very long running operation).
-func (db DB) ReapplyPrivileges(p *Partition) {
+func (db DB) ReapplyPrivileges(p *Partition) error {
 	m := map[string]interface{}{"table": p.Table}
 	_, err := db.NamedExec(`SELECT partman.reapply_privileges(:table);`, m)
 	if err != nil {
-		l.Error(err)
+		return &SQLError{Op: "reapply_privileges", Table: p.Table, Err: err}
 	}
+	return nil
 }
 
 // Applies any foreign keys that exist on a parent table in a partition set to all the child tables. This function is automatically called whenever a new child table is created, so there is no need to manually run it unless you need to fix an existing child table.
-func (db DB) ApplyForeignKeys(p *Partition, opts ...map[string]interface{}) {
+func (db DB) ApplyForeignKeys(p *Partition, opts ...map[string]interface{}) error {
 	// Pull basic arguments
 	m := map[string]interface{}{"table": p.Table}
-	// Pull overrides passed to this function (won't come from standalone gopartman, but could from any other package which may use it)
-	if len(opts) > 0 {
-		if err := mergo.Merge(&m, opts[0]); err != nil {
-			l.Error(err)
-		}
-	}
 	// Defaults (https://github.com/keithf4/pg_partman/blob/master/sql/functions/apply_foreign_keys.sql#L4)
-	if err := mergo.Merge(&m, map[string]interface{}{"childTable": null.String{}, "debug": false}); err != nil {
-		l.Error(err)
+	if err := mergeArgs(m, opts, nil, map[string]interface{}{"childTable": null.String{}, "debug": false}); err != nil {
+		return err
 	}
 	_, err := db.NamedExec(`SELECT partman.apply_foreign_keys(:table, :childTable, :debug);`, m)
 	if err != nil {
-		l.Error(err)
+		return &SQLError{Op: "apply_foreign_keys", Table: p.Table, Err: err}
 	}
+	return nil
 }
 
 // Sets a retention period on a partition
-func (db DB) SetRetention(p *Partition, opts ...map[string]interface{}) {
+func (db DB) SetRetention(p *Partition, opts ...map[string]interface{}) error {
 	if p.Retention == "" {
-		l.Info("No retention period configured.")
-		return
+		return fmt.Errorf("%w for %s", ErrNoRetention, p.Table)
 	}
-	var count int
-	err := db.Get(&count, "SELECT COUNT(*) FROM partman.part_config WHERE parent_table = $1", p.Table)
-	if err != nil {
-		l.Error(err)
+	// Native partitions have no partman.part_config record, retention is applied from the configuration by maintenance
+	if p.isNative() {
+		return db.requireNativeParent(p)
 	}
 	// Make sure it exists.
-	if count > 0 {
-		// Pull basic arguments (TODO: Maybe allow more to be set)
-		m := map[string]interface{}{"table": p.Table, "retention": p.Retention, "retentionSchema": p.Options.RetentionSchema, "retentionKeepTable": p.Options.RetentionKeepTable}
-		// Pull overrides passed to this function (won't come from standalone gopartman, but could from any other package which may use it)
-		if len(opts) > 0 {
-			if err := mergo.Merge(&m, opts[0]); err != nil {
-				l.Error(err)
-			}
-		}
-		// Pull custom function arguments if set in configuration
-		if err := mergo.Merge(&m, p.Options.Functions.SetRetention); err != nil {
-			l.Error(err)
-		}
-		// Defaults are actually going to come from the existing record in this case
-		pc := PartConfig{}
-		err := db.Select(&pc, "SELECT * FROM partman.part_config WHERE parent_table = $1", p.Table)
+	if err := db.requirePartitionSet(p); err != nil {
+		return err
+	}
+	// Maintenance would take the old child tables of a repartition for expired ones, see Repartition()
+	if repartitioning, err := db.repartitioning(p.Table); err != nil || repartitioning {
 		if err != nil {
-			l.Error(err)
-		}
-		if err := mergo.Merge(&m, map[string]interface{}{"retention_schema": pc.RetentionSchema, "retention_keep_table": pc.RetentionKeepTable}); err != nil {
-			l.Error(err)
+			return err
 		}
+		return fmt.Errorf("%w: the retention period of %s is set when it has been re-partitioned", ErrRepartitionInProgress, p.Table)
+	}
+	return db.setRetention(p, opts...)
+}
 
-		_, err = db.NamedExec(`UPDATE partman.part_config SET retention = :retention, retention_schema = :retentionSchema, retention_keep_table = :retentionKeepTable WHERE parent_table = :table;`, m)
-		if err != nil {
-			l.Error(err)
-		} else {
-			l.Info("A retention period has been set for " + p.Table + ". Maintenance will remove old child partition tables.")
-		}
+// Sets the retention period of a pg_partman partition set, without checking it exists (see SetRetention()).
+func (db DB) setRetention(p *Partition, opts ...map[string]interface{}) error {
+	// Pull basic arguments (TODO: Maybe allow more to be set)
+	m := map[string]interface{}{"table": p.Table, "retention": p.Retention, "retentionSchema": p.Options.RetentionSchema, "retentionKeepTable": p.Options.RetentionKeepTable}
+	if err := mergeArgs(m, opts, p.Options.Functions.SetRetention, nil); err != nil {
+		return err
+	}
+
+	_, err := db.NamedExec(`UPDATE partman.part_config SET retention = :retention, retention_schema = :retentionSchema, retention_keep_table = :retentionKeepTable WHERE parent_table = :table;`, m)
+	if err != nil {
+		return &SQLError{Op: "set retention", Table: p.Table, Err: err}
 	}
+	db.Log.Info("A retention period has been set for " + p.Table + ". Maintenance will remove old child partition tables.")
+	return nil
 }
 
 // Removes retention on a partition. Maintenance will no longer remove old child partition tables.
-func (db DB) RemoveRetention(p *Partition) {
-	var count int
-	err := db.Get(&count, "SELECT COUNT(*) FROM partman.part_config WHERE parent_table = $1", p.Table)
-	if err != nil {
-		l.Error(err)
+func (db DB) RemoveRetention(p *Partition) error {
+	if p.isNative() {
+		return db.requireNativeParent(p)
 	}
 	// Make sure it exists.
-	if count > 0 {
-		m := map[string]interface{}{"table": p.Table, "retention": null.String{}, "retentionSchema": null.String{}, "retentionKeepTable": true}
-		_, err = db.NamedExec(`UPDATE partman.part_config SET retention = :retention, retention_schema = :retentionSchema, retention_keep_table = :retentionKeepTable WHERE parent_table = :table;`, m)
-		if err != nil {
-			l.Error(err)
-		} else {
-			l.Info("The retention period has been removed for " + p.Table + ".")
-		}
-	} else {
-		l.Info("There was no retention period set for " + p.Table + ".")
+	if err := db.requirePartitionSet(p); err != nil {
+		return err
 	}
+	m := map[string]interface{}{"table": p.Table, "retention": null.String{}, "retentionSchema": null.String{}, "retentionKeepTable": true}
+	_, err := db.NamedExec(`UPDATE partman.part_config SET retention = :retention, retention_schema = :retentionSchema, retention_keep_table = :retentionKeepTable WHERE parent_table = :table;`, m)
+	if err != nil {
+		return &SQLError{Op: "remove retention", Table: p.Table, Err: err}
+	}
+	db.Log.Info("The retention period has been removed for " + p.Table + ".")
+	return nil
 }
 
 // For time based partitions, this fixes/cleans up partitions which may have accidentally had data written to the parent table. Or, maybe it was data before the partition was created.
-func (db DB) PartitionDataTime(p *Partition, opts ...map[string]interface{}) {
-	var count int
-	err := db.Get(&count, "SELECT COUNT(*) FROM partman.part_config WHERE parent_table = $1", p.Table)
-	if err != nil {
-		l.Error(err)
+// Returns the number of rows moved out of the parent.
+func (db DB) PartitionDataTime(p *Partition, opts ...map[string]interface{}) (int64, error) {
+	if p.isNative() {
+		return 0, fmt.Errorf("partition_data_time on %s: %w", p.Table, ErrNotSupported)
 	}
 	// Make sure it exists.
-	if count > 0 {
-		// Pull basic arguments
-		m := map[string]interface{}{"table": p.Table}
-		// Pull overrides passed to this function (won't come from standalone gopartman, but could from any other package which may use it)
-		if len(opts) > 0 {
-			if err := mergo.Merge(&m, opts[0]); err != nil {
-				l.Error(err)
-			}
-		}
-		// Pull custom function arguments if set in configuration
-		if err := mergo.Merge(&m, p.Options.Functions.PartitionDataTime); err != nil {
-			l.Error(err)
-		}
-		// Defaults (https://github.com/keithf4/pg_partman/blob/master/sql/functions/partition_data_time.sql#L4)
-		if err := mergo.Merge(&m, map[string]interface{}{"batchCount": 1, "batchInterval": null.String{}, "lockWait": 0, "order": "ASC"}); err != nil {
-			l.Error(err)
-		}
+	if err := db.requirePartitionSet(p); err != nil {
+		return 0, err
+	}
+	// Pull basic arguments
+	m := map[string]interface{}{"table": p.Table}
+	// Defaults (https://github.com/keithf4/pg_partman/blob/master/sql/functions/partition_data_time.sql#L4)
+	if err := mergeArgs(m, opts, p.Options.Functions.PartitionDataTime, map[string]interface{}{"batchCount": 1, "batchInterval": null.String{}, "lockWait": 0, "order": "ASC"}); err != nil {
+		return 0, err
+	}
 
-		_, err = db.NamedExec(`SELECT partman.partition_data_time(:table, :batchCount, :batchInterval, :lockWait, :order);`, m)
-		if err != nil {
-			l.Error(err)
-		} else {
-			l.Info("The partition on " + p.Table + " has been cleaned up. Any data written to the parent has now been moved to child partition tables (if they were available).")
-		}
-	} else {
-		l.Info("There appears to be no partition set for " + p.Table + ".")
+	var rows int64
+	if err := db.getNamed(&rows, `SELECT partman.partition_data_time(:table, :batchCount, :batchInterval, :lockWait, :order);`, m); err != nil {
+		return 0, &SQLError{Op: "partition_data_time", Table: p.Table, Err: err}
 	}
+	// partition_data_time() returns -1 when it couldn't obtain a lock within lockWait
+	if rows < 0 {
+		return 0, fmt.Errorf("partition_data_time on %s: %w", p.Table, ErrLockTimeout)
+	}
+	db.Log.Info("The partition on " + p.Table + " has been cleaned up. " + strconv.FormatInt(rows, 10) + " rows written to the parent have now been moved to child partition tables (if they were available).")
+	return rows, nil
 }
 
 // For id based partitions, this fixes/cleans up partitions which may have accidentally had data written to the parent table. Or, maybe it was data before the partition was created.
-func (db DB) PartitionDataId(p *Partition, opts ...map[string]interface{}) {
-	var count int
-	err := db.Get(&count, "SELECT COUNT(*) FROM partman.part_config WHERE parent_table = $1", p.Table)
-	if err != nil {
-		l.Error(err)
+// Returns the number of rows moved out of the parent.
+func (db DB) PartitionDataId(p *Partition, opts ...map[string]interface{}) (int64, error) {
+	if p.isNative() {
+		return 0, fmt.Errorf("partition_data_id on %s: %w", p.Table, ErrNotSupported)
 	}
 	// Make sure it exists.
-	if count > 0 {
-		// Pull basic arguments
-		m := map[string]interface{}{"table": p.Table}
-		// Pull overrides passed to this function (won't come from standalone gopartman, but could from any other package which may use it)
-		if len(opts) > 0 {
-			if err := mergo.Merge(&m, opts[0]); err != nil {
-				l.Error(err)
-			}
-		}
-		// Pull custom function arguments if set in configuration
-		if err := mergo.Merge(&m, p.Options.Functions.PartitionDataId); err != nil {
-			l.Error(err)
-		}
-		// Defaults (https://github.com/keithf4/pg_partman/blob/master/sql/functions/partition_data_id.sql#L4)
-		if err := mergo.Merge(&m, map[string]interface{}{"batchCount": 1, "batchInterval": null.String{}, "lockWait": 0, "order": "ASC"}); err != nil {
-			l.Error(err)
-		}
+	if err := db.requirePartitionSet(p); err != nil {
+		return 0, err
+	}
+	// Pull basic arguments
+	m := map[string]interface{}{"table": p.Table}
+	// Defaults (https://github.com/keithf4/pg_partman/blob/master/sql/functions/partition_data_id.sql#L4)
+	if err := mergeArgs(m, opts, p.Options.Functions.PartitionDataId, map[string]interface{}{"batchCount": 1, "batchInterval": null.String{}, "lockWait": 0, "order": "ASC"}); err != nil {
+		return 0, err
+	}
 
-		_, err = db.NamedExec(`SELECT partman.partition_data_id(:table, :batchCount, :batchInterval, :lockWait, :order);`, m)
-		if err != nil {
-			l.Error(err)
-		} else {
-			l.Info("The partition on " + p.Table + " has been cleaned up. Any data written to the parent has now been moved to child partition tables (if they were available).")
-		}
-	} else {
-		l.Info("There appears to be no partition set for " + p.Table + ".")
+	var rows int64
+	if err := db.getNamed(&rows, `SELECT partman.partition_data_id(:table, :batchCount, :batchInterval, :lockWait, :order);`, m); err != nil {
+		return 0, &SQLError{Op: "partition_data_id", Table: p.Table, Err: err}
+	}
+	// partition_data_id() returns -1 when it couldn't obtain a lock within lockWait
+	if rows < 0 {
+		return 0, fmt.Errorf("partition_data_id on %s: %w", p.Table, ErrLockTimeout)
 	}
+	db.Log.Info("The partition on " + p.Table + " has been cleaned up. " + strconv.FormatInt(rows, 10) + " rows written to the parent have now been moved to child partition tables (if they were available).")
+	return rows, nil
 }
 
-// Manually uninherits (and optionally drops) child partition tables from a time based partition set.
-func (db DB) DropPartitionTime(p *Partition, opts ...map[string]interface{}) {
-	//drop_partition_time(p_parent_table text, p_retention interval DEFAULT NULL, p_keep_table boolean DEFAULT NULL, p_keep_index boolean DEFAULT NULL, p_retention_schema text DEFAULT NULL) RETURNS int
-	//This function is used to drop child tables from a time-based partition set. By default, the table is just uninherited and not actually dropped. For automatically dropping old tables, it is recommended to use the run_maintenance() function with retention configured instead of calling this directly.
-	var count int
-	err := db.Get(&count, "SELECT COUNT(*) FROM partman.part_config WHERE parent_table = $1", p.Table)
+// Moves data out of the parent table into the proper child partition tables, calling PartitionDataTime() or PartitionDataId() depending on the partition set's type.
+// Returns the number of rows moved out of the parent.
+func (db DB) PartitionData(p *Partition, opts ...map[string]interface{}) (int64, error) {
+	pc, err := db.PartitionInfo(p)
 	if err != nil {
-		l.Error(err)
+		return 0, err
+	}
+	switch pc.Type {
+	case "time-dynamic", "time-static", "time-custom":
+		return db.PartitionDataTime(p, opts...)
+	case "id-dynamic", "id-static":
+		return db.PartitionDataId(p, opts...)
+	case NativeType, ListType, HashType:
+		// Postgres won't store rows in a partitioned table, they always go to a child table (or fail to be inserted)
+		return 0, nil
+	}
+	return 0, errors.New("the partition on " + p.Table + " does not seem to have a proper type")
+}
+
+// Manually uninherits (and optionally drops) child partition tables from a time based partition set. Returns the number of child tables dropped.
+func (db DB) DropPartitionTime(p *Partition, opts ...map[string]interface{}) (int, error) {
+	if p.isNative() {
+		return 0, fmt.Errorf("drop_partition_time on %s: %w", p.Table, ErrNotSupported)
 	}
+	//drop_partition_time(p_parent_table text, p_retention interval DEFAULT NULL, p_keep_table boolean DEFAULT NULL, p_keep_index boolean DEFAULT NULL, p_retention_schema text DEFAULT NULL) RETURNS int
+	//This function is used to drop child tables from a time-based partition set. By default, the table is just uninherited and not actually dropped. For automatically dropping old tables, it is recommended to use the run_maintenance() function with retention configured instead of calling this directly.
 	// Make sure it exists.
-	if count > 0 {
-		// Pull basic arguments
-		m := map[string]interface{}{"table": p.Table}
-		// Pull overrides passed to this function (won't come from standalone gopartman, but could from any other package which may use it)
-		if len(opts) > 0 {
-			if err := mergo.Merge(&m, opts[0]); err != nil {
-				l.Error(err)
-			}
-		}
-		// Pull custom function arguments if set in configuration
-		if err := mergo.Merge(&m, p.Options.Functions.DropPartitionTime); err != nil {
-			l.Error(err)
-		}
-		// Defaults (https://github.com/keithf4/pg_partman/blob/master/sql/functions/drop_partition_time.sql#L5)
-		if err := mergo.Merge(&m, map[string]interface{}{"retention": null.String{}, "keepTable": null.String{}, "keepIndex": null.String{}, "retentionSchema": null.String{}}); err != nil {
-			l.Error(err)
-		}
+	if err := db.requirePartitionSet(p); err != nil {
+		return 0, err
+	}
+	// Pull basic arguments
+	m := map[string]interface{}{"table": p.Table}
+	// Defaults (https://github.com/keithf4/pg_partman/blob/master/sql/functions/drop_partition_time.sql#L5)
+	if err := mergeArgs(m, opts, p.Options.Functions.DropPartitionTime, map[string]interface{}{"retention": null.String{}, "keepTable": null.String{}, "keepIndex": null.String{}, "retentionSchema": null.String{}}); err != nil {
+		return 0, err
+	}
 
-		_, err = db.NamedExec(`SELECT partman.drop_partition_time(:table, :retention, :keepTable, :keepIndex, :retentionSchema);`, m)
+	var tables int
+	if db.DryRun != nil || p.Options.ArchiveDirectory != "" {
+		n, err := db.beforeDrop("drop_partition_time()", p, m)
 		if err != nil {
-			l.Error(err)
-		} else {
-			l.Info("The partition on " + p.Table + " has been dropped.")
+			return 0, err
 		}
-	} else {
-		l.Info("There appears to be no partition set for " + p.Table + ".")
+		tables = n
+	}
+	if err := db.getNamed(&tables, `SELECT partman.drop_partition_time(:table, :retention, :keepTable, :keepIndex, :retentionSchema);`, m); err != nil {
+		return 0, &SQLError{Op: "drop_partition_time", Table: p.Table, Err: err}
 	}
+	db.Log.Info(strconv.Itoa(tables) + " child partition tables have been dropped from " + p.Table + ".")
+	return tables, nil
 }
 
-// Manually uninherits (and optionally drops) a child partition table from an id based partition set.
-func (db DB) DropPartitionId(p *Partition, opts ...map[string]interface{}) {
-	//drop_partition_id(p_parent_table text, p_retention bigint DEFAULT NULL, p_keep_table boolean DEFAULT NULL, p_keep_index boolean DEFAULT NULL, p_retention_schema text DEFAULT NULL) RETURNS int
-	var count int
-	err := db.Get(&count, "SELECT COUNT(*) FROM partman.part_config WHERE parent_table = $1", p.Table)
-	if err != nil {
-		l.Error(err)
+// Manually uninherits (and optionally drops) a child partition table from an id based partition set. Returns the number of child tables dropped.
+func (db DB) DropPartitionId(p *Partition, opts ...map[string]interface{}) (int, error) {
+	if p.isNative() {
+		return 0, fmt.Errorf("drop_partition_id on %s: %w", p.Table, ErrNotSupported)
 	}
+	//drop_partition_id(p_parent_table text, p_retention bigint DEFAULT NULL, p_keep_table boolean DEFAULT NULL, p_keep_index boolean DEFAULT NULL, p_retention_schema text DEFAULT NULL) RETURNS int
 	// Make sure it exists.
-	if count > 0 {
-		// Pull basic arguments
-		m := map[string]interface{}{"table": p.Table}
-		// Pull overrides passed to this function (won't come from standalone gopartman, but could from any other package which may use it)
-		if len(opts) > 0 {
-			if err := mergo.Merge(&m, opts[0]); err != nil {
-				l.Error(err)
-			}
-		}
-		// Pull custom function arguments if set in configuration
-		if err := mergo.Merge(&m, p.Options.Functions.DropPartitionTime); err != nil {
-			l.Error(err)
-		}
-		// Defaults (https://github.com/keithf4/pg_partman/blob/master/sql/functions/drop_partition_id.sql#L5)
-		if err := mergo.Merge(&m, map[string]interface{}{"retention": null.String{}, "keepTable": null.String{}, "keepIndex": null.String{}, "retentionSchema": null.String{}}); err != nil {
-			l.Error(err)
-		}
+	if err := db.requirePartitionSet(p); err != nil {
+		return 0, err
+	}
+	// Pull basic arguments
+	m := map[string]interface{}{"table": p.Table}
+	// Defaults (https://github.com/keithf4/pg_partman/blob/master/sql/functions/drop_partition_id.sql#L5)
+	if err := mergeArgs(m, opts, p.Options.Functions.DropPartitionId, map[string]interface{}{"retention": null.String{}, "keepTable": null.String{}, "keepIndex": null.String{}, "retentionSchema": null.String{}}); err != nil {
+		return 0, err
+	}
 
-		_, err = db.NamedExec(`SELECT partman.drop_partition_time(:table, :retention, :keepTable, :keepIndex, :retentionSchema);`, m)
+	var tables int
+	if db.DryRun != nil || p.Options.ArchiveDirectory != "" {
+		n, err := db.beforeDrop("drop_partition_id()", p, m)
 		if err != nil {
-			l.Error(err)
-		} else {
-			l.Info("The partition on " + p.Table + " has been dropped.")
+			return 0, err
 		}
-	} else {
-		l.Info("There appears to be no partition set for " + p.Table + ".")
+		tables = n
+	}
+	if err := db.getNamed(&tables, `SELECT partman.drop_partition_id(:table, :retention, :keepTable, :keepIndex, :retentionSchema);`, m); err != nil {
+		return 0, &SQLError{Op: "drop_partition_id", Table: p.Table, Err: err}
 	}
+	db.Log.Info(strconv.Itoa(tables) + " child partition tables have been dropped from " + p.Table + ".")
+	return tables, nil
 }
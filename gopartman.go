@@ -0,0 +1,349 @@
+// Package gopartman manages Postgres partitions.
+//
+// It wraps the pg_partman SQL (loaded into a `partman` schema rather than installed as an extension) and exposes
+// its functions as methods on DB. A Manager holds the configuration and a connection for each configured server.
+// This package holds no global state, so it can be embedded in other services. The gopartman command
+// (see cmd/gopartman) is a thin CLI and daemon built on top of it.
+package gopartman
+
+import (
+	"database/sql"
+	"github.com/fatih/color"
+	"github.com/jmoiron/sqlx"
+	_ "github.com/lib/pq"
+	"gopkg.in/guregu/null.v2"
+	"log"
+	"sync"
+	"time"
+)
+
+// Version of gopartman
+const Version = "0.2.0"
+
+// The configuration holds everything necessary to manage partitions. Connection information, what to partition, and when.
+type Config struct {
+	Api struct {
+		Port int `json:"port" yaml:"port"`
+		Cors struct {
+			AllowedOrigins []string `json:"allowedOrigins" yaml:"allowedOrigins,omitempty"`
+		} `json:"cors" yaml:"cors,omitempty"`
+		AuthKeys []string `json:"authKeys" yaml:"authKeys,omitempty"`
+	} `json:"api" yaml:"api"`
+	// For running more than one daemon against the same databases, see Manager.IsLeader()
+	Coordination struct {
+		// "server", "partition" or empty (no coordination)
+		Mode string `json:"mode" yaml:"mode,omitempty"`
+	} `json:"coordination" yaml:"coordination,omitempty"`
+	// Snapshots of child table sizes, kept for their history (see stats.go)
+	Stats struct {
+		// How often the daemon takes a snapshot, a duration like "1h" (no snapshots are taken if not set)
+		Interval string `json:"interval" yaml:"interval,omitempty"`
+		// How long snapshots are kept, a Postgres interval like "90 days" (the default)
+		Keep string `json:"keep" yaml:"keep,omitempty"`
+	} `json:"stats" yaml:"stats,omitempty"`
+	Servers map[string]Server `json:"servers" yaml:"servers"`
+}
+
+type Partition struct {
+	Table     string `json:"table" yaml:"table"`
+	Column    string `json:"column" yaml:"column"`
+	Type      string `json:"type" yaml:"type"`
+	Interval  string `json:"interval" yaml:"interval"`
+	Retention string `json:"retention" yaml:"retention,omitempty"`
+	// When maintenance runs, a cron spec or "@every <duration>" (derived from the interval if not set)
+	Schedule string `json:"schedule" yaml:"schedule,omitempty"`
+	// The most to randomly delay each scheduled maintenance run by, a duration like "30s"
+	Jitter string `json:"jitter" yaml:"jitter,omitempty"`
+	// How many child tables to make ahead of the current one (4 if not set)
+	Premake int `json:"premake" yaml:"premake,omitempty"`
+	// How many child tables' worth of room ahead of the current time (or id) the health check warns below, and is critical below (half of premake and 1 if not set)
+	PremakeWarning  int `json:"premakeWarning" yaml:"premakeWarning,omitempty"`
+	PremakeCritical int `json:"premakeCritical" yaml:"premakeCritical,omitempty"`
+	// Columns pg_partman adds constraints on to older child tables, so queries on them can skip children (pg_partman partitions only)
+	ConstraintCols []string `json:"constraintCols" yaml:"constraintCols,omitempty"`
+	// The first child table to make, older data stays in the parent until partitioned (the current time or id if not set)
+	StartPartition string `json:"startPartition" yaml:"startPartition,omitempty"`
+	// Whether run_maintenance() without a table maintains this partition, only id partitions may turn it off (pg_partman's default if not set)
+	UseRunMaintenance *bool `json:"useRunMaintenance" yaml:"useRunMaintenance,omitempty"`
+	// Whether child tables inherit the parent's foreign keys (true if not set)
+	InheritFk *bool `json:"inheritFk" yaml:"inheritFk,omitempty"`
+	// Has create_parent() raise notices about what it's doing
+	Debug bool `json:"debug" yaml:"debug,omitempty"`
+	// For list partitions, the values each child table holds keyed by the child's name (other values get a child table of their own)
+	Lists map[string][]string `json:"lists" yaml:"lists,omitempty"`
+	// For hash partitions, the number of child tables rows are spread across
+	Modulus int `json:"modulus" yaml:"modulus,omitempty"`
+	// Partitions each child table again (pg_partman partitions only)
+	SubPartition *SubPartition `json:"subPartition" yaml:"subPartition,omitempty"`
+	Options      struct {
+		Functions struct {
+			CreateParent      map[string]interface{} `json:"createParent" yaml:"createParent,omitempty"`
+			RunMaintenance    map[string]interface{} `json:"runMaintenance" yaml:"runMaintenance,omitempty"`
+			UndoPartition     map[string]interface{} `json:"undoPartition" yaml:"undoPartition,omitempty"`
+			SetRetention      map[string]interface{} `json:"setRetention" yaml:"setRetention,omitempty"`
+			PartitionDataId   map[string]interface{} `json:"partitionDataId" yaml:"partitionDataId,omitempty"`
+			PartitionDataTime map[string]interface{} `json:"partitionDataTime" yaml:"partitionDataTime,omitempty"`
+			DropPartitionId   map[string]interface{} `json:"dropPartitionId" yaml:"dropPartitionId,omitempty"`
+			DropPartitionTime map[string]interface{} `json:"dropPartitionTime" yaml:"dropPartitionTime,omitempty"`
+		} `json:"functions" yaml:"functions,omitempty"`
+		RetentionSchema    null.String `json:"retentionSchema" yaml:"retentionSchema,omitempty"`
+		RetentionKeepTable bool        `json:"retentionKeepTable" yaml:"retentionKeepTable,omitempty"`
+		// Where child tables are exported to (gzipped CSV files with a manifest) before retention removes them, see archive.go
+		ArchiveDirectory string `json:"archiveDirectory" yaml:"archiveDirectory,omitempty"`
+		// Whether pg_partman logs create_parent() to pg_jobmon, if it's installed (true if not set)
+		Jobmon *bool `json:"jobmon" yaml:"jobmon,omitempty"`
+	} `json:"options" yaml:"options,omitempty"`
+	// Set when maintenance is scheduled, it isn't saved to the configuration file
+	MaintenanceJobId int64 `json:"maintenanceJobId" yaml:"-"`
+}
+
+// A level of sub-partitioning. Every child table of the level above becomes the parent of a partition set of its own.
+type SubPartition struct {
+	Column    string `json:"column" yaml:"column"`
+	Type      string `json:"type" yaml:"type"`
+	Interval  string `json:"interval" yaml:"interval"`
+	Premake   int    `json:"premake" yaml:"premake,omitempty"`
+	Retention string `json:"retention" yaml:"retention,omitempty"`
+	// Another level below this one
+	SubPartition *SubPartition `json:"subPartition" yaml:"subPartition,omitempty"`
+}
+
+type Server struct {
+	Database   string               `json:"database" yaml:"database"`
+	Host       string               `json:"host" yaml:"host"`
+	Port       string               `json:"port" yaml:"port"`
+	User       string               `json:"user" yaml:"user"`
+	Password   string               `json:"password" yaml:"password,omitempty"`
+	Partitions map[string]Partition `json:"paritions" yaml:"partitions"`
+}
+
+// A struct for records in the `partman.part_config` table.
+type PartConfig struct {
+	ConstraintCols     string `json:"constraint_cols" yaml:"constraint_cols" db:"constraint_cols"`
+	Control            string `json:"control" yaml:"control" db:"control"`
+	DatetimeString     string `json:"datetime_string" yaml:"datetime_string" db:"datetime_string"`
+	InheritFk          bool   `json:"inherit_fk" yaml:"inherit_fk" db:"inherit_fk"`
+	Jobmon             bool   `json:"jobmon" yaml:"jobmon" db:"jobmon"`
+	ParentTable        string `json:"parent_table" yaml:"parent_table" db:"parent_table"`
+	PartInterval       string `json:"part_interval" yaml:"part_interval" db:"part_interval"`
+	Premake            int    `json:"premake" yaml:"premake" db:"premake"`
+	Retention          string `json:"retention" yaml:"retention" db:"retention"`
+	RetentionKeepIndex bool   `json:"retention_keep_index" yaml:"retention_keep_index" db:"retention_keep_index"`
+	RetentionKeepTable bool   `json:"retention_keep_table" yaml:"retention_keep_table" db:"retention_keep_table"`
+	RetentionSchema    string `json:"retention_schema" yaml:"retention_schema" db:"retention_schema"`
+	Type               string `json:"type" yaml:"type" db:"type"`
+	UndoInProgress     bool   `json:"undo_in_progress" yaml:"undo_in_progress" db:"undo_in_progress"`
+	UseRunMaintenance  bool   `json:"use_run_maintenance" yaml:"use_run_maintenance" db:"use_run_maintenance"`
+}
+
+// A struct for records in the `partman.part_config_sub` table, with how far below the top parent table the sub-parent is.
+type PartConfigSub struct {
+	Depth           int    `json:"depth" yaml:"depth" db:"depth"`
+	SubParent       string `json:"sub_parent" yaml:"sub_parent" db:"sub_parent"`
+	SubType         string `json:"sub_type" yaml:"sub_type" db:"sub_type"`
+	SubControl      string `json:"sub_control" yaml:"sub_control" db:"sub_control"`
+	SubPartInterval string `json:"sub_part_interval" yaml:"sub_part_interval" db:"sub_part_interval"`
+	SubPremake      int    `json:"sub_premake" yaml:"sub_premake" db:"sub_premake"`
+	SubRetention    string `json:"sub_retention" yaml:"sub_retention" db:"sub_retention"`
+}
+
+// A struct for children partition tables. A sub-partitioned child has children of its own.
+type ChildInfo struct {
+	Table       string `json:"table" db:"table"`
+	Records     int    `json:"records" db:"records"`
+	BytesOnDisk uint64 `json:"bytesOnDisk" db:"bytesOnDisk"`
+	// Whether Records is an estimate from Postgres' statistics rather than counted
+	Estimated bool `json:"estimated" db:"-"`
+	// What BytesOnDisk is made of (the heap's free space and visibility maps make up the rest)
+	HeapBytes  uint64 `json:"heapBytes" db:"heapBytes"`
+	IndexBytes uint64 `json:"indexBytes" db:"indexBytes"`
+	ToastBytes uint64 `json:"toastBytes" db:"toastBytes"`
+	// The range of values the child table holds (times or ids, From inclusive and To exclusive), empty if it has none
+	From string `json:"from,omitempty" db:"-"`
+	To   string `json:"to,omitempty" db:"-"`
+	// When the child table was last vacuumed and analyzed (by hand or autovacuum), nil if it never was
+	LastVacuum  *time.Time `json:"lastVacuum,omitempty" db:"lastVacuum"`
+	LastAnalyze *time.Time `json:"lastAnalyze,omitempty" db:"lastAnalyze"`
+	// Whether the child table still inherits from (or is attached to) a parent table
+	Inherited bool        `json:"inherited" db:"inherited"`
+	Children  []ChildInfo `json:"children,omitempty" db:"-"`
+}
+
+// A struct for parent partition tables (not much different than Child)
+type ParentInfo struct {
+	Table   string `json:"table" db:"table"`
+	Records int    `json:"records" db:"records"`
+}
+
+// Wrap sqlx.DB in order to add to it
+type DB struct {
+	*sqlx.DB
+	Partitions map[string]Partition
+	Log        Logger
+	// When set, statements which would change anything are recorded here instead of being run (see dryrun.go)
+	DryRun *DryRun
+	// How fast the ids of id partitions are used (see idRate())
+	idSamples *idSamples
+}
+
+// Logging (some functions always display output while others only if verbose). Anything embedding gopartman can supply its own.
+type Logger interface {
+	Info(msg interface{})
+	Debug(msg interface{})
+	Error(msg interface{})
+	Critical(msg interface{})
+}
+
+// The default Logger, writes to the standard logger. Info and Debug messages are only shown when Verbose is true.
+type StdLogger struct {
+	Verbose bool
+}
+
+func (l StdLogger) Info(msg interface{}) {
+	if l.Verbose {
+		log.Println(msg)
+	}
+}
+func (l StdLogger) Debug(msg interface{}) {
+	if l.Verbose {
+		log.SetFlags(log.LstdFlags | log.Lshortfile)
+		log.Println(msg)
+	}
+}
+func (l StdLogger) Critical(msg interface{}) {
+	log.Println(color.RedString("%v", msg))
+}
+func (l StdLogger) Error(msg interface{}) {
+	log.Println(color.YellowString("%v", msg))
+}
+
+// Opens a connection to a configured server. A nil logger will use a (non-verbose) StdLogger.
+func NewPostgresConnection(cfg Server, logger Logger) (DB, error) {
+	if logger == nil {
+		logger = StdLogger{}
+	}
+	db, err := sqlx.Connect("postgres", "host="+cfg.Host+" port="+cfg.Port+" sslmode=disable  dbname="+cfg.Database+" user="+cfg.User+" password="+cfg.Password)
+	if err != nil {
+		logger.Error(err)
+		return DB{Partitions: cfg.Partitions, Log: logger, idSamples: &idSamples{}}, err
+	}
+	return DB{DB: db, Partitions: cfg.Partitions, Log: logger, idSamples: &idSamples{}}, err
+}
+
+// Manager holds the configuration and a connection to each configured server.
+// It is safe to use from multiple goroutines, anything reading Config or Connections directly should hold a read lock.
+type Manager struct {
+	sync.RWMutex
+	Config      Config
+	Connections map[string]DB
+	Log         Logger
+	// Where the configuration came from (if it was loaded from a file), used by SaveConfig()
+	ConfigFile *ConfigFile
+	// Set before Connect() to have every connection record statements instead of running them (including installing pg_partman and creating partitions)
+	DryRun *DryRun
+	// Advisory locks held to coordinate with other processes, keyed by lockName(), and the connection they're held on for each server
+	locks     map[string]advisoryLock
+	lockConns map[string]*sql.Conn
+	locksMu   sync.Mutex
+	// Partitions being added, updated or removed (and new servers being connected to, with no partition name), see reserve()
+	pending map[PartitionRef]bool
+	// Maintenance runs observed for the metrics, see metrics.go
+	maintenance maintenanceMetrics
+}
+
+// Returns a Manager for the given configuration. No connections are made until Connect() is called. A nil logger will use a (non-verbose) StdLogger.
+func NewManager(cfg Config, logger Logger) *Manager {
+	if logger == nil {
+		logger = StdLogger{}
+	}
+	return &Manager{
+		Config:      cfg,
+		Connections: map[string]DB{},
+		Log:         logger,
+		locks:       map[string]advisoryLock{},
+	}
+}
+
+// Sets up all of the connections from the configuration and ensures they have the pg_partman schema, table, and functions loaded.
+// Then creates the configured partitions. A server that can't be reached is logged and skipped, the last such error is returned.
+func (m *Manager) Connect() error {
+	m.Lock()
+	defer m.Unlock()
+	var lastErr error
+	for conn, credentials := range m.Config.Servers {
+		if err := m.connect(conn, credentials); err != nil {
+			lastErr = err
+		}
+	}
+	return lastErr
+}
+
+// Connects to a server, making sure pg_partman is installed and creating its configured partitions. The caller must hold the lock.
+func (m *Manager) connect(conn string, credentials Server) error {
+	db, err := m.dial(conn, credentials)
+	if db.DB != nil {
+		m.Connections[conn] = db
+	}
+	return err
+}
+
+// Does the work of connect() without storing the connection, so it can be done without holding the lock.
+// The connection is returned (with an error) even if installing pg_partman or creating partitions failed.
+func (m *Manager) dial(conn string, credentials Server) (DB, error) {
+	db, err := NewPostgresConnection(credentials, m.Log)
+	if err != nil {
+		return db, err
+	}
+	db.DryRun = m.DryRun
+
+	// First make sure pg_partman is on each server
+	installed, err := db.partmanInstalled()
+	if err == nil && !installed {
+		err = db.LoadPgPartman()
+	}
+	if err != nil {
+		m.Log.Error(err)
+		return db, err
+	}
+	// In dry-run mode pg_partman wasn't really installed, so there's nothing to create partitions with
+	if !installed && db.DryRun != nil {
+		db.DryRun.preview("the configured partitions on " + conn + " would be created once pg_partman is installed")
+		return db, nil
+	}
+	// Then create the partitions based on the config
+	return db, db.CreateParents()
+}
+
+// Closes all connections.
+func (m *Manager) Close() {
+	m.Lock()
+	defer m.Unlock()
+	m.releaseLocks("")
+	for _, db := range m.Connections {
+		if db.DB != nil {
+			db.DB.Close()
+		}
+	}
+}
+
+// Returns the Partition (and the connection to its server) from configuration if it exists.
+func (m *Manager) GetPartition(serverName string, partitionName string) (*DB, *Partition, error) {
+	m.RLock()
+	defer m.RUnlock()
+	if sVal, ok := m.Connections[serverName]; ok {
+		if pVal, ok := sVal.Partitions[partitionName]; ok {
+			return &sVal, &pVal, nil
+		}
+	}
+	return &DB{}, &Partition{}, ErrPartitionNotConfigured
+}
+
+// Returns just the database server connection from configuration if it exists.
+func (m *Manager) GetServer(serverName string) (*DB, error) {
+	m.RLock()
+	defer m.RUnlock()
+	if sVal, ok := m.Connections[serverName]; ok {
+		return &sVal, nil
+	}
+	return &DB{}, ErrServerNotConfigured
+}
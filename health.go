@@ -0,0 +1,190 @@
+/**
+ * This file contains the premake health check. If maintenance fails (or the daemon is down) for long enough, a partition runs past its
+ * newest child table and rows land in the parent table (or can't be inserted at all). The check compares the end of the newest child
+ * table's range with the current time (or the highest id) and warns while there's still room left.
+ */
+
+package gopartman
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+)
+
+// The states of a health check, in order of how bad they are.
+const (
+	HealthOK       = "ok"
+	HealthWarning  = "warning"
+	HealthCritical = "critical"
+)
+
+// How much room a partition has left in the child tables made ahead of the current time (or id).
+type PartitionHealth struct {
+	Table  string `json:"table"`
+	Status string `json:"status"`
+	// What's wrong (or how much room there is)
+	Message string `json:"message"`
+	// The child table with the furthest range and the end of its range
+	NewestChild string `json:"newestChild"`
+	Until       string `json:"until"`
+	// The current time (in the terms child tables are named in) or the highest id
+	Current string `json:"current"`
+	// How many child tables' worth of room is left ahead of Current, 0 once it's past the newest child table
+	Runway float64 `json:"runway"`
+	// Child tables which start after Current
+	Premade int `json:"premade"`
+	// The runway the status changes at
+	Warning  int `json:"warning"`
+	Critical int `json:"critical"`
+}
+
+// Returns the runway (in child tables) below which a partition's health check warns, and is critical.
+func (p Partition) premakeThresholds() (int, int) {
+	warning, critical := p.PremakeWarning, p.PremakeCritical
+	if critical == 0 {
+		critical = 1
+	}
+	if warning == 0 {
+		premake := p.Premake
+		if premake == 0 {
+			premake = 4
+		}
+		warning = (premake + 1) / 2
+	}
+	if warning < critical {
+		warning = critical
+	}
+	return warning, critical
+}
+
+// Checks how many child tables' worth of room a partition has left ahead of the current time (or its highest id).
+func (db DB) CheckHealth(p *Partition) (PartitionHealth, error) {
+	if p.Type == ListType || p.Type == HashType {
+		return PartitionHealth{Table: p.Table}, fmt.Errorf("health check on %s: %w", p.Table, ErrNotSupported)
+	}
+	if !p.isNative() {
+		if err := db.requirePartitionSet(p); err != nil {
+			return PartitionHealth{Table: p.Table}, err
+		}
+	}
+	tables, err := db.childTableNames(p)
+	if err != nil {
+		return PartitionHealth{Table: p.Table}, err
+	}
+	return db.checkHealth(p, tables)
+}
+
+// Lists the names of a partition's child tables, without counting their rows like GetChildPartitions().
+func (db DB) childTableNames(p *Partition) ([]string, error) {
+	if p.isNative() {
+		return db.nativeChildTables(p.Table)
+	}
+	tables := []string{}
+	if err := db.Select(&tables, "SELECT partman.show_partitions($1)", p.Table); err != nil {
+		return tables, &SQLError{Op: "show_partitions", Table: p.Table, Err: err}
+	}
+	return tables, nil
+}
+
+func (db DB) checkHealth(p *Partition, tables []string) (PartitionHealth, error) {
+	h := PartitionHealth{Table: p.Table}
+	h.Warning, h.Critical = p.premakeThresholds()
+	bounds, err := db.childRanges(p)
+	if err != nil {
+		return h, err
+	}
+
+	var now time.Time
+	var max int64
+	if p.idBased() {
+		max, err = db.maxId(p.Table, p.Column)
+		h.Current = strconv.FormatInt(max, 10)
+	} else {
+		now, err = db.partitionNow(p)
+		h.Current = now.Format("2006-01-02 15:04:05")
+	}
+	if err != nil {
+		return h, err
+	}
+
+	var newest childBounds
+	found := false
+	for _, table := range tables {
+		b, err := bounds(table)
+		if err != nil {
+			// Not one of the child tables maintenance makes (the default child table, for instance)
+			continue
+		}
+		if p.idBased() {
+			if b.FromId > max {
+				h.Premade++
+			}
+			if !found || b.ToId > newest.ToId {
+				newest, h.NewestChild = b, table
+			}
+		} else {
+			if b.From.After(now) {
+				h.Premade++
+			}
+			if !found || b.To.After(newest.To) {
+				newest, h.NewestChild = b, table
+			}
+		}
+		found = true
+	}
+	if !found {
+		h.Status, h.Message = HealthCritical, "there are no child tables for new rows"
+		return h, nil
+	}
+
+	if p.idBased() {
+		h.Until = strconv.FormatInt(newest.ToId, 10)
+	} else {
+		h.Until = newest.To.Format("2006-01-02 15:04:05")
+	}
+	h.setRunway(newest.runway(now, max))
+	return h, nil
+}
+
+// Returns how many of a child table's lengths are left between the current time (or highest id) and the end of its range.
+// The runway is measured in lengths of the newest child table (months vary, so that's as good as any).
+func (b childBounds) runway(now time.Time, max int64) float64 {
+	if b.To.IsZero() {
+		return float64(b.ToId-max) / float64(b.ToId-b.FromId)
+	}
+	return float64(b.To.Sub(now)) / float64(b.To.Sub(b.From))
+}
+
+// Sets the runway (never less than 0) and the status it's in given the warning and critical thresholds.
+func (h *PartitionHealth) setRunway(runway float64) {
+	runway = math.Max(0, runway)
+	h.Runway = math.Round(runway*100) / 100
+
+	switch {
+	case runway == 0:
+		h.Status, h.Message = HealthCritical, "past the newest child table "+h.NewestChild+", new rows have nowhere to go"
+	case runway < float64(h.Critical):
+		h.Status, h.Message = HealthCritical, "only "+formatRunway(h.Runway)+" left before "+h.NewestChild+" runs out"
+	case runway < float64(h.Warning):
+		h.Status, h.Message = HealthWarning, "only "+formatRunway(h.Runway)+" left before "+h.NewestChild+" runs out"
+	default:
+		h.Status, h.Message = HealthOK, formatRunway(h.Runway)+" left"
+	}
+}
+
+// Returns how bad a health check's status is, from 0 (ok) to 2 (critical).
+func HealthLevel(status string) int {
+	switch status {
+	case HealthCritical:
+		return 2
+	case HealthWarning:
+		return 1
+	}
+	return 0
+}
+
+func formatRunway(runway float64) string {
+	return strconv.FormatFloat(runway, 'f', -1, 64) + " child tables' worth of room"
+}
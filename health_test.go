@@ -0,0 +1,76 @@
+package gopartman
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPremakeThresholds(t *testing.T) {
+	tests := []struct {
+		p        Partition
+		warning  int
+		critical int
+	}{
+		{Partition{}, 2, 1},
+		{Partition{Premake: 10}, 5, 1},
+		{Partition{Premake: 7}, 4, 1},
+		{Partition{Premake: 1}, 1, 1},
+		{Partition{Premake: 10, PremakeCritical: 3}, 5, 3},
+		{Partition{Premake: 4, PremakeCritical: 3}, 3, 3},
+		{Partition{Premake: 4, PremakeWarning: 3}, 3, 1},
+		{Partition{PremakeWarning: 6, PremakeCritical: 2}, 6, 2},
+	}
+	for _, test := range tests {
+		warning, critical := test.p.premakeThresholds()
+		if warning != test.warning || critical != test.critical {
+			t.Errorf("premakeThresholds() for %+v returned %d, %d, want %d, %d", test.p, warning, critical, test.warning, test.critical)
+		}
+	}
+}
+
+func TestChildBoundsRunway(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2020, time.January, d, 0, 0, 0, 0, time.UTC) }
+	tests := []struct {
+		name   string
+		newest childBounds
+		now    time.Time
+		max    int64
+		want   float64
+	}{
+		{"time, four days left", childBounds{From: day(4), To: day(5)}, day(1), 0, 4},
+		{"time, half a child left", childBounds{From: day(4), To: day(5)}, day(4).Add(12 * time.Hour), 0, 0.5},
+		{"time, past the newest child", childBounds{From: day(4), To: day(5)}, day(7), 0, -2},
+		{"ids, three children left", childBounds{FromId: 4000, ToId: 5000}, time.Time{}, 2000, 3},
+		{"ids, a quarter left", childBounds{FromId: 4000, ToId: 5000}, time.Time{}, 4750, 0.25},
+		{"ids, past the newest child", childBounds{FromId: 4000, ToId: 5000}, time.Time{}, 6000, -1},
+	}
+	for _, test := range tests {
+		if got := test.newest.runway(test.now, test.max); got != test.want {
+			t.Errorf("%s: runway() returned %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestSetRunway(t *testing.T) {
+	tests := []struct {
+		runway float64
+		want   float64
+		status string
+	}{
+		{-2, 0, HealthCritical},
+		{0, 0, HealthCritical},
+		{0.5, 0.5, HealthCritical},
+		{0.999, 1, HealthCritical},
+		{1, 1, HealthWarning},
+		{1.333333, 1.33, HealthWarning},
+		{2, 2, HealthOK},
+		{10, 10, HealthOK},
+	}
+	for _, test := range tests {
+		h := PartitionHealth{NewestChild: "public.events_p2020_01_05", Warning: 2, Critical: 1}
+		h.setRunway(test.runway)
+		if h.Runway != test.want || h.Status != test.status || h.Message == "" {
+			t.Errorf("setRunway(%v) set %v, %s (%q), want %v, %s", test.runway, h.Runway, h.Status, h.Message, test.want, test.status)
+		}
+	}
+}
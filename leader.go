@@ -0,0 +1,237 @@
+/**
+ * This file contains functions for coordinating with other gopartman processes managing the same databases.
+ * Postgres advisory locks decide which process runs maintenance, so nothing else needs to be running.
+ */
+
+package gopartman
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"strings"
+	"time"
+)
+
+// Coordination modes (Config.Coordination.Mode).
+const (
+	// One process runs maintenance for all of a server's partitions
+	CoordinateServer = "server"
+	// Each partition's maintenance can be run by a different process
+	CoordinatePartition = "partition"
+)
+
+// How long pinging, taking or releasing an advisory lock may take before the connection it's held on is given up as dead.
+const lockTimeout = 5 * time.Second
+
+// A session level advisory lock. Every lock on a server is held on the same connection of its own, for as long as this process
+// holds it. Postgres releases the locks when that connection closes, including when the process holding them dies.
+type advisoryLock struct {
+	conn *sql.Conn
+	key  int64
+}
+
+// Returns the advisory lock key used for a name.
+func AdvisoryLockKey(name string) int64 {
+	h := fnv.New64a()
+	h.Write([]byte("gopartman:" + name))
+	return int64(h.Sum64())
+}
+
+// Opens a connection of its own to hold advisory locks on.
+func (db DB) lockConn() (*sql.Conn, error) {
+	if db.DB == nil {
+		return nil, errors.New("not connected")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), lockTimeout)
+	defer cancel()
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return nil, &SQLError{Op: "open a connection for advisory locks", Err: err}
+	}
+	return conn, nil
+}
+
+// Tries to take a session level advisory lock on the given connection. Returns false if something else holds it.
+func tryAdvisoryLock(conn *sql.Conn, key int64) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), lockTimeout)
+	defer cancel()
+	var locked bool
+	if err := conn.QueryRowContext(ctx, "SELECT pg_try_advisory_lock($1)", key).Scan(&locked); err != nil {
+		return false, &SQLError{Op: "pg_try_advisory_lock", Err: err}
+	}
+	return locked, nil
+}
+
+// Checks that the connection holding the lock is still alive (if it isn't, Postgres has released the lock).
+func (lk advisoryLock) held() bool {
+	ctx, cancel := context.WithTimeout(context.Background(), lockTimeout)
+	defer cancel()
+	return lk.conn.PingContext(ctx) == nil
+}
+
+// Releases the lock. Its connection is kept for the server's other locks.
+func (lk advisoryLock) release() {
+	ctx, cancel := context.WithTimeout(context.Background(), lockTimeout)
+	defer cancel()
+	lk.conn.ExecContext(ctx, "SELECT pg_advisory_unlock($1)", lk.key)
+}
+
+// Checks whether this process should run maintenance for a partition. Without coordination configured, it always should.
+// Otherwise this process must hold (or be able to take) the Postgres advisory lock for the partition's server or for the
+// partition itself, depending on Config.Coordination.Mode. Once taken, the lock is kept so other processes skip the
+// maintenance until this one stops or its connection is lost, at which point the next one to check takes over.
+// Nothing is sent to the database while locksMu is held, so a slow server doesn't hold up the checks for the others.
+func (m *Manager) IsLeader(serverName string, partitionName string) (bool, error) {
+	m.RLock()
+	mode := m.Config.Coordination.Mode
+	db, ok := m.Connections[serverName]
+	p, configured := db.Partitions[partitionName]
+	m.RUnlock()
+	if mode == "" {
+		return true, nil
+	}
+	if !ok {
+		return false, ErrServerNotConfigured
+	}
+	if !configured {
+		return false, ErrPartitionNotConfigured
+	}
+
+	var name string
+	switch mode {
+	case CoordinateServer:
+		// Servers configured with different names may be the same database, they still get a lock each
+		name = "server:" + serverName
+	case CoordinatePartition:
+		name = "partition:" + p.Table
+	default:
+		return false, fmt.Errorf("unknown coordination mode %s, it must be %s or %s", mode, CoordinateServer, CoordinatePartition)
+	}
+	key := lockName(serverName, name)
+
+	m.locksMu.Lock()
+	lk, holding := m.locks[key]
+	conn := m.lockConns[serverName]
+	m.locksMu.Unlock()
+	if holding {
+		if lk.held() {
+			return true, nil
+		}
+		m.dropLockConn(serverName, lk.conn)
+		m.Log.Error("Lost the connection holding the " + name + " lock on " + serverName)
+		conn = nil
+	}
+
+	if conn == nil {
+		opened, err := db.lockConn()
+		if err != nil {
+			return false, err
+		}
+		// Another check may have opened one in the meantime
+		m.locksMu.Lock()
+		if m.lockConns == nil {
+			m.lockConns = map[string]*sql.Conn{}
+		}
+		if conn = m.lockConns[serverName]; conn == nil {
+			conn = opened
+			m.lockConns[serverName] = conn
+		}
+		m.locksMu.Unlock()
+		if conn != opened {
+			opened.Close()
+		}
+	}
+
+	locked, err := tryAdvisoryLock(conn, AdvisoryLockKey(name))
+	if err != nil {
+		m.dropLockConn(serverName, conn)
+		return false, err
+	}
+	if !locked {
+		return false, nil
+	}
+	m.locksMu.Lock()
+	if m.locks == nil {
+		m.locks = map[string]advisoryLock{}
+	}
+	_, taken := m.locks[key]
+	if !taken {
+		m.locks[key] = advisoryLock{conn: conn, key: AdvisoryLockKey(name)}
+	}
+	m.locksMu.Unlock()
+	if taken {
+		// Another check took it on the same connection in the meantime, advisory locks count how many times they're taken
+		advisoryLock{conn: conn, key: AdvisoryLockKey(name)}.release()
+		return true, nil
+	}
+	m.Log.Info("Took the " + name + " lock on " + serverName + ", maintenance will run here")
+	return true, nil
+}
+
+func lockName(serverName string, name string) string {
+	return serverName + "/" + name
+}
+
+// The name of a partition's lock (in the CoordinatePartition mode).
+func partitionLockName(serverName string, p Partition) string {
+	return lockName(serverName, "partition:"+p.Table)
+}
+
+// Forgets the locks held on a server's lock connection (it's dead, so Postgres has released them) and closes it.
+func (m *Manager) dropLockConn(serverName string, conn *sql.Conn) {
+	m.locksMu.Lock()
+	for key, lk := range m.locks {
+		if lk.conn == conn {
+			delete(m.locks, key)
+		}
+	}
+	if m.lockConns[serverName] == conn {
+		delete(m.lockConns, serverName)
+	}
+	m.locksMu.Unlock()
+	conn.Close()
+}
+
+// Releases an advisory lock, if it's held.
+func (m *Manager) releaseLock(key string) {
+	m.releaseMatching(func(k string) bool { return k == key })
+}
+
+// Releases the advisory locks whose names start with the prefix (all of them if it's empty).
+func (m *Manager) releaseLocks(prefix string) {
+	m.releaseMatching(func(k string) bool { return strings.HasPrefix(k, prefix) })
+}
+
+// Releases the advisory locks whose names match, then closes the lock connections no longer holding any.
+func (m *Manager) releaseMatching(match func(key string) bool) {
+	released := []advisoryLock{}
+	idle := []*sql.Conn{}
+	m.locksMu.Lock()
+	for key, lk := range m.locks {
+		if match(key) {
+			released = append(released, lk)
+			delete(m.locks, key)
+		}
+	}
+	for serverName, conn := range m.lockConns {
+		inUse := false
+		for _, lk := range m.locks {
+			inUse = inUse || lk.conn == conn
+		}
+		if !inUse {
+			idle = append(idle, conn)
+			delete(m.lockConns, serverName)
+		}
+	}
+	m.locksMu.Unlock()
+
+	for _, lk := range released {
+		lk.release()
+	}
+	for _, conn := range idle {
+		conn.Close()
+	}
+}
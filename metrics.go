@@ -0,0 +1,253 @@
+/**
+ * This file contains metrics in the Prometheus text format. Gauges describing each configured partition (its child tables, how many are
+ * premade ahead of the current time or id and rows stuck in the parent table) are read from the database when the metrics are written.
+ * Maintenance runs are counted (and timed) as they happen, by whatever runs them calling ObserveMaintenance().
+ */
+
+package gopartman
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The upper bounds (in seconds) of the maintenance duration histogram's buckets.
+var maintenanceBuckets = []float64{0.1, 0.5, 1, 5, 10, 30, 60, 300, 900, 1800, 3600}
+
+// Maintenance outcomes for one partition.
+type maintenanceStats struct {
+	runs     uint64
+	failures uint64
+	// How many runs took no longer than each of maintenanceBuckets
+	buckets     []uint64
+	seconds     float64
+	lastSuccess time.Time
+}
+
+// Maintenance outcomes, keyed by server and partition name.
+type maintenanceMetrics struct {
+	sync.Mutex
+	stats map[[2]string]*maintenanceStats
+}
+
+// Records a maintenance run of a configured partition for the metrics, how long it took and whether it failed.
+func (m *Manager) ObserveMaintenance(serverName string, partitionName string, took time.Duration, err error) {
+	m.maintenance.Lock()
+	defer m.maintenance.Unlock()
+	if m.maintenance.stats == nil {
+		m.maintenance.stats = map[[2]string]*maintenanceStats{}
+	}
+	key := [2]string{serverName, partitionName}
+	s, ok := m.maintenance.stats[key]
+	if !ok {
+		s = &maintenanceStats{buckets: make([]uint64, len(maintenanceBuckets))}
+		m.maintenance.stats[key] = s
+	}
+	s.runs++
+	if err != nil {
+		s.failures++
+	} else {
+		s.lastSuccess = time.Now()
+	}
+	s.seconds += took.Seconds()
+	for i, le := range maintenanceBuckets {
+		if took.Seconds() <= le {
+			s.buckets[i]++
+		}
+	}
+}
+
+// A metric and its samples, which Prometheus wants written together.
+type metricFamily struct {
+	name    string
+	kind    string
+	help    string
+	samples []string
+}
+
+// Metrics in the order they were first added.
+type metricSet struct {
+	families []*metricFamily
+	byName   map[string]*metricFamily
+}
+
+// Adds a sample to a metric. Labels are given as name, value pairs.
+func (s *metricSet) add(name string, kind string, help string, value float64, labels ...string) {
+	f, ok := s.byName[name]
+	if !ok {
+		f = &metricFamily{name: name, kind: kind, help: help}
+		s.byName[name] = f
+		s.families = append(s.families, f)
+	}
+	f.samples = append(f.samples, sampleName(name, labels)+" "+formatMetricValue(value))
+}
+
+// Adds a sample to a histogram, whose samples are named after it (name_bucket, name_sum and name_count).
+func (s *metricSet) addHistogram(name string, help string, sample string, value float64, labels ...string) {
+	f, ok := s.byName[name]
+	if !ok {
+		f = &metricFamily{name: name, kind: "histogram", help: help}
+		s.byName[name] = f
+		s.families = append(s.families, f)
+	}
+	f.samples = append(f.samples, sampleName(name+sample, labels)+" "+formatMetricValue(value))
+}
+
+func (s *metricSet) write(w io.Writer) error {
+	for _, f := range s.families {
+		if _, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n%s\n", f.name, f.help, f.name, f.kind, strings.Join(f.samples, "\n")); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func sampleName(name string, labels []string) string {
+	if len(labels) == 0 {
+		return name
+	}
+	pairs := make([]string, 0, len(labels)/2)
+	for i := 0; i+1 < len(labels); i += 2 {
+		v := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(labels[i+1])
+		pairs = append(pairs, labels[i]+`="`+v+`"`)
+	}
+	return name + "{" + strings.Join(pairs, ",") + "}"
+}
+
+func formatMetricValue(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// Writes the metrics for every configured partition, and the maintenance runs observed so far, in the Prometheus text format.
+// Partitions which can't be read are logged and have gopartman_partition_metrics_error set, the rest are still written.
+func (m *Manager) WriteMetrics(w io.Writer) error {
+	type partitionRef struct {
+		server, name string
+		db           DB
+		p            Partition
+	}
+	refs := []partitionRef{}
+	m.RLock()
+	for serverName, db := range m.Connections {
+		for name, p := range db.Partitions {
+			refs = append(refs, partitionRef{serverName, name, db, p})
+		}
+	}
+	m.RUnlock()
+	sort.Slice(refs, func(i, j int) bool {
+		if refs[i].server != refs[j].server {
+			return refs[i].server < refs[j].server
+		}
+		return refs[i].name < refs[j].name
+	})
+
+	s := &metricSet{byName: map[string]*metricFamily{}}
+	// Rows in pg_partman parent tables, read once for each server
+	parents := map[string]map[string]int{}
+	for _, ref := range refs {
+		err := ref.db.partitionMetrics(s, ref.server, ref.name, &ref.p, parents)
+		if err != nil {
+			m.Log.Error("Couldn't read the metrics for " + ref.name + " on " + ref.server + ": " + err.Error())
+		}
+		failed := 0.0
+		if err != nil {
+			failed = 1
+		}
+		s.add("gopartman_partition_metrics_error", "gauge", "Whether the metrics of the partition couldn't be read from the database.", failed,
+			"server", ref.server, "partition", ref.name)
+	}
+
+	m.maintenance.Lock()
+	keys := make([][2]string, 0, len(m.maintenance.stats))
+	for key := range m.maintenance.stats {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i][0] != keys[j][0] {
+			return keys[i][0] < keys[j][0]
+		}
+		return keys[i][1] < keys[j][1]
+	})
+	const durationHelp = "How long maintenance runs of the partition took."
+	for _, key := range keys {
+		st := m.maintenance.stats[key]
+		labels := []string{"server", key[0], "partition", key[1]}
+		s.add("gopartman_maintenance_runs_total", "counter", "Maintenance runs of the partition.", float64(st.runs), labels...)
+		s.add("gopartman_maintenance_failures_total", "counter", "Maintenance runs of the partition which failed.", float64(st.failures), labels...)
+		if !st.lastSuccess.IsZero() {
+			s.add("gopartman_maintenance_last_success_timestamp_seconds", "gauge", "When maintenance of the partition last succeeded.",
+				float64(st.lastSuccess.Unix()), labels...)
+		}
+		for i, le := range maintenanceBuckets {
+			s.addHistogram("gopartman_maintenance_duration_seconds", durationHelp, "_bucket", float64(st.buckets[i]), append(labels, "le", formatMetricValue(le))...)
+		}
+		s.addHistogram("gopartman_maintenance_duration_seconds", durationHelp, "_bucket", float64(st.runs), append(labels, "le", "+Inf")...)
+		s.addHistogram("gopartman_maintenance_duration_seconds", durationHelp, "_sum", st.seconds, labels...)
+		s.addHistogram("gopartman_maintenance_duration_seconds", durationHelp, "_count", float64(st.runs), labels...)
+	}
+	m.maintenance.Unlock()
+
+	return s.write(w)
+}
+
+// Adds the gauges for a partition: its child tables (with their rows and size), how many are premade and rows in the parent table.
+func (db DB) partitionMetrics(s *metricSet, serverName string, name string, p *Partition, parents map[string]map[string]int) error {
+	labels := []string{"server", serverName, "partition", name}
+	children, err := db.GetChildPartitions(p)
+	if err != nil {
+		return err
+	}
+	s.add("gopartman_child_tables", "gauge", "Child tables of the partition.", float64(len(children)), labels...)
+	for _, child := range children {
+		childLabels := []string{"server", serverName, "partition", name, "child", child.Table}
+		s.add("gopartman_child_rows", "gauge", "Rows in a child table of the partition, estimated from Postgres' statistics.", float64(child.Records), childLabels...)
+		s.add("gopartman_child_bytes", "gauge", "Size of a child table of the partition on disk (with its indexes and TOAST) in bytes.", float64(child.BytesOnDisk), childLabels...)
+		s.add("gopartman_child_heap_bytes", "gauge", "Size of a child table's heap (its rows, without indexes or TOAST) in bytes.", float64(child.HeapBytes), childLabels...)
+		s.add("gopartman_child_index_bytes", "gauge", "Size of a child table's indexes in bytes.", float64(child.IndexBytes), childLabels...)
+		s.add("gopartman_child_toast_bytes", "gauge", "Size of a child table's TOAST table (and its index) in bytes.", float64(child.ToastBytes), childLabels...)
+		if child.LastVacuum != nil {
+			s.add("gopartman_child_last_vacuum_timestamp_seconds", "gauge", "When a child table was last vacuumed (by hand or autovacuum).", float64(child.LastVacuum.Unix()), childLabels...)
+		}
+		if child.LastAnalyze != nil {
+			s.add("gopartman_child_last_analyze_timestamp_seconds", "gauge", "When a child table was last analyzed (by hand or autovacuum).", float64(child.LastAnalyze.Unix()), childLabels...)
+		}
+	}
+
+	// List and hash partitions don't run out of child tables
+	if p.Type != ListType && p.Type != HashType {
+		tables := make([]string, len(children))
+		for i, child := range children {
+			tables[i] = child.Table
+		}
+		h, err := db.checkHealth(p, tables)
+		if err != nil {
+			return err
+		}
+		s.add("gopartman_premade_child_tables", "gauge", "Child tables of the partition ahead of the current time (or id), ready for new rows.", float64(h.Premade), labels...)
+		s.add("gopartman_premake_runway", "gauge", "Child tables' worth of room the partition has left ahead of the current time (or id).", h.Runway, labels...)
+		s.add("gopartman_partition_health", "gauge", "The partition's premake health check: 0 ok, 1 warning, 2 critical.", float64(HealthLevel(h.Status)), labels...)
+	}
+
+	// Native parent tables can't hold rows, pg_partman's can when there's no child table for them
+	if !p.isNative() {
+		rows, ok := parents[serverName]
+		if !ok {
+			ps, err := db.CheckParent()
+			if err != nil {
+				return err
+			}
+			rows = map[string]int{}
+			for _, parent := range ps {
+				rows[parent.Table] = parent.Records
+			}
+			parents[serverName] = rows
+		}
+		s.add("gopartman_parent_rows", "gauge", "Rows in the partition's parent table rather than a child table.", float64(rows[p.Table]), labels...)
+	}
+	return nil
+}
@@ -0,0 +1,368 @@
+/**
+ * This file contains functions for partitions using Postgres' native (declarative) partitioning instead of pg_partman.
+ * The parent table must already be partitioned by range on the partition column (CREATE TABLE ... PARTITION BY RANGE).
+ * Child tables are created ahead of time with CREATE TABLE ... PARTITION OF and detached (or dropped) once they're
+ * past the retention period, using the same retention settings as pg_partman partitions.
+ */
+
+package gopartman
+
+import (
+	"database/sql"
+	"fmt"
+	"github.com/lib/pq"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The partition types for Postgres' native partitioning. By range of time or ids, by lists of values and by hash (see strategies.go).
+const (
+	NativeType = "native"
+	ListType   = "list"
+	HashType   = "hash"
+)
+
+// The PARTITION BY strategy the parent table of each native partition type must be created with.
+var nativeStrategies = map[string]string{NativeType: "RANGE", ListType: "LIST", HashType: "HASH"}
+
+// Checks whether a partition uses Postgres' native partitioning rather than pg_partman.
+func (p Partition) isNative() bool {
+	_, ok := nativeStrategies[p.Type]
+	return ok
+}
+
+// How many child tables are made ahead of the current one when Premake isn't set (the same as pg_partman).
+const defaultPremake = 4
+
+// The range each child table of a native partition covers. Time ranges are either a number of months or a fixed
+// duration (both aligned in UTC), otherwise it's a range of ids.
+type nativeInterval struct {
+	months int
+	every  time.Duration
+	id     int64
+	// The layout (see time.Format) of the suffix added to the parent table's name for each child
+	layout string
+}
+
+// The intervals pg_partman supports for time partitions, which native partitions support too.
+var namedNativeIntervals = map[string]nativeInterval{
+	"yearly":       {months: 12, layout: "2006"},
+	"quarterly":    {months: 3, layout: "2006_01"},
+	"monthly":      {months: 1, layout: "2006_01"},
+	"weekly":       {every: 7 * 24 * time.Hour, layout: "2006_01_02"},
+	"daily":        {every: 24 * time.Hour, layout: "2006_01_02"},
+	"hourly":       {every: time.Hour, layout: "2006_01_02_1500"},
+	"half-hour":    {every: 30 * time.Minute, layout: "2006_01_02_1504"},
+	"quarter-hour": {every: 15 * time.Minute, layout: "2006_01_02_1504"},
+}
+
+// Intervals in months or years, which don't have a fixed length.
+var monthsIntervalRegexp = regexp.MustCompile(`^(\d+)\s*(mon|mons|month|months|y|yr|yrs|year|years)$`)
+
+// Parses the interval of a native partition. Either one of the named time intervals, a Postgres interval (like "3 days") or a number of ids.
+func parseNativeInterval(interval string) (nativeInterval, error) {
+	if ni, ok := namedNativeIntervals[interval]; ok {
+		return ni, nil
+	}
+	if id, err := strconv.ParseInt(interval, 10, 64); err == nil {
+		if id < 1 {
+			return nativeInterval{}, fmt.Errorf("%w: interval must be a positive number for id ranges", ErrInvalidPartition)
+		}
+		return nativeInterval{id: id}, nil
+	}
+	if m := monthsIntervalRegexp.FindStringSubmatch(strings.ToLower(strings.TrimSpace(interval))); m != nil {
+		months, _ := strconv.Atoi(m[1])
+		if strings.HasPrefix(m[2], "y") {
+			months *= 12
+		}
+		if months < 1 {
+			return nativeInterval{}, fmt.Errorf("%w: %s is not a valid interval", ErrInvalidPartition, interval)
+		}
+		return nativeInterval{months: months, layout: "2006_01"}, nil
+	}
+
+	d, err := parseInterval(interval)
+	if err != nil {
+		return nativeInterval{}, fmt.Errorf("%w: %s", ErrInvalidPartition, err.Error())
+	}
+	if d < time.Second || d%time.Second != 0 {
+		return nativeInterval{}, fmt.Errorf("%w: interval must be a whole number of seconds", ErrInvalidPartition)
+	}
+	ni := nativeInterval{every: d, layout: "2006_01_02_150405"}
+	switch {
+	case d%(24*time.Hour) == 0:
+		ni.layout = "2006_01_02"
+	case d%time.Hour == 0:
+		ni.layout = "2006_01_02_1500"
+	case d%time.Minute == 0:
+		ni.layout = "2006_01_02_1504"
+	}
+	return ni, nil
+}
+
+// Returns the start of the time range t falls in.
+func (ni nativeInterval) start(t time.Time) time.Time {
+	t = t.UTC()
+	if ni.months > 0 {
+		month := t.Year()*12 + int(t.Month()) - 1
+		month -= month % ni.months
+		return time.Date(month/12, time.Month(month%12+1), 1, 0, 0, 0, 0, time.UTC)
+	}
+	return t.Truncate(ni.every)
+}
+
+// Returns the start of the time range after the one starting at t.
+func (ni nativeInterval) next(t time.Time) time.Time {
+	if ni.months > 0 {
+		return t.AddDate(0, ni.months, 0)
+	}
+	return t.Add(ni.every)
+}
+
+// A child table of a native partition and the range of values it holds.
+type nativeChild struct {
+	Table string
+	From  string
+	To    string
+}
+
+// Returns the child tables a native partition should have, from the one holding current values to premake ahead of it.
+func (db DB) nativeChildren(p *Partition, ni nativeInterval) ([]nativeChild, error) {
+	premake := p.Premake
+	if premake < 1 {
+		premake = defaultPremake
+	}
+	children := []nativeChild{}
+
+	if ni.id > 0 {
+		max, err := db.maxId(p.Table, p.Column)
+		if err != nil {
+			return nil, err
+		}
+		start := max - max%ni.id
+		for i := 0; i <= premake; i++ {
+			from := start + int64(i)*ni.id
+			children = append(children, nativeChild{
+				Table: p.Table + "_p" + strconv.FormatInt(from, 10),
+				From:  strconv.FormatInt(from, 10),
+				To:    strconv.FormatInt(from+ni.id, 10),
+			})
+		}
+		return children, nil
+	}
+
+	var now time.Time
+	if err := db.Get(&now, "SELECT now()"); err != nil {
+		return nil, &SQLError{Op: "get the current time", Err: err}
+	}
+	from := ni.start(now)
+	for i := 0; i <= premake; i++ {
+		to := ni.next(from)
+		children = append(children, nativeChild{
+			Table: p.Table + "_p" + from.Format(ni.layout),
+			From:  from.Format("2006-01-02 15:04:05-07"),
+			To:    to.Format("2006-01-02 15:04:05-07"),
+		})
+		from = to
+	}
+	return children, nil
+}
+
+// Checks that the parent table of a native partition exists and is partitioned on the partition column (by range, list or hash depending on its type).
+func (db DB) requireNativeParent(p *Partition) error {
+	keyDef, err := db.partitionKey(p.Table)
+	if err != nil {
+		return err
+	}
+	strategy := nativeStrategies[p.Type]
+	if keyDef != strategy+" ("+p.Column+")" && keyDef != strategy+" ("+pq.QuoteIdentifier(p.Column)+")" {
+		return fmt.Errorf("%w: %s must be created with PARTITION BY %s (%s)", ErrInvalidPartition, p.Table, strategy, p.Column)
+	}
+	return nil
+}
+
+// Returns how a table is partitioned, like "RANGE (created)", or an empty string if it isn't.
+func (db DB) partitionKey(table string) (string, error) {
+	var keyDef string
+	err := db.Get(&keyDef, "SELECT COALESCE(pg_get_partkeydef(oid), '') FROM pg_class WHERE oid = to_regclass($1)", table)
+	if err == sql.ErrNoRows {
+		return "", fmt.Errorf("%w for %s, the table does not exist", ErrNoPartitionSet, table)
+	}
+	if err != nil {
+		return "", &SQLError{Op: "read partition key", Table: table, Err: err}
+	}
+	return keyDef, nil
+}
+
+// Returns the names of the child tables attached to a native partition's parent table.
+func (db DB) nativeChildTables(table string) ([]string, error) {
+	tables := []string{}
+	err := db.Select(&tables, `SELECT n.nspname || '.' || c.relname FROM pg_inherits i
+		JOIN pg_class c ON c.oid = i.inhrelid JOIN pg_namespace n ON n.oid = c.relnamespace
+		WHERE i.inhparent = $1::regclass ORDER BY c.relname`, table)
+	if err != nil {
+		return nil, &SQLError{Op: "list child tables", Table: table, Err: err}
+	}
+	return tables, nil
+}
+
+// Creates the child tables for a native partition (the parent table must already be partitioned on the partition column).
+func (db DB) createNativeParent(p *Partition) error {
+	if err := db.requireNativeParent(p); err != nil {
+		return err
+	}
+	return db.nativeMaintenance(p)
+}
+
+// Returns the configured native partitions (of every strategy) on a server, sorted by parent table.
+// pg_partman's run_maintenance() doesn't know about these, so they're maintained one by one.
+func (db DB) nativePartitions() []Partition {
+	partitions := []Partition{}
+	for _, p := range db.Partitions {
+		if p.isNative() {
+			partitions = append(partitions, p)
+		}
+	}
+	sort.Slice(partitions, func(i, j int) bool { return partitions[i].Table < partitions[j].Table })
+	return partitions
+}
+
+// Creates any missing child tables, from the one holding current values to premake ahead of it, then detaches (or drops)
+// the child tables which are past the retention period.
+func (db DB) nativeMaintenance(p *Partition) error {
+	switch p.Type {
+	case ListType:
+		return db.listMaintenance(p)
+	case HashType:
+		return db.hashMaintenance(p)
+	}
+	ni, err := parseNativeInterval(p.Interval)
+	if err != nil {
+		return err
+	}
+	existing, err := db.nativeChildTables(p.Table)
+	if err != nil {
+		return err
+	}
+	children, err := db.nativeChildren(p, ni)
+	if err != nil {
+		return err
+	}
+	for _, child := range children {
+		if stringInSlice(child.Table, existing) {
+			continue
+		}
+		_, err := db.Exec("CREATE TABLE IF NOT EXISTS " + child.Table + " PARTITION OF " + p.Table + " FOR VALUES FROM ('" + child.From + "') TO ('" + child.To + "')")
+		if err != nil {
+			return &SQLError{Op: "create child table " + child.Table, Table: p.Table, Err: err}
+		}
+		db.Log.Info("Created child table " + child.Table + ".")
+	}
+
+	if p.Retention == "" {
+		return nil
+	}
+	expired, err := db.expiredNativeChildren(p, ni, existing)
+	if err != nil {
+		return err
+	}
+	for _, child := range expired {
+		if err := db.removeNativeChild(p, child); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Returns the child tables (made by gopartman) which only hold values older than the retention period.
+// For id ranges, the retention period is a number of ids below the current one.
+func (db DB) expiredNativeChildren(p *Partition, ni nativeInterval, tables []string) ([]string, error) {
+	expired := []string{}
+	prefix := p.Table + "_p"
+
+	if ni.id > 0 {
+		retention, err := strconv.ParseInt(p.Retention, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%w: retention must be a number of ids for id ranges", ErrInvalidPartition)
+		}
+		max, err := db.maxId(p.Table, p.Column)
+		if err != nil {
+			return nil, err
+		}
+		for _, table := range tables {
+			from, err := strconv.ParseInt(strings.TrimPrefix(table, prefix), 10, 64)
+			if err != nil || !strings.HasPrefix(table, prefix) {
+				continue
+			}
+			if from+ni.id <= max-retention {
+				expired = append(expired, table)
+			}
+		}
+		return expired, nil
+	}
+
+	var cutoff time.Time
+	if err := db.Get(&cutoff, "SELECT now() - $1::interval", p.Retention); err != nil {
+		return nil, &SQLError{Op: "get the retention cutoff", Table: p.Table, Err: err}
+	}
+	for _, table := range tables {
+		from, err := time.ParseInLocation(ni.layout, strings.TrimPrefix(table, prefix), time.UTC)
+		if err != nil || !strings.HasPrefix(table, prefix) {
+			continue
+		}
+		if !ni.next(from).After(cutoff) {
+			expired = append(expired, table)
+		}
+	}
+	return expired, nil
+}
+
+// Detaches a child table from its parent, then moves it to the retention schema, keeps it or drops it (depending on the retention options).
+func (db DB) removeNativeChild(p *Partition, table string) error {
+	if err := db.archiveChildren(p, []string{table}); err != nil {
+		return err
+	}
+	if _, err := db.Exec("ALTER TABLE " + p.Table + " DETACH PARTITION " + table); err != nil {
+		return &SQLError{Op: "detach child table " + table, Table: p.Table, Err: err}
+	}
+	switch {
+	case p.Options.RetentionSchema.Valid && p.Options.RetentionSchema.String != "":
+		if _, err := db.Exec("ALTER TABLE " + table + " SET SCHEMA " + pq.QuoteIdentifier(p.Options.RetentionSchema.String)); err != nil {
+			return &SQLError{Op: "move child table " + table, Table: p.Table, Err: err}
+		}
+		db.Log.Info("Detached child table " + table + " and moved it to the " + p.Options.RetentionSchema.String + " schema.")
+	case p.Options.RetentionKeepTable:
+		db.Log.Info("Detached child table " + table + ".")
+	default:
+		if _, err := db.Exec("DROP TABLE " + table); err != nil {
+			return &SQLError{Op: "drop child table " + table, Table: p.Table, Err: err}
+		}
+		db.Log.Info("Dropped child table " + table + ".")
+	}
+	return nil
+}
+
+// Returns what would be in partman.part_config for a native partition, which only has its configuration.
+func (db DB) nativePartitionInfo(p *Partition) (PartConfig, error) {
+	premake := p.Premake
+	if premake < 1 {
+		premake = defaultPremake
+	}
+	pc := PartConfig{
+		ParentTable:        p.Table,
+		Control:            p.Column,
+		Type:               p.Type,
+		PartInterval:       p.Interval,
+		Premake:            premake,
+		Retention:          p.Retention,
+		RetentionKeepTable: p.Options.RetentionKeepTable,
+		RetentionSchema:    p.Options.RetentionSchema.String,
+	}
+	if p.Type == HashType {
+		pc.PartInterval = "modulus " + strconv.Itoa(p.Modulus)
+	}
+	return pc, db.requireNativeParent(p)
+}
@@ -0,0 +1,92 @@
+package gopartman
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseNativeInterval(t *testing.T) {
+	tests := []struct {
+		interval string
+		want     nativeInterval
+		valid    bool
+	}{
+		{"daily", nativeInterval{every: 24 * time.Hour, layout: "2006_01_02"}, true},
+		{"hourly", nativeInterval{every: time.Hour, layout: "2006_01_02_1500"}, true},
+		{"quarterly", nativeInterval{months: 3, layout: "2006_01"}, true},
+		{"yearly", nativeInterval{months: 12, layout: "2006"}, true},
+		{"10000", nativeInterval{id: 10000}, true},
+		{"3 months", nativeInterval{months: 3, layout: "2006_01"}, true},
+		{"1 mon", nativeInterval{months: 1, layout: "2006_01"}, true},
+		{"2 years", nativeInterval{months: 24, layout: "2006_01"}, true},
+		{"3 days", nativeInterval{every: 3 * 24 * time.Hour, layout: "2006_01_02"}, true},
+		{"6 hours", nativeInterval{every: 6 * time.Hour, layout: "2006_01_02_1500"}, true},
+		{"90 minutes", nativeInterval{every: 90 * time.Minute, layout: "2006_01_02_1504"}, true},
+		{"00:00:45", nativeInterval{every: 45 * time.Second, layout: "2006_01_02_150405"}, true},
+		{"0", nativeInterval{}, false},
+		{"-100", nativeInterval{}, false},
+		{"0 months", nativeInterval{}, false},
+		{"500 ms", nativeInterval{}, false},
+		{"1.5 seconds", nativeInterval{}, false},
+		{"sometimes", nativeInterval{}, false},
+	}
+	for _, test := range tests {
+		got, err := parseNativeInterval(test.interval)
+		if !test.valid {
+			if !errors.Is(err, ErrInvalidPartition) {
+				t.Errorf("parseNativeInterval(%q) returned %v, want ErrInvalidPartition", test.interval, err)
+			}
+			continue
+		}
+		if err != nil || got != test.want {
+			t.Errorf("parseNativeInterval(%q) returned %+v, %v, want %+v", test.interval, got, err, test.want)
+		}
+	}
+}
+
+func TestNativeIntervalNext(t *testing.T) {
+	from := time.Date(2020, time.January, 31, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		interval string
+		want     time.Time
+	}{
+		{"daily", time.Date(2020, time.February, 1, 0, 0, 0, 0, time.UTC)},
+		{"weekly", time.Date(2020, time.February, 7, 0, 0, 0, 0, time.UTC)},
+		{"quarterly", time.Date(2020, time.May, 1, 0, 0, 0, 0, time.UTC)},
+		{"yearly", time.Date(2021, time.January, 31, 0, 0, 0, 0, time.UTC)},
+		{"12:00:00", time.Date(2020, time.January, 31, 12, 0, 0, 0, time.UTC)},
+	}
+	for _, test := range tests {
+		ni, err := parseNativeInterval(test.interval)
+		if err != nil {
+			t.Fatalf("parseNativeInterval(%q) returned %v", test.interval, err)
+		}
+		if got := ni.next(from); !got.Equal(test.want) {
+			t.Errorf("next(%v) for %s returned %v, want %v", from, test.interval, got, test.want)
+		}
+	}
+}
+
+func TestNativePartitions(t *testing.T) {
+	db := DB{Partitions: map[string]Partition{
+		"events":   {Table: "public.events", Type: NativeType, Interval: "daily"},
+		"orders":   {Table: "public.orders", Type: "id-static", Interval: "1000"},
+		"regions":  {Table: "public.regions", Type: ListType},
+		"sessions": {Table: "public.sessions", Type: HashType},
+		"posts":    {Table: "public.posts", Type: "time-static", Interval: "daily"},
+		"accounts": {Table: "public.accounts", Type: NativeType, Interval: "10000"},
+	}}
+	want := []string{"public.accounts", "public.events", "public.regions", "public.sessions"}
+	got := []string{}
+	for _, p := range db.nativePartitions() {
+		got = append(got, p.Table)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("nativePartitions() returned %v, want %v", got, want)
+	}
+	if got := (DB{}).nativePartitions(); len(got) != 0 {
+		t.Errorf("nativePartitions() without any partitions returned %v, want none", got)
+	}
+}
@@ -0,0 +1,191 @@
+/**
+ * This file contains the arguments partitions are created with.
+ * Every argument of partman.create_parent() can be set, either with the typed Partition fields
+ * or the functions.createParent map (which takes precedence, like the other functions' maps).
+ */
+
+package gopartman
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+	"gopkg.in/guregu/null.v2"
+)
+
+// The create_parent() arguments which can be set in the functions.createParent map.
+var createParentArgNames = []string{"constraintCols", "premake", "useRunMaintenance", "startPartition", "inheritFk", "jobmon", "debug"}
+
+// The formats a start partition can be given in for time partitions. pg_partman casts it to a timestamp.
+var startPartitionLayouts = []string{"2006-01-02", "2006-01-02 15:04", "2006-01-02 15:04:05", time.RFC3339}
+
+// Returns the create_parent() arguments from the partition's settings, with pg_partman's defaults for anything not set.
+func (p Partition) createParentArgs() map[string]interface{} {
+	args := map[string]interface{}{
+		"constraintCols":    null.String{},
+		"premake":           defaultPremake,
+		"useRunMaintenance": null.Bool{},
+		"startPartition":    null.String{},
+		"inheritFk":         true,
+		"jobmon":            true,
+		"debug":             p.Debug,
+	}
+	if len(p.ConstraintCols) > 0 {
+		args["constraintCols"] = p.ConstraintCols
+	}
+	if p.Premake > 0 {
+		args["premake"] = p.Premake
+	}
+	if p.UseRunMaintenance != nil {
+		args["useRunMaintenance"] = *p.UseRunMaintenance
+	}
+	if p.StartPartition != "" {
+		args["startPartition"] = p.StartPartition
+	}
+	if p.InheritFk != nil {
+		args["inheritFk"] = *p.InheritFk
+	}
+	if p.Options.Jobmon != nil {
+		args["jobmon"] = *p.Options.Jobmon
+	}
+	return args
+}
+
+// Checks the pg_partman only settings of a partition. Native partitions can't use them.
+func (p Partition) validateCreateParent() error {
+	if p.Premake < 0 {
+		return fmt.Errorf("%w: premake can't be negative", ErrInvalidPartition)
+	}
+	if p.isNative() {
+		if len(p.ConstraintCols) > 0 || p.StartPartition != "" || p.UseRunMaintenance != nil || p.InheritFk != nil || p.Debug || p.Options.Jobmon != nil || len(p.Options.Functions.CreateParent) > 0 {
+			return fmt.Errorf("%w: constraintCols, startPartition, useRunMaintenance, inheritFk, debug, jobmon and createParent only apply to pg_partman partitions", ErrInvalidPartition)
+		}
+		return nil
+	}
+	for k := range p.Options.Functions.CreateParent {
+		if !stringInSlice(k, createParentArgNames) {
+			return fmt.Errorf("%w: unknown createParent argument %s, it must be one of %s", ErrInvalidPartition, k, strings.Join(createParentArgNames, ", "))
+		}
+	}
+	if p.UseRunMaintenance != nil && !*p.UseRunMaintenance && p.SubPartition != nil {
+		return fmt.Errorf("%w: useRunMaintenance can't be false for sub-partitioned partitions", ErrInvalidPartition)
+	}
+	_, err := p.configuredCreateParentArgs()
+	return err
+}
+
+// Returns the create_parent() arguments the partition is configured with, checked and converted like CreateParent() does.
+func (p Partition) configuredCreateParentArgs() (map[string]interface{}, error) {
+	m := p.createParentArgs()
+	for k, v := range p.Options.Functions.CreateParent {
+		m[k] = v
+	}
+	if p.SubPartition != nil {
+		m["useRunMaintenance"] = true
+	}
+	return m, validateCreateParentArgs(p.Type, m)
+}
+
+// Checks create_parent() arguments (after they've been merged) and converts them to what the driver can send.
+// Values from the configuration file may be any type YAML or JSON decodes to.
+func validateCreateParentArgs(partitionType string, m map[string]interface{}) error {
+	switch cols := m["constraintCols"].(type) {
+	case []string:
+		if err := validateConstraintCols(cols); err != nil {
+			return err
+		}
+		m["constraintCols"] = pq.Array(cols)
+	case []interface{}:
+		strs := make([]string, 0, len(cols))
+		for _, c := range cols {
+			s, ok := c.(string)
+			if !ok {
+				return fmt.Errorf("%w: constraintCols must be a list of column names", ErrInvalidPartition)
+			}
+			strs = append(strs, s)
+		}
+		if err := validateConstraintCols(strs); err != nil {
+			return err
+		}
+		m["constraintCols"] = pq.Array(strs)
+	case driver.Valuer, nil:
+	default:
+		return fmt.Errorf("%w: constraintCols must be a list of column names", ErrInvalidPartition)
+	}
+
+	switch premake := m["premake"].(type) {
+	case int:
+		if premake < 1 {
+			return fmt.Errorf("%w: premake must be at least 1", ErrInvalidPartition)
+		}
+	case float64:
+		// JSON numbers
+		if premake < 1 || premake != float64(int(premake)) {
+			return fmt.Errorf("%w: premake must be a whole number of at least 1", ErrInvalidPartition)
+		}
+		m["premake"] = int(premake)
+	default:
+		return fmt.Errorf("%w: premake must be a number", ErrInvalidPartition)
+	}
+
+	for _, k := range []string{"useRunMaintenance", "inheritFk", "jobmon", "debug"} {
+		switch m[k].(type) {
+		case bool, null.Bool:
+		default:
+			return fmt.Errorf("%w: %s must be true or false", ErrInvalidPartition, k)
+		}
+	}
+	if b, ok := m["useRunMaintenance"].(bool); ok && !b && strings.HasPrefix(partitionType, "time-") {
+		return fmt.Errorf("%w: useRunMaintenance can't be false for time partitions", ErrInvalidPartition)
+	}
+
+	switch start := m["startPartition"].(type) {
+	case null.String:
+	case string:
+		return validateStartPartition(partitionType, start)
+	case int:
+		// An id written as a number, JSON numbers are float64
+		m["startPartition"] = strconv.Itoa(start)
+		return validateStartPartition(partitionType, m["startPartition"].(string))
+	case float64:
+		m["startPartition"] = strconv.FormatFloat(start, 'f', -1, 64)
+		return validateStartPartition(partitionType, m["startPartition"].(string))
+	default:
+		return fmt.Errorf("%w: startPartition must be a timestamp or an id", ErrInvalidPartition)
+	}
+	return nil
+}
+
+func validateConstraintCols(cols []string) error {
+	seen := map[string]bool{}
+	for _, c := range cols {
+		if c == "" {
+			return fmt.Errorf("%w: constraintCols can't have an empty column name", ErrInvalidPartition)
+		}
+		if seen[c] {
+			return fmt.Errorf("%w: constraintCols has %s more than once", ErrInvalidPartition, c)
+		}
+		seen[c] = true
+	}
+	return nil
+}
+
+// Checks a start partition is a timestamp for time partitions or a whole number for id partitions.
+func validateStartPartition(partitionType string, start string) error {
+	if strings.HasPrefix(partitionType, "id-") {
+		if _, err := strconv.ParseInt(start, 10, 64); err != nil {
+			return fmt.Errorf("%w: startPartition must be a whole number for id partitions", ErrInvalidPartition)
+		}
+		return nil
+	}
+	for _, layout := range startPartitionLayouts {
+		if _, err := time.Parse(layout, start); err == nil {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: startPartition must be a timestamp for time partitions, for example 2006-01-02 15:04:05", ErrInvalidPartition)
+}
@@ -0,0 +1,296 @@
+/**
+ * This file contains functions for changing which partitions are managed while running.
+ * Adding, updating, and removing partitions from the configuration (and the database).
+ */
+
+package gopartman
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The partition types pg_partman supports (see check_partition_type() in sql.go).
+// "native" partitions use Postgres' own declarative partitioning instead (see native.go).
+var partitionTypes = []string{"time-static", "time-dynamic", "time-custom", "id-static", "id-dynamic", NativeType, ListType, HashType}
+
+// The intervals pg_partman supports for time-static and time-dynamic partitions. time-custom partitions can use any Postgres interval.
+var timeIntervals = []string{"yearly", "quarterly", "monthly", "weekly", "daily", "hourly", "half-hour", "quarter-hour"}
+
+// Postgres identifiers in "schema.table" form (pg_partman requires the parent table to be schema qualified).
+var tableNameRegexp = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_$]*\.[A-Za-z_][A-Za-z0-9_$]*$`)
+
+// Checks that a partition has everything pg_partman needs to create it.
+func (p Partition) Validate() error {
+	if !tableNameRegexp.MatchString(p.Table) {
+		return fmt.Errorf("%w: table must be schema qualified, for example public.posts", ErrInvalidPartition)
+	}
+	if p.Column == "" {
+		return fmt.Errorf("%w: a column is required", ErrInvalidPartition)
+	}
+	if !stringInSlice(p.Type, partitionTypes) {
+		return fmt.Errorf("%w: type must be one of %s", ErrInvalidPartition, strings.Join(partitionTypes, ", "))
+	}
+	switch p.Type {
+	case "time-static", "time-dynamic":
+		if !stringInSlice(p.Interval, timeIntervals) {
+			return fmt.Errorf("%w: interval must be one of %s", ErrInvalidPartition, strings.Join(timeIntervals, ", "))
+		}
+	case "time-custom":
+		if p.Interval == "" {
+			return fmt.Errorf("%w: an interval is required", ErrInvalidPartition)
+		}
+	case "id-static", "id-dynamic":
+		if i, err := strconv.ParseInt(p.Interval, 10, 64); err != nil || i < 1 {
+			return fmt.Errorf("%w: interval must be a positive number for id partitions", ErrInvalidPartition)
+		}
+	case NativeType:
+		ni, err := parseNativeInterval(p.Interval)
+		if err != nil {
+			return err
+		}
+		if ni.id > 0 && p.Retention != "" {
+			if i, err := strconv.ParseInt(p.Retention, 10, 64); err != nil || i < 1 {
+				return fmt.Errorf("%w: retention must be a positive number of ids for id ranges", ErrInvalidPartition)
+			}
+		}
+	case ListType, HashType:
+		if err := p.validateStrategy(); err != nil {
+			return err
+		}
+	}
+	if err := p.validateCreateParent(); err != nil {
+		return err
+	}
+	if p.SubPartition != nil {
+		if p.isNative() {
+			return fmt.Errorf("%w: only pg_partman partitions can be sub-partitioned", ErrInvalidPartition)
+		}
+		if err := p.SubPartition.validate(); err != nil {
+			return err
+		}
+	}
+	// id partitions without a schedule get one from the database when they're scheduled (see DB.MaintenanceSchedule())
+	if p.Schedule != "" || !p.idBased() {
+		if _, err := p.MaintenanceSchedule(); err != nil {
+			return err
+		}
+	}
+	if p.Options.ArchiveDirectory != "" && (p.Type == ListType || p.Type == HashType) {
+		return fmt.Errorf("%w: list and hash partitions don't use retention, so they can't be archived", ErrInvalidPartition)
+	}
+	if p.PremakeWarning < 0 || p.PremakeCritical < 0 || (p.PremakeWarning > 0 && p.PremakeWarning < p.PremakeCritical) {
+		return fmt.Errorf("%w: premakeWarning and premakeCritical can't be negative, and premakeWarning can't be below premakeCritical", ErrInvalidPartition)
+	}
+	if p.Jitter != "" {
+		if d, err := time.ParseDuration(p.Jitter); err != nil || d < 0 {
+			return fmt.Errorf("%w: jitter must be a duration, for example 30s", ErrInvalidPartition)
+		}
+	}
+	return nil
+}
+
+func stringInSlice(s string, list []string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// Adds a partition to a connected server's configuration and creates it in the database.
+// The lock isn't held while the partition is created, the name is reserved instead.
+func (m *Manager) AddPartition(serverName string, partitionName string, p Partition) error {
+	if err := p.Validate(); err != nil {
+		return err
+	}
+	ref := PartitionRef{serverName, partitionName}
+	m.Lock()
+	db, ok := m.Connections[serverName]
+	if !ok {
+		m.Unlock()
+		return ErrServerNotConfigured
+	}
+	if _, ok := db.Partitions[partitionName]; ok {
+		m.Unlock()
+		return ErrPartitionConfigured
+	}
+	if !m.reserve(ref) {
+		m.Unlock()
+		return ErrPartitionBusy
+	}
+	m.Unlock()
+
+	err := db.CreateParent(&p)
+
+	m.Lock()
+	defer m.Unlock()
+	delete(m.pending, ref)
+	if err != nil {
+		return err
+	}
+	// The server may have been removed (or reconnected) by a reload in the meantime
+	if current, ok := m.Connections[serverName]; !ok || current.DB != db.DB {
+		return ErrServerNotConfigured
+	}
+	m.setPartition(serverName, partitionName, p)
+	return nil
+}
+
+// Reserves a configured (or about to be) partition while it's added, updated or removed, so the database work can be done without
+// the lock. Returns false if it's already reserved. The caller must hold the lock.
+func (m *Manager) reserve(ref PartitionRef) bool {
+	if m.pending == nil {
+		m.pending = map[PartitionRef]bool{}
+	}
+	if m.pending[ref] {
+		return false
+	}
+	m.pending[ref] = true
+	return true
+}
+
+// Sets a partition in the configuration for a connected server. The caller must hold the lock.
+func (m *Manager) setPartition(serverName string, partitionName string, p Partition) {
+	db := m.Connections[serverName]
+	// A server may have been configured without any partitions. The server's configuration and its connection share the same map.
+	if db.Partitions == nil {
+		db.Partitions = map[string]Partition{}
+		m.Connections[serverName] = db
+		server := m.Config.Servers[serverName]
+		server.Partitions = db.Partitions
+		m.Config.Servers[serverName] = server
+	}
+	db.Partitions[partitionName] = p
+}
+
+// Checks whether a change to a partition would require it to be undone and created again.
+func unsafeChange(current Partition, p Partition) bool {
+	return p.Table != current.Table || p.Column != current.Column || p.Type != current.Type || p.Interval != current.Interval ||
+		p.Modulus != current.Modulus || listsChanged(current.Lists, p.Lists) || !reflect.DeepEqual(p.SubPartition, current.SubPartition)
+}
+
+// Sets (or removes) the retention period on an existing partition set if it has changed.
+func (db DB) applyRetention(current Partition, p *Partition) error {
+	if p.Retention != "" {
+		return db.SetRetention(p)
+	} else if current.Retention != "" {
+		return db.RemoveRetention(p)
+	}
+	return nil
+}
+
+// Updates a configured partition. Only the retention settings (and options) can be changed on an existing partition set.
+// Like AddPartition(), the partition is reserved rather than the lock held while the retention is changed in the database.
+func (m *Manager) UpdatePartition(serverName string, partitionName string, p Partition) error {
+	if err := p.Validate(); err != nil {
+		return err
+	}
+	ref := PartitionRef{serverName, partitionName}
+	m.Lock()
+	db, ok := m.Connections[serverName]
+	if !ok {
+		m.Unlock()
+		return ErrServerNotConfigured
+	}
+	if m.pending[ref] {
+		m.Unlock()
+		return ErrPartitionBusy
+	}
+	current, ok := db.Partitions[partitionName]
+	if !ok {
+		m.Unlock()
+		return ErrPartitionNotConfigured
+	}
+	if unsafeChange(current, p) {
+		m.Unlock()
+		return ErrUnsafeChange
+	}
+	m.reserve(ref)
+	m.Unlock()
+
+	err := db.applyRetention(current, &p)
+
+	m.Lock()
+	defer m.Unlock()
+	delete(m.pending, ref)
+	if err != nil {
+		return err
+	}
+	// The server may have been removed (or reconnected) by a reload in the meantime
+	if latest, ok := m.Connections[serverName]; !ok || latest.DB != db.DB {
+		return ErrServerNotConfigured
+	}
+	if latest, ok := db.Partitions[partitionName]; ok {
+		p.MaintenanceJobId = latest.MaintenanceJobId
+	}
+	m.setPartition(serverName, partitionName, p)
+	return nil
+}
+
+// Undoes a partition (moving data from the child partition tables back to the parent) and removes it from the configuration.
+// Returns the number of rows moved to the parent. Native partitions can't be undone, their child tables are left as they are.
+// The lock isn't held while the partition is undone (which can take a long time). It's reserved instead and left out of the
+// configuration meanwhile, so scheduled maintenance skips it. If it can't be undone, it's put back.
+func (m *Manager) RemovePartition(serverName string, partitionName string, opts ...map[string]interface{}) (int64, error) {
+	ref := PartitionRef{serverName, partitionName}
+	m.Lock()
+	db, ok := m.Connections[serverName]
+	if !ok {
+		m.Unlock()
+		return 0, ErrServerNotConfigured
+	}
+	if m.pending[ref] {
+		m.Unlock()
+		return 0, ErrPartitionBusy
+	}
+	p, ok := db.Partitions[partitionName]
+	if !ok {
+		m.Unlock()
+		return 0, ErrPartitionNotConfigured
+	}
+	m.reserve(ref)
+	delete(db.Partitions, partitionName)
+	m.Unlock()
+
+	var rows int64
+	var err error
+	if !p.isNative() {
+		rows, err = db.UndoPartition(&p, opts...)
+	}
+
+	m.Lock()
+	defer m.Unlock()
+	delete(m.pending, ref)
+	if err != nil {
+		if current, ok := m.Connections[serverName]; ok && current.DB == db.DB {
+			m.setPartition(serverName, partitionName, p)
+		}
+		return rows, err
+	}
+	m.releaseLock(partitionLockName(serverName, p))
+	return rows, nil
+}
+
+// Records the id of the scheduled maintenance job for a configured partition.
+func (m *Manager) SetMaintenanceJobId(serverName string, partitionName string, id int64) error {
+	m.Lock()
+	defer m.Unlock()
+
+	db, ok := m.Connections[serverName]
+	if !ok {
+		return ErrServerNotConfigured
+	}
+	p, ok := db.Partitions[partitionName]
+	if !ok {
+		return ErrPartitionNotConfigured
+	}
+	p.MaintenanceJobId = id
+	db.Partitions[partitionName] = p
+	return nil
+}
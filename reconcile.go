@@ -0,0 +1,371 @@
+/**
+ * This file contains functions for finding where the database has drifted from the configuration and bringing it back in line.
+ * Settings pg_partman can change on an existing partition set (premake, retention and so on) are safe to change in place.
+ * The rest (column, type, interval, sub-partitioning) can only change by migrating the partition set.
+ */
+
+package gopartman
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/lib/pq"
+	"gopkg.in/guregu/null.v2"
+)
+
+// A setting which is different in the database than in a partition's configuration.
+type Drift struct {
+	Setting    string `json:"setting"`
+	Configured string `json:"configured"`
+	Current    string `json:"current"`
+	// Safe changes are made in place by Reconcile(), the rest need the partition set to be migrated
+	Safe bool `json:"safe"`
+	// Makes the change, set for safe changes only
+	apply func(db DB) error
+}
+
+// How the database differs from a partition's configuration.
+type PartitionPlan struct {
+	Table string `json:"table"`
+	// The partition set doesn't exist yet, so reconciling creates it
+	Create bool    `json:"create"`
+	Drift  []Drift `json:"drift"`
+}
+
+// Checks whether the database matches the configuration.
+func (pl PartitionPlan) InSync() bool {
+	return !pl.Create && len(pl.Drift) == 0
+}
+
+// Returns the changes which can't be made in place.
+func (pl PartitionPlan) Unsafe() []Drift {
+	unsafe := []Drift{}
+	for _, d := range pl.Drift {
+		if !d.Safe {
+			unsafe = append(unsafe, d)
+		}
+	}
+	return unsafe
+}
+
+// Records a difference, which is safe to change if there's a way to apply it.
+func (pl *PartitionPlan) add(setting string, configured string, current string, apply func(db DB) error) {
+	pl.Drift = append(pl.Drift, Drift{Setting: setting, Configured: configured, Current: current, Safe: apply != nil, apply: apply})
+}
+
+// The Postgres intervals pg_partman stores in partman.part_config for each of its named intervals.
+var partmanIntervals = map[string]string{
+	"yearly":       "1 year",
+	"quarterly":    "3 months",
+	"monthly":      "1 month",
+	"weekly":       "1 week",
+	"daily":        "1 day",
+	"hourly":       "1 hour",
+	"half-hour":    "30 mins",
+	"quarter-hour": "15 mins",
+}
+
+// Checks whether an interval (or retention period) from the configuration is the same as one stored by pg_partman.
+// Time intervals are compared by length, since Postgres doesn't store them the way they were written ("1 week" is "7 days").
+func sameInterval(partitionType string, configured string, current string) bool {
+	if configured == current {
+		return true
+	}
+	if configured == "" || current == "" {
+		return false
+	}
+	if strings.HasPrefix(partitionType, "id-") {
+		a, errA := strconv.ParseInt(configured, 10, 64)
+		b, errB := strconv.ParseInt(current, 10, 64)
+		return errA == nil && errB == nil && a == b
+	}
+	if i, ok := partmanIntervals[configured]; ok {
+		configured = i
+	}
+	a, errA := parseInterval(configured)
+	b, errB := parseInterval(current)
+	return errA == nil && errB == nil && a == b
+}
+
+// Shows a create_parent() or set retention argument the way it's stored.
+func argString(v interface{}) string {
+	switch v := v.(type) {
+	case null.String:
+		return v.String
+	case null.Bool:
+		if !v.Valid {
+			return ""
+		}
+		return strconv.FormatBool(v.Bool)
+	case *pq.StringArray:
+		return strings.Join(*v, ",")
+	case nil:
+		return ""
+	}
+	return fmt.Sprint(v)
+}
+
+// Returns a change which sets a column of a partition set's partman.part_config record.
+func setPartConfig(table string, column string, value interface{}) func(db DB) error {
+	return func(db DB) error {
+		if _, err := db.Exec("UPDATE partman.part_config SET "+column+" = $2 WHERE parent_table = $1", table, value); err != nil {
+			return &SQLError{Op: "update partman.part_config " + column, Table: table, Err: err}
+		}
+		return nil
+	}
+}
+
+// Returns a change which sets a column for a level of sub-partitioning. Both the partman.part_config_sub records of the level
+// above (used for new child tables) and the partman.part_config records of the level's existing sub-parents are changed.
+func setSubPartConfig(table string, depth int, subColumn string, column string, value interface{}) func(db DB) error {
+	return func(db DB) error {
+		_, err := db.Exec(partitionTreeSQL+`, levels AS (
+				SELECT $1::text AS name, 0 AS depth UNION ALL SELECT t.name, t.depth FROM tables t
+			)
+			UPDATE partman.part_config_sub SET `+subColumn+` = $3 WHERE sub_parent IN (SELECT name FROM levels WHERE depth = $2)`, table, depth, value)
+		if err != nil {
+			return &SQLError{Op: "update partman.part_config_sub " + subColumn, Table: table, Err: err}
+		}
+		_, err = db.Exec(partitionTreeSQL+` UPDATE partman.part_config SET `+column+` = $3
+			WHERE parent_table IN (SELECT name FROM tables WHERE depth = $2)`, table, depth+1, value)
+		if err != nil {
+			return &SQLError{Op: "update partman.part_config " + column, Table: table, Err: err}
+		}
+		return nil
+	}
+}
+
+// Compares a partition's configuration with its partition set in the database. Nothing is changed.
+func (db DB) Plan(p *Partition) (PartitionPlan, error) {
+	plan := PartitionPlan{Table: p.Table}
+	if err := p.Validate(); err != nil {
+		return plan, err
+	}
+	if p.isNative() {
+		return plan, db.planNative(p, &plan)
+	}
+	exists, err := db.partitionSetExists(p.Table)
+	if err != nil {
+		return plan, err
+	}
+	if !exists {
+		plan.Create = true
+		return plan, nil
+	}
+	pc, err := db.partConfig(p.Table)
+	if err != nil {
+		return plan, err
+	}
+
+	if p.Column != pc.Control {
+		plan.add("column", p.Column, pc.Control, nil)
+	}
+	if p.Type != pc.Type {
+		plan.add("type", p.Type, pc.Type, nil)
+	}
+	if !sameInterval(p.Type, p.Interval, pc.PartInterval) {
+		plan.add("interval", p.Interval, pc.PartInterval, nil)
+	}
+
+	args, err := p.configuredCreateParentArgs()
+	if err != nil {
+		return plan, err
+	}
+	if premake := args["premake"].(int); premake != pc.Premake {
+		plan.add("premake", strconv.Itoa(premake), strconv.Itoa(pc.Premake), setPartConfig(p.Table, "premake", premake))
+	}
+	if cols := argString(args["constraintCols"]); cols != pc.ConstraintCols {
+		value := args["constraintCols"]
+		if cols == "" {
+			value = nil
+		}
+		plan.add("constraintCols", cols, pc.ConstraintCols, setPartConfig(p.Table, "constraint_cols", value))
+	}
+	// Not set means pg_partman's default, which depends on the type (see create_parent())
+	if b, ok := args["useRunMaintenance"].(bool); ok && b != pc.UseRunMaintenance {
+		plan.add("useRunMaintenance", strconv.FormatBool(b), strconv.FormatBool(pc.UseRunMaintenance), setPartConfig(p.Table, "use_run_maintenance", b))
+	}
+	if b, ok := args["inheritFk"].(bool); ok && b != pc.InheritFk {
+		plan.add("inheritFk", strconv.FormatBool(b), strconv.FormatBool(pc.InheritFk), setPartConfig(p.Table, "inherit_fk", b))
+	}
+	if b, ok := args["jobmon"].(bool); ok && b != pc.Jobmon {
+		plan.add("jobmon", strconv.FormatBool(b), strconv.FormatBool(pc.Jobmon), setPartConfig(p.Table, "jobmon", b))
+	}
+
+	// Retention is set the same way SetRetention() sets it, all of its settings at once
+	current := Partition{Retention: pc.Retention}
+	retentionApplied := false
+	applyRetention := func(db DB) error {
+		if retentionApplied {
+			return nil
+		}
+		retentionApplied = true
+		return db.applyRetention(current, p)
+	}
+	// The retention period of a partition set being re-partitioned is only set when it's finished (see Repartition())
+	repartitioning, err := db.repartitioning(p.Table)
+	if err != nil {
+		return plan, err
+	}
+	if !repartitioning && !sameInterval(p.Type, p.Retention, pc.Retention) {
+		plan.add("retention", p.Retention, pc.Retention, applyRetention)
+	}
+	if !repartitioning && p.Retention != "" {
+		m := map[string]interface{}{"retentionSchema": p.Options.RetentionSchema, "retentionKeepTable": p.Options.RetentionKeepTable}
+		if err := mergeArgs(m, nil, p.Options.Functions.SetRetention, nil); err != nil {
+			return plan, err
+		}
+		if schema := argString(m["retentionSchema"]); schema != pc.RetentionSchema {
+			plan.add("retentionSchema", schema, pc.RetentionSchema, applyRetention)
+		}
+		if keep := argString(m["retentionKeepTable"]); keep != strconv.FormatBool(pc.RetentionKeepTable) {
+			plan.add("retentionKeepTable", keep, strconv.FormatBool(pc.RetentionKeepTable), applyRetention)
+		}
+	}
+
+	if err := db.planSubPartitions(p, &plan); err != nil {
+		return plan, err
+	}
+
+	// A healthy partition set has at least the child table for current values and the premade ones after it
+	var children int
+	if err := db.Get(&children, "SELECT COUNT(*) FROM partman.show_partitions($1)", p.Table); err != nil {
+		return plan, &SQLError{Op: "show_partitions", Table: p.Table, Err: err}
+	}
+	if want := pc.Premake + 1; children < want {
+		plan.add("children", "at least "+strconv.Itoa(want), strconv.Itoa(children), func(db DB) error { return db.RunMaintenance(p) })
+	}
+	return plan, nil
+}
+
+// Compares each configured level of sub-partitioning with partman.part_config_sub.
+func (db DB) planSubPartitions(p *Partition, plan *PartitionPlan) error {
+	subs, err := db.SubPartitionInfo(p)
+	if err != nil {
+		return err
+	}
+	configured := 0
+	for s := p.SubPartition; s != nil; s = s.SubPartition {
+		configured++
+	}
+	if configured != len(subs) {
+		plan.add("subPartition", strconv.Itoa(configured)+" levels", strconv.Itoa(len(subs))+" levels", nil)
+		return nil
+	}
+
+	setting := "subPartition"
+	s := p.SubPartition
+	for _, sub := range subs {
+		if s.Column != sub.SubControl {
+			plan.add(setting+".column", s.Column, sub.SubControl, nil)
+		}
+		if s.Type != sub.SubType {
+			plan.add(setting+".type", s.Type, sub.SubType, nil)
+		}
+		if !sameInterval(s.Type, s.Interval, sub.SubPartInterval) {
+			plan.add(setting+".interval", s.Interval, sub.SubPartInterval, nil)
+		}
+		premake := s.Premake
+		if premake < 1 {
+			premake = defaultPremake
+		}
+		if premake != sub.SubPremake {
+			plan.add(setting+".premake", strconv.Itoa(premake), strconv.Itoa(sub.SubPremake), setSubPartConfig(p.Table, sub.Depth, "sub_premake", "premake", premake))
+		}
+		if !sameInterval(s.Type, s.Retention, sub.SubRetention) {
+			plan.add(setting+".retention", s.Retention, sub.SubRetention, setSubPartConfig(p.Table, sub.Depth, "sub_retention", "retention", null.NewString(s.Retention, s.Retention != "")))
+		}
+		setting += ".subPartition"
+		s = s.SubPartition
+	}
+	return nil
+}
+
+// Compares a native partition's configuration with how its parent table is partitioned and which child tables it has.
+// Premake and retention are only in the configuration, so they never drift.
+func (db DB) planNative(p *Partition, plan *PartitionPlan) error {
+	if err := db.requireNativeParent(p); errors.Is(err, ErrInvalidPartition) {
+		keyDef, err := db.partitionKey(p.Table)
+		if err != nil {
+			return err
+		}
+		plan.add("partition key", nativeStrategies[p.Type]+" ("+p.Column+")", keyDef, nil)
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	expected := []string{}
+	switch p.Type {
+	case HashType:
+		for remainder := 0; remainder < p.Modulus; remainder++ {
+			expected = append(expected, p.Table+"_p"+strconv.Itoa(remainder))
+		}
+	case ListType:
+		expected = append(expected, p.Table+"_default")
+		for name := range p.Lists {
+			expected = append(expected, p.Table+"_p_"+name)
+		}
+	default:
+		ni, err := parseNativeInterval(p.Interval)
+		if err != nil {
+			return err
+		}
+		children, err := db.nativeChildren(p, ni)
+		if err != nil {
+			return err
+		}
+		for _, child := range children {
+			expected = append(expected, child.Table)
+		}
+	}
+
+	existing, err := db.nativeChildTables(p.Table)
+	if err != nil {
+		return err
+	}
+	missing := []string{}
+	for _, table := range expected {
+		if !stringInSlice(table, existing) {
+			missing = append(missing, table)
+		}
+	}
+	if len(missing) > 0 {
+		plan.add("children", strings.Join(missing, ", "), "missing", func(db DB) error { return db.nativeMaintenance(p) })
+	}
+	return nil
+}
+
+// Brings the database in line with a partition's configuration. A partition set which doesn't exist is created and
+// safe changes are made in place. Returns the plan that was carried out, and ErrUnsafeChange if any changes couldn't be made.
+func (db DB) Reconcile(p *Partition) (PartitionPlan, error) {
+	plan, err := db.Plan(p)
+	if err != nil {
+		return plan, err
+	}
+	if plan.Create {
+		return plan, db.CreateParent(p)
+	}
+
+	for _, d := range plan.Drift {
+		if !d.Safe {
+			continue
+		}
+		if err := d.apply(db); err != nil {
+			return plan, err
+		}
+		db.Log.Info("Changed " + d.Setting + " of " + p.Table + " from " + strconv.Quote(d.Current) + " to " + strconv.Quote(d.Configured) + ".")
+	}
+
+	if unsafe := plan.Unsafe(); len(unsafe) > 0 {
+		settings := []string{}
+		for _, d := range unsafe {
+			settings = append(settings, d.Setting)
+		}
+		return plan, fmt.Errorf("%w (%s: %s)", ErrUnsafeChange, p.Table, strings.Join(settings, ", "))
+	}
+	return plan, nil
+}
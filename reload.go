@@ -0,0 +1,244 @@
+/**
+ * This file contains functions for reloading the configuration while running.
+ * Only what changed is touched; servers and partitions whose configuration is the same are left alone.
+ */
+
+package gopartman
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+)
+
+// A partition on a server.
+type PartitionRef struct {
+	Server    string `json:"server"`
+	Partition string `json:"partition"`
+}
+
+// The partitions which were added, updated, or removed (no longer managed) by a reload.
+// Partitions on a server whose connection settings changed are removed and then added again.
+type ConfigChanges struct {
+	Added   []PartitionRef `json:"added"`
+	Updated []PartitionRef `json:"updated"`
+	Removed []PartitionRef `json:"removed"`
+}
+
+// Replaces the running configuration with a new one. Servers which were removed (or whose connection settings changed)
+// are disconnected, new servers are connected, new partitions are created and changed retention settings are applied.
+// Partitions removed from the configuration are no longer managed, but they are not undone.
+// Changes which can't be made to an existing partition (see UpdatePartition) are logged and the current configuration
+// of that partition is kept. Returns the last error, after making every change it could.
+// Like AddPartition(), the lock isn't held while connecting or changing the database. The partitions (and new servers) being
+// changed are reserved instead and the changes are stored once they're made.
+func (m *Manager) Reload(cfg Config) (ConfigChanges, error) {
+	changes := ConfigChanges{}
+	var lastErr error
+	fail := func(err error) {
+		m.Log.Error(err)
+		lastErr = err
+	}
+
+	m.Lock()
+	if m.Config.Servers == nil {
+		m.Config.Servers = map[string]Server{}
+	}
+
+	// Disconnect from servers which were removed or need to be connected to again
+	for serverName, current := range m.Config.Servers {
+		if server, ok := cfg.Servers[serverName]; ok && sameConnection(current, server) {
+			continue
+		}
+		if db, ok := m.Connections[serverName]; ok {
+			for partitionName := range db.Partitions {
+				changes.Removed = append(changes.Removed, PartitionRef{serverName, partitionName})
+			}
+			m.releaseLocks(lockName(serverName, ""))
+			db.Close()
+			delete(m.Connections, serverName)
+		}
+		delete(m.Config.Servers, serverName)
+	}
+
+	// Work out what needs doing, reserving what's about to change
+	connects := map[string]Server{}
+	creates := map[PartitionRef]Partition{}
+	updates := map[PartitionRef]Partition{}
+	currents := map[PartitionRef]Partition{}
+	dbs := map[string]DB{}
+	for serverName, server := range cfg.Servers {
+		db, ok := m.Connections[serverName]
+		if !ok {
+			// A new server (or one that couldn't be connected to before), reserved as a whole while it's connected to
+			if !m.reserve(PartitionRef{Server: serverName}) {
+				fail(fmt.Errorf("%s: %w, the server is still being connected to by another reload", serverName, ErrPartitionBusy))
+				continue
+			}
+			m.Config.Servers[serverName] = server
+			connects[serverName] = server
+			continue
+		}
+		dbs[serverName] = db
+
+		for partitionName, current := range db.Partitions {
+			if _, ok := server.Partitions[partitionName]; !ok {
+				m.releaseLock(partitionLockName(serverName, current))
+				delete(db.Partitions, partitionName)
+				changes.Removed = append(changes.Removed, PartitionRef{serverName, partitionName})
+			}
+		}
+		for partitionName, p := range server.Partitions {
+			ref := PartitionRef{serverName, partitionName}
+			// Being changed through the API (or another reload), which will update the configuration when it's done
+			if m.pending[ref] {
+				fail(fmt.Errorf("%s: %w, it's left as it is", partitionName, ErrPartitionBusy))
+				continue
+			}
+			current, ok := db.Partitions[partitionName]
+			if !ok {
+				m.reserve(ref)
+				creates[ref] = p
+				continue
+			}
+
+			if samePartition(current, p) {
+				continue
+			}
+			err := p.Validate()
+			if err == nil && unsafeChange(current, p) {
+				err = ErrUnsafeChange
+			}
+			if err != nil {
+				fail(fmt.Errorf("%s: %w", partitionName, err))
+				continue
+			}
+			m.reserve(ref)
+			updates[ref] = p
+			currents[ref] = current
+		}
+	}
+
+	// The API port can't change without restarting, but the rest of its settings are read as requests come in
+	m.Config.Api = cfg.Api
+	if cfg.Coordination != m.Config.Coordination {
+		m.releaseLocks("")
+		m.Config.Coordination = cfg.Coordination
+	}
+	m.Unlock()
+
+	// Make the changes without the lock
+	connected := map[string]DB{}
+	for serverName, server := range connects {
+		db, err := m.dial(serverName, server)
+		if err != nil {
+			fail(err)
+		}
+		connected[serverName] = db
+	}
+	createErrs := map[PartitionRef]error{}
+	for ref, p := range creates {
+		if err := dbs[ref.Server].CreateParent(&p); err != nil && !errors.Is(err, ErrPartitionExists) {
+			fail(err)
+			createErrs[ref] = err
+		}
+		creates[ref] = p
+	}
+	updateErrs := map[PartitionRef]error{}
+	for ref, p := range updates {
+		if err := dbs[ref.Server].applyRetention(currents[ref], &p); err != nil {
+			fail(fmt.Errorf("%s: %w", ref.Partition, err))
+			updateErrs[ref] = err
+		}
+		updates[ref] = p
+	}
+
+	// Then store them, unless the server has been removed (or reconnected) by another reload in the meantime
+	m.Lock()
+	defer m.Unlock()
+	for serverName, db := range connected {
+		delete(m.pending, PartitionRef{Server: serverName})
+		current, configured := m.Config.Servers[serverName]
+		if _, ok := m.Connections[serverName]; ok || !configured || !sameConnection(current, connects[serverName]) {
+			if db.DB != nil {
+				db.Close()
+			}
+			continue
+		}
+		if db.DB == nil {
+			continue
+		}
+		m.Connections[serverName] = db
+		for partitionName := range db.Partitions {
+			changes.Added = append(changes.Added, PartitionRef{serverName, partitionName})
+		}
+	}
+	for ref, p := range creates {
+		delete(m.pending, ref)
+		if createErrs[ref] != nil || !m.stillConnected(ref.Server, dbs[ref.Server]) {
+			continue
+		}
+		m.setPartition(ref.Server, ref.Partition, p)
+		changes.Added = append(changes.Added, ref)
+	}
+	for ref, p := range updates {
+		delete(m.pending, ref)
+		if updateErrs[ref] != nil || !m.stillConnected(ref.Server, dbs[ref.Server]) {
+			continue
+		}
+		if latest, ok := m.Connections[ref.Server].Partitions[ref.Partition]; ok {
+			p.MaintenanceJobId = latest.MaintenanceJobId
+		}
+		m.setPartition(ref.Server, ref.Partition, p)
+		changes.Updated = append(changes.Updated, ref)
+	}
+	return changes, lastErr
+}
+
+// Checks whether a server is still connected with the same connection as before the lock was released. The caller must hold the lock.
+func (m *Manager) stillConnected(serverName string, db DB) bool {
+	current, ok := m.Connections[serverName]
+	return ok && current.DB == db.DB
+}
+
+// Reads the configuration file again and reloads it. See Reload().
+func (m *Manager) ReloadConfigFile() (ConfigChanges, error) {
+	m.RLock()
+	f := m.ConfigFile
+	m.RUnlock()
+	if f == nil {
+		return ConfigChanges{}, errors.New("the configuration was not loaded from a file")
+	}
+
+	read, cfg, err := OpenConfigFile(f.Path)
+	changes := ConfigChanges{}
+	if err == nil {
+		changes, err = m.Reload(cfg)
+	}
+
+	m.Lock()
+	defer m.Unlock()
+	if err != nil {
+		// What's running isn't what's in the file, so saving over it would lose the changes which weren't applied (it's a conflict
+		// until the file is fixed and reloaded). The file isn't reloaded again until it changes or SIGHUP is received.
+		if read != nil {
+			m.ConfigFile.seen = read.seen
+		}
+		return changes, err
+	}
+	// What's running now is what's in the file, so it can be saved over again
+	m.ConfigFile = read
+	return changes, nil
+}
+
+// Checks whether two server configurations connect to the same database in the same way.
+func sameConnection(a Server, b Server) bool {
+	return a.Database == b.Database && a.Host == b.Host && a.Port == b.Port && a.User == b.User && a.Password == b.Password
+}
+
+// Checks whether two partition configurations are the same, ignoring anything set while running.
+func samePartition(a Partition, b Partition) bool {
+	a.MaintenanceJobId = 0
+	b.MaintenanceJobId = 0
+	return reflect.DeepEqual(a, b)
+}
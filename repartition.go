@@ -0,0 +1,345 @@
+/**
+ * This file contains functions for re-partitioning, changing the column, type or interval of an existing pg_partman partition set
+ * without undoing it first. A new partition set is made beside the old child tables and rows are moved over in small batches, so nothing
+ * is locked for long, rows don't all go through the parent table and every row can be read through the parent table the whole time.
+ * Progress is kept in the database, so an interrupted repartition can be resumed.
+ */
+
+package gopartman
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Where repartitions in progress are recorded. It's created the first time one is started.
+const repartitionTableSQL = `CREATE TABLE IF NOT EXISTS partman.gopartman_repartition (
+	parent_table text PRIMARY KEY,
+	control text NOT NULL,
+	type text NOT NULL,
+	part_interval text NOT NULL,
+	remaining text[] NOT NULL,
+	rows_moved bigint NOT NULL DEFAULT 0,
+	started timestamptz NOT NULL DEFAULT now(),
+	updated timestamptz NOT NULL DEFAULT now()
+)`
+
+// The progress of a repartition. Column, Type and Interval are what the partition set is being changed to.
+type RepartitionProgress struct {
+	Table    string `json:"table" db:"parent_table"`
+	Column   string `json:"column" db:"control"`
+	Type     string `json:"type" db:"type"`
+	Interval string `json:"interval" db:"part_interval"`
+	// The old child tables which still have rows to be moved (renamed, but still inheriting from the parent table), newest first
+	Remaining pq.StringArray `json:"remaining" db:"remaining"`
+	// Rows moved so far, including by earlier runs of an interrupted repartition
+	Moved   int64     `json:"moved" db:"rows_moved"`
+	Started time.Time `json:"started" db:"started"`
+	Updated time.Time `json:"updated" db:"updated"`
+	Done    bool      `json:"done" db:"-"`
+}
+
+// Gets the progress of the repartition of a parent table, or ErrNoRepartition if there isn't one in progress.
+func (db DB) RepartitionStatus(table string) (RepartitionProgress, error) {
+	rp := RepartitionProgress{}
+	var exists bool
+	if err := db.Get(&exists, "SELECT to_regclass('partman.gopartman_repartition') IS NOT NULL"); err != nil {
+		return rp, &SQLError{Op: "read partman.gopartman_repartition", Table: table, Err: err}
+	}
+	if !exists {
+		return rp, fmt.Errorf("%w for %s", ErrNoRepartition, table)
+	}
+	err := db.Get(&rp, `SELECT parent_table, control, type, part_interval, remaining, rows_moved, started, updated
+		FROM partman.gopartman_repartition WHERE parent_table = $1`, table)
+	if err == sql.ErrNoRows {
+		return rp, fmt.Errorf("%w for %s", ErrNoRepartition, table)
+	}
+	if err != nil {
+		return rp, &SQLError{Op: "read partman.gopartman_repartition", Table: table, Err: err}
+	}
+	return rp, nil
+}
+
+// Checks whether a parent table is being re-partitioned.
+func (db DB) repartitioning(table string) (bool, error) {
+	_, err := db.RepartitionStatus(table)
+	if errors.Is(err, ErrNoRepartition) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// Changes an existing partition set to the column, type and interval of the given partition (the rest of its settings are applied too,
+// as they are by CreateParent()). In one transaction, the old child tables are renamed out of the way and the old trigger and
+// partman.part_config record are swapped for a new partition set's, so new rows go into the new child tables. The old child tables
+// still inherit from the parent table, so their rows can still be read through it while they're moved into the new partition set in
+// batches, newest first. Each old child table is dropped once it's empty. The retention period is only set once every row has been
+// moved, until then maintenance would take the old child tables for expired ones.
+//
+// Calling it again for a partition which is being re-partitioned resumes moving rows. progress (if not nil) is called after every batch.
+// Options are "batchSize" (rows moved per transaction, 10000 if not set) and "lockWait" (seconds to wait for locks, 0 waits forever).
+func (db DB) Repartition(p *Partition, progress func(RepartitionProgress), opts ...map[string]interface{}) (RepartitionProgress, error) {
+	if err := p.Validate(); err != nil {
+		return RepartitionProgress{}, err
+	}
+	if p.isNative() {
+		return RepartitionProgress{}, fmt.Errorf("repartition on %s: %w", p.Table, ErrNotSupported)
+	}
+	if p.SubPartition != nil {
+		return RepartitionProgress{}, fmt.Errorf("%w: sub-partitioned partition sets can't be re-partitioned", ErrInvalidPartition)
+	}
+	m := map[string]interface{}{}
+	if err := mergeArgs(m, opts, nil, map[string]interface{}{"batchSize": 10000, "lockWait": 0}); err != nil {
+		return RepartitionProgress{}, err
+	}
+	batchSize, err := intArg(m["batchSize"])
+	if err != nil || batchSize < 1 {
+		return RepartitionProgress{}, fmt.Errorf("%w: batchSize must be a positive number", ErrInvalidPartition)
+	}
+	lockWait, err := intArg(m["lockWait"])
+	if err != nil || lockWait < 0 {
+		return RepartitionProgress{}, fmt.Errorf("%w: lockWait must be a number of seconds", ErrInvalidPartition)
+	}
+
+	rp, err := db.RepartitionStatus(p.Table)
+	switch {
+	case err == nil:
+		if rp.Column != p.Column || rp.Type != p.Type || rp.Interval != p.Interval {
+			return rp, fmt.Errorf("%w: %s is being changed to a %s %s partition on %s", ErrRepartitionInProgress, p.Table, rp.Interval, rp.Type, rp.Column)
+		}
+		if db.DryRun != nil {
+			return rp, db.previewMoves(p, rp.Remaining, batchSize)
+		}
+		db.Log.Info("Resuming the repartition of " + p.Table + ".")
+	case errors.Is(err, ErrNoRepartition):
+		if err := db.requirePartitionSet(p); err != nil {
+			return rp, err
+		}
+		pc, err := db.partConfig(p.Table)
+		if err != nil {
+			return rp, err
+		}
+		if pc.Control == p.Column && pc.Type == p.Type && sameInterval(p.Type, p.Interval, pc.PartInterval) {
+			db.Log.Info(p.Table + " is already partitioned that way.")
+			return RepartitionProgress{Table: p.Table, Column: p.Column, Type: p.Type, Interval: p.Interval, Done: true}, nil
+		}
+		if rp, err = db.startRepartition(p, batchSize); err != nil || db.DryRun != nil {
+			return rp, err
+		}
+	default:
+		return rp, err
+	}
+
+	for len(rp.Remaining) > 0 {
+		child := rp.Remaining[0]
+		moved, err := db.moveRows(p, child, batchSize, lockWait)
+		rp.Moved += moved
+		rp.Updated = time.Now()
+		if err != nil {
+			return rp, err
+		}
+		if moved == 0 {
+			rp.Remaining = rp.Remaining[1:]
+		}
+		if progress != nil {
+			progress(rp)
+		}
+	}
+
+	if p.Retention != "" {
+		if err := db.setRetention(p); err != nil {
+			return rp, err
+		}
+	}
+	if _, err := db.Exec("DELETE FROM partman.gopartman_repartition WHERE parent_table = $1", p.Table); err != nil {
+		return rp, &SQLError{Op: "finish repartition", Table: p.Table, Err: err}
+	}
+	rp.Done = true
+	db.Log.Info(p.Table + " has been re-partitioned, " + strconv.FormatInt(rp.Moved, 10) + " rows were moved.")
+	return rp, nil
+}
+
+// Renames the old child tables of a partition set out of the way of the new child tables, swaps the old partition set's trigger and
+// partman.part_config record for a new one's and records the repartition, all in one transaction. The old child tables keep
+// inheriting from the parent table, so nothing disappears from it.
+func (db DB) startRepartition(p *Partition, batchSize int) (RepartitionProgress, error) {
+	rp := RepartitionProgress{}
+	// Created without the retention period, see Repartition()
+	newSet := *p
+	newSet.Retention = ""
+	createArgs, err := newSet.createParentCall(nil)
+	if err != nil {
+		return rp, err
+	}
+	if _, err := db.Exec(repartitionTableSQL); err != nil {
+		return rp, &SQLError{Op: "create partman.gopartman_repartition", Table: p.Table, Err: err}
+	}
+	children := []string{}
+	if err := db.Select(&children, "SELECT partman.show_partitions($1, 'DESC')", p.Table); err != nil {
+		return rp, &SQLError{Op: "show_partitions", Table: p.Table, Err: err}
+	}
+
+	// Stop rows going into the old child tables, the same way undo_partition() does
+	var trigger, function string
+	err = db.QueryRowx(`SELECT partman.check_name_length(p_object_name := tablename, p_suffix := '_part_trig'),
+		partman.check_name_length(tablename, schemaname, '_part_trig_func', FALSE)
+		FROM pg_tables WHERE schemaname || '.' || tablename = $1`, p.Table).Scan(&trigger, &function)
+	if err != nil {
+		return rp, &SQLError{Op: "find the partition trigger", Table: p.Table, Err: err}
+	}
+	// The names the old child tables are renamed to. show_partitions() lists every table inheriting from the parent table and sorts
+	// them by what follows the last "_p" in their names, taken as a time (in the new partition set's format) or an id. So they're
+	// named to sort before the new child tables: with no "_p" in a time partition set ('' is 1 BC) and a negative number in an id one.
+	format := "'gopartman_r' || c.oid"
+	if strings.HasPrefix(p.Type, "id-") {
+		format = "'gopartman_r' || c.oid || '_p-' || c.oid"
+	}
+	renamed := make([]string, len(children))
+	for i, child := range children {
+		err := db.QueryRowx(`SELECT n.nspname || '.' || `+format+` FROM pg_class c
+			JOIN pg_namespace n ON n.oid = c.relnamespace WHERE c.oid = $1::regclass`, child).Scan(&renamed[i])
+		if err != nil {
+			return rp, &SQLError{Op: "read child table " + child, Table: p.Table, Err: err}
+		}
+	}
+
+	tx, err := db.begin()
+	if err != nil {
+		return rp, &SQLError{Op: "begin", Table: p.Table, Err: err}
+	}
+	fail := func(op string, err error) (RepartitionProgress, error) {
+		tx.Rollback()
+		return rp, &SQLError{Op: op, Table: p.Table, Err: err}
+	}
+	if _, err := tx.Exec("DROP TRIGGER IF EXISTS " + trigger + " ON " + p.Table); err != nil {
+		return fail("drop the partition trigger", err)
+	}
+	if _, err := tx.Exec("DROP FUNCTION IF EXISTS " + function + "()"); err != nil {
+		return fail("drop the partition trigger function", err)
+	}
+	if _, err := tx.Exec("DELETE FROM partman.part_config WHERE parent_table = $1", p.Table); err != nil {
+		return fail("delete from partman.part_config", err)
+	}
+	for i, child := range children {
+		// RENAME TO takes the new name without a schema
+		if _, err := tx.Exec("ALTER TABLE " + child + " RENAME TO " + renamed[i][strings.Index(renamed[i], ".")+1:]); err != nil {
+			return fail("rename child table "+child, err)
+		}
+	}
+	if _, err := tx.NamedExec(createParentSQL, createArgs); err != nil {
+		return fail("create_parent", err)
+	}
+
+	_, err = tx.Exec(`INSERT INTO partman.gopartman_repartition (parent_table, control, type, part_interval, remaining) VALUES ($1, $2, $3, $4, $5)`,
+		p.Table, p.Column, p.Type, p.Interval, pq.Array(renamed))
+	if err != nil {
+		return fail("record repartition", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return rp, &SQLError{Op: "commit", Table: p.Table, Err: err}
+	}
+	// In dry-run mode nothing was recorded to read back, and the old child tables still have their names
+	if db.DryRun != nil {
+		now := time.Now()
+		rp = RepartitionProgress{Table: p.Table, Column: p.Column, Type: p.Type, Interval: p.Interval, Remaining: renamed, Started: now, Updated: now}
+		return rp, db.previewMoves(p, children, batchSize)
+	}
+	db.Log.Info("Started re-partitioning " + p.Table + ", " + strconv.Itoa(len(renamed)) + " old child tables have rows to be moved.")
+	return db.RepartitionStatus(p.Table)
+}
+
+// Previews moving the rows of the old child tables of a repartition into the new partition set.
+func (db DB) previewMoves(p *Partition, tables []string, batchSize int) error {
+	for _, table := range tables {
+		var rows int64
+		if err := db.Get(&rows, "SELECT COUNT(*) FROM ONLY "+table); err != nil {
+			return &SQLError{Op: "count records", Table: table, Err: err}
+		}
+		batches := (rows + int64(batchSize) - 1) / int64(batchSize)
+		db.DryRun.preview("repartition would move " + strconv.FormatInt(rows, 10) + " rows from " + table + " into " + p.Table + " (in " +
+			strconv.FormatInt(batches, 10) + " batches), then drop " + table)
+	}
+	return nil
+}
+
+// Moves a batch of rows from an old child table into the parent table, where the new partition set's trigger puts them in the
+// right child table, then has pg_partman move any which ended up in the parent (for child tables that didn't exist yet). The rows
+// are taken out and put back in one statement, so they're never missing from (or in twice) the parent table.
+// An old child table which is empty is dropped. Returns the number of rows moved.
+func (db DB) moveRows(p *Partition, child string, batchSize int, lockWait int) (int64, error) {
+	tx, err := db.begin()
+	if err != nil {
+		return 0, &SQLError{Op: "begin", Table: p.Table, Err: err}
+	}
+	fail := func(op string, err error) (int64, error) {
+		tx.Rollback()
+		return 0, &SQLError{Op: op, Table: p.Table, Err: err}
+	}
+	if lockWait > 0 {
+		if _, err := tx.Exec("SET LOCAL lock_timeout = " + strconv.Itoa(lockWait*1000)); err != nil {
+			return fail("set lock_timeout", err)
+		}
+	}
+
+	var moved int64
+	err = tx.Get(&moved, `WITH moved AS (
+			DELETE FROM `+child+` WHERE ctid = ANY(ARRAY(SELECT ctid FROM `+child+` LIMIT $1)) RETURNING *
+		), inserted AS (
+			INSERT INTO `+p.Table+` SELECT * FROM moved
+		)
+		SELECT COUNT(*) FROM moved`, batchSize)
+	if err != nil {
+		return fail("move rows from "+child, err)
+	}
+	if moved == 0 {
+		if _, err := tx.Exec("DROP TABLE " + child); err != nil {
+			return fail("drop child table "+child, err)
+		}
+		_, err = tx.Exec("UPDATE partman.gopartman_repartition SET remaining = array_remove(remaining, $2), updated = now() WHERE parent_table = $1", p.Table, child)
+	} else {
+		_, err = tx.Exec("UPDATE partman.gopartman_repartition SET rows_moved = rows_moved + $2, updated = now() WHERE parent_table = $1", p.Table, moved)
+	}
+	if err != nil {
+		return fail("record repartition progress", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, &SQLError{Op: "commit", Table: p.Table, Err: err}
+	}
+	if moved == 0 {
+		db.Log.Info("Dropped the old child table " + child + ", all of its rows have been moved.")
+		return 0, nil
+	}
+
+	for {
+		rows, err := db.PartitionData(p, map[string]interface{}{"lockWait": lockWait})
+		if err != nil {
+			return moved, err
+		}
+		if rows == 0 {
+			return moved, nil
+		}
+	}
+}
+
+// Reads a whole number from function arguments, which may have come from YAML or JSON.
+func intArg(v interface{}) (int, error) {
+	switch v := v.(type) {
+	case int:
+		return v, nil
+	case int64:
+		return int(v), nil
+	case float64:
+		if v == float64(int(v)) {
+			return int(v), nil
+		}
+	case string:
+		return strconv.Atoi(v)
+	}
+	return 0, fmt.Errorf("%v is not a whole number", v)
+}
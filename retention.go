@@ -0,0 +1,192 @@
+/**
+ * This file contains the retention report, which shows which child tables maintenance will remove under a partition's retention period
+ * (and when) before it happens. The range of each child table is worked out from its name, the same way maintenance does it.
+ */
+
+package gopartman
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// A child table in a retention report, with the range of values it holds and when it will be past the retention period.
+type RetentionChild struct {
+	ChildInfo
+	// When the child table is past the retention period (time partitions only)
+	Expires *time.Time `json:"expires,omitempty"`
+	// The highest id the partition set must reach for the child table to be past the retention period (id partitions only)
+	ExpiresAtId *int64 `json:"expiresAtId,omitempty"`
+}
+
+// Which child tables of a partition are past its retention period and which will be soon.
+type RetentionReport struct {
+	Table     string `json:"table"`
+	Retention string `json:"retention"`
+	// What maintenance does with expired child tables: "drop", "keep" (they're taken out of the partition set) or "move to <schema>"
+	Action string `json:"action"`
+	// When the report was made and how far ahead it looks, in the database's time
+	Now   time.Time `json:"now"`
+	Until time.Time `json:"until"`
+	// Child tables maintenance will remove the next time it runs
+	Expired []RetentionChild `json:"expired"`
+	// Child tables which will be past the retention period before Until (id partitions expire by id, so they never show up here)
+	Expiring []RetentionChild `json:"expiring"`
+}
+
+// Reports which child tables of a partition are past its retention period and which will be within the given number of days.
+// pg_partman partitions use the retention settings maintenance uses (in partman.part_config), native partitions use the configuration.
+func (db DB) RetentionReport(p *Partition, days int) (RetentionReport, error) {
+	report := RetentionReport{Table: p.Table, Expired: []RetentionChild{}, Expiring: []RetentionChild{}}
+	if days < 0 {
+		return report, fmt.Errorf("%w: days can't be negative", ErrInvalidPartition)
+	}
+	if p.Type == ListType || p.Type == HashType {
+		return report, fmt.Errorf("retention report on %s: %w", p.Table, ErrNotSupported)
+	}
+
+	var schema string
+	var keepTable bool
+	if p.isNative() {
+		report.Retention, keepTable, schema = p.Retention, p.Options.RetentionKeepTable, p.Options.RetentionSchema.String
+	} else {
+		if err := db.requirePartitionSet(p); err != nil {
+			return report, err
+		}
+		pc, err := db.partConfig(p.Table)
+		if err != nil {
+			return report, err
+		}
+		report.Retention, keepTable, schema = pc.Retention, pc.RetentionKeepTable, pc.RetentionSchema
+	}
+	if report.Retention == "" {
+		return report, fmt.Errorf("%w for %s", ErrNoRetention, p.Table)
+	}
+	switch {
+	case schema != "":
+		report.Action = "move to " + schema
+	case keepTable:
+		report.Action = "keep"
+	default:
+		report.Action = "drop"
+	}
+
+	bounds, err := db.childRanges(p)
+	if err != nil {
+		return report, err
+	}
+	if report.Now, err = db.partitionNow(p); err != nil {
+		return report, err
+	}
+	report.Until = report.Now.AddDate(0, 0, days)
+
+	children, err := db.GetChildPartitions(p)
+	if err != nil {
+		return report, err
+	}
+	isId := p.idBased()
+	var max, keep int64
+	if isId {
+		if keep, err = strconv.ParseInt(report.Retention, 10, 64); err != nil {
+			return report, fmt.Errorf("%w: retention must be a number of ids for id partitions", ErrInvalidPartition)
+		}
+		if max, err = db.maxId(p.Table, p.Column); err != nil {
+			return report, err
+		}
+	}
+
+	for _, child := range children {
+		b, err := bounds(child.Table)
+		if err != nil {
+			// Not made by gopartman or pg_partman (or the default child table), so maintenance leaves it alone
+			continue
+		}
+		rc := RetentionChild{ChildInfo: child}
+		if isId {
+			at := b.ToId + keep
+			rc.ExpiresAtId = &at
+			if max >= at {
+				report.Expired = append(report.Expired, rc)
+			}
+			continue
+		}
+
+		var expires time.Time
+		if err := db.Get(&expires, "SELECT $1::timestamp + $2::interval", b.To.Format("2006-01-02 15:04:05"), report.Retention); err != nil {
+			return report, &SQLError{Op: "add the retention period", Table: child.Table, Err: err}
+		}
+		expires = wallClock(expires)
+		rc.Expires = &expires
+		switch {
+		case expires.Before(report.Now):
+			report.Expired = append(report.Expired, rc)
+		case expires.Before(report.Until):
+			report.Expiring = append(report.Expiring, rc)
+		}
+	}
+	return report, nil
+}
+
+// Returns a function which works out the range of values a child table of a (range) partition holds from its name.
+// pg_partman partitions are worked out from partman.part_config, native partitions from the configuration.
+func (db DB) childRanges(p *Partition) (func(child string) (childBounds, error), error) {
+	if p.isNative() {
+		ni, err := parseNativeInterval(p.Interval)
+		if err != nil {
+			return nil, err
+		}
+		return func(child string) (childBounds, error) { return nativeChildBounds(p.Table, ni, child) }, nil
+	}
+	pc, err := db.partConfig(p.Table)
+	if err != nil {
+		return nil, err
+	}
+	return func(child string) (childBounds, error) { return partmanChildBounds(pc, child) }, nil
+}
+
+// Returns the database's current time the way a partition's child tables are named: pg_partman uses the wall clock time,
+// native child tables are named in UTC.
+func (db DB) partitionNow(p *Partition) (time.Time, error) {
+	nowSQL := "SELECT localtimestamp"
+	if p.isNative() {
+		nowSQL = "SELECT now() AT TIME ZONE 'UTC'"
+	}
+	var now time.Time
+	if err := db.Get(&now, nowSQL); err != nil {
+		return now, &SQLError{Op: "get the current time", Err: err}
+	}
+	return wallClock(now), nil
+}
+
+// Works out the range of values a child table of a native partition holds from its name (see nativeChildren()).
+func nativeChildBounds(parent string, ni nativeInterval, child string) (childBounds, error) {
+	if !strings.HasPrefix(child, parent+"_p") {
+		return childBounds{}, fmt.Errorf("%s is not named like a child table of %s", child, parent)
+	}
+	suffix := strings.TrimPrefix(child, parent+"_p")
+	if ni.id > 0 {
+		from, err := strconv.ParseInt(suffix, 10, 64)
+		if err != nil {
+			return childBounds{}, fmt.Errorf("%s is not named like a child table of %s", child, parent)
+		}
+		return childBounds{FromId: from, ToId: from + ni.id}, nil
+	}
+	from, err := time.ParseInLocation(ni.layout, suffix, time.UTC)
+	if err != nil {
+		return childBounds{}, fmt.Errorf("%s is not named like a child table of %s", child, parent)
+	}
+	return childBounds{From: from, To: ni.next(from)}, nil
+}
+
+// Returns the highest value of a partition set's column (0 when there are no rows).
+func (db DB) maxId(table string, column string) (int64, error) {
+	var max int64
+	if err := db.Get(&max, "SELECT COALESCE(MAX("+pq.QuoteIdentifier(column)+"), 0) FROM "+table); err != nil {
+		return 0, &SQLError{Op: "get the current id", Table: table, Err: err}
+	}
+	return max, nil
+}
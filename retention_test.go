@@ -0,0 +1,59 @@
+package gopartman
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNativeChildBounds(t *testing.T) {
+	tests := []struct {
+		interval string
+		child    string
+		want     childBounds
+		valid    bool
+	}{
+		{
+			"daily", "public.events_p2020_02_28",
+			childBounds{From: time.Date(2020, time.February, 28, 0, 0, 0, 0, time.UTC), To: time.Date(2020, time.February, 29, 0, 0, 0, 0, time.UTC)},
+			true,
+		},
+		{
+			"monthly", "public.events_p2020_12",
+			childBounds{From: time.Date(2020, time.December, 1, 0, 0, 0, 0, time.UTC), To: time.Date(2021, time.January, 1, 0, 0, 0, 0, time.UTC)},
+			true,
+		},
+		{
+			"hourly", "public.events_p2020_01_01_2300",
+			childBounds{From: time.Date(2020, time.January, 1, 23, 0, 0, 0, time.UTC), To: time.Date(2020, time.January, 2, 0, 0, 0, 0, time.UTC)},
+			true,
+		},
+		{
+			"00:00:30", "public.events_p2020_01_01_000030",
+			childBounds{From: time.Date(2020, time.January, 1, 0, 0, 30, 0, time.UTC), To: time.Date(2020, time.January, 1, 0, 1, 0, 0, time.UTC)},
+			true,
+		},
+		{"1000", "public.events_p3000", childBounds{FromId: 3000, ToId: 4000}, true},
+		{"1000", "public.events_p_3000", childBounds{}, false},
+		{"1000", "public.events_default", childBounds{}, false},
+		{"1000", "public.other_p3000", childBounds{}, false},
+		{"daily", "public.events_p2020_01", childBounds{}, false},
+		{"daily", "public.events_p2020_02_30", childBounds{}, false},
+		{"monthly", "public.events_p2020_01_01", childBounds{}, false},
+	}
+	for _, test := range tests {
+		ni, err := parseNativeInterval(test.interval)
+		if err != nil {
+			t.Fatalf("parseNativeInterval(%q) returned %v", test.interval, err)
+		}
+		got, err := nativeChildBounds("public.events", ni, test.child)
+		if !test.valid {
+			if err == nil {
+				t.Errorf("nativeChildBounds(%s) for %s returned %+v, want an error", test.child, test.interval, got)
+			}
+			continue
+		}
+		if err != nil || !got.From.Equal(test.want.From) || !got.To.Equal(test.want.To) || got.FromId != test.want.FromId || got.ToId != test.want.ToId {
+			t.Errorf("nativeChildBounds(%s) for %s returned %+v, %v, want %+v", test.child, test.interval, got, err, test.want)
+		}
+	}
+}
@@ -0,0 +1,334 @@
+/**
+ * This file contains functions for working out when maintenance should run for a partition.
+ */
+
+package gopartman
+
+import (
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tmaiaroto/cron"
+)
+
+// The schedule maintenance runs on for each time interval when a partition doesn't configure one. Maintenance runs
+// several times per interval so that a missed (or failed) run doesn't leave new rows without a child table to go into.
+var defaultSchedules = map[string]string{
+	"quarter-hour": "@every 5m",
+	"half-hour":    "@every 10m",
+	"hourly":       "@every 20m",
+	"daily":        "@hourly",
+	"weekly":       "@daily",
+	"monthly":      "@daily",
+	"quarterly":    "@daily",
+	"yearly":       "@daily",
+}
+
+// How many times maintenance runs for each partition's worth of time (or ids) when the schedule is derived.
+const maintenanceRunsPerPartition = 4
+
+// Derived schedules are rounded down to one of these, so they don't change every time an id partition's growth rate does.
+var scheduleSteps = []time.Duration{
+	time.Minute, 5 * time.Minute, 10 * time.Minute, 15 * time.Minute, 30 * time.Minute,
+	time.Hour, 2 * time.Hour, 6 * time.Hour, 12 * time.Hour, 24 * time.Hour,
+}
+
+// How long samples of the highest id of an id partition are kept, the rate ids are used is measured over this long.
+const idRateWindow = 24 * time.Hour
+
+// The schedule of id partitions until ids have been sampled far enough apart to tell how fast they're used. It's worked out again
+// after every run, so this is only until the second run.
+const unknownRateSchedule = "@every 10m"
+
+// The highest id of a partition set at some point.
+type idSample struct {
+	at  time.Time
+	max int64
+}
+
+// Samples of the highest id of each id partition, keyed by parent table. Shared by every copy of a DB.
+type idSamples struct {
+	sync.Mutex
+	byTable map[string][]idSample
+}
+
+// Predefined schedules understood by the cron package.
+var scheduleDescriptors = []string{"@yearly", "@annually", "@monthly", "@weekly", "@daily", "@midnight", "@hourly"}
+
+// Returns the cron spec maintenance should run on for a partition. Either its configured schedule or one derived from its interval
+// (or the interval of a sub-partition, if that needs maintenance more often).
+// A schedule for id partitions depends on how fast ids are used up, so it can only be derived with DB.MaintenanceSchedule().
+func (p Partition) MaintenanceSchedule() (string, error) {
+	if p.Schedule != "" {
+		return p.Schedule, validateSchedule(p.Schedule)
+	}
+	spec, err := p.intervalSchedule()
+	if err != nil {
+		return "", err
+	}
+	return shorterSchedule(spec, p.SubPartition.maintenanceSchedule()), nil
+}
+
+// Returns the schedule derived from a partition's interval.
+func (p Partition) intervalSchedule() (string, error) {
+	switch p.Type {
+	case "time-static", "time-dynamic":
+		if spec, ok := defaultSchedules[p.Interval]; ok {
+			return spec, nil
+		}
+	case "time-custom":
+		d, err := parseInterval(p.Interval)
+		if err != nil {
+			return "", fmt.Errorf("%w: %s", ErrInvalidPartition, err.Error())
+		}
+		return scheduleEvery(d / maintenanceRunsPerPartition), nil
+	case ListType, HashType:
+		// Hash partitions only need their child tables created, list partitions look for new values
+		return "@hourly", nil
+	case NativeType:
+		if spec, ok := defaultSchedules[p.Interval]; ok {
+			return spec, nil
+		}
+		if !p.idBased() {
+			d, err := parseInterval(p.Interval)
+			if err != nil {
+				return "", fmt.Errorf("%w: %s", ErrInvalidPartition, err.Error())
+			}
+			return scheduleEvery(d / maintenanceRunsPerPartition), nil
+		}
+	}
+	if p.idBased() {
+		return "", fmt.Errorf("%w: the schedule for an id partition depends on how fast ids are used, use DB.MaintenanceSchedule()", ErrInvalidPartition)
+	}
+	return "", fmt.Errorf("%w: a schedule can't be derived from the %s interval, one must be configured", ErrInvalidPartition, p.Interval)
+}
+
+// Returns the cron spec maintenance should run on for a partition. For id partitions without a configured schedule, it's
+// derived from how fast the highest id grows (see idRate()) so that maintenance runs several times for each partition's worth
+// of ids and the premade partitions stay ahead of inserts.
+func (db DB) MaintenanceSchedule(p *Partition) (string, error) {
+	if p.Schedule != "" || !p.idBased() {
+		return p.MaintenanceSchedule()
+	}
+	interval, err := strconv.ParseInt(p.Interval, 10, 64)
+	if err != nil || interval < 1 {
+		return "", fmt.Errorf("%w: interval must be a positive number for id partitions", ErrInvalidPartition)
+	}
+	rate, known, err := db.idRate(p)
+	if err != nil {
+		return "", err
+	}
+	if !known {
+		return shorterSchedule(unknownRateSchedule, p.SubPartition.maintenanceSchedule()), nil
+	}
+	// Ids aren't being used, check regularly until they are
+	if rate <= 0 {
+		return "@hourly", nil
+	}
+	seconds := float64(interval) / rate / maintenanceRunsPerPartition
+	spec := scheduleEvery(scheduleSteps[len(scheduleSteps)-1])
+	if seconds < scheduleSteps[len(scheduleSteps)-1].Seconds() {
+		spec = scheduleEvery(time.Duration(seconds * float64(time.Second)))
+	}
+	return shorterSchedule(spec, p.SubPartition.maintenanceSchedule()), nil
+}
+
+// How often a derived schedule runs.
+func scheduleLength(spec string) time.Duration {
+	switch spec {
+	case "@hourly":
+		return time.Hour
+	case "@daily", "@midnight":
+		return 24 * time.Hour
+	case "@weekly":
+		return 7 * 24 * time.Hour
+	case "@monthly":
+		return 30 * 24 * time.Hour
+	}
+	if d, err := time.ParseDuration(strings.TrimPrefix(spec, "@every ")); err == nil {
+		return d
+	}
+	return 365 * 24 * time.Hour
+}
+
+// Returns whichever of two derived schedules runs more often (b may be empty).
+func shorterSchedule(a string, b string) string {
+	if b != "" && scheduleLength(b) < scheduleLength(a) {
+		return b
+	}
+	return a
+}
+
+// Checks whether a partition is partitioned by id rather than time.
+func (p Partition) idBased() bool {
+	if p.Type == NativeType {
+		_, err := strconv.ParseInt(p.Interval, 10, 64)
+		return err == nil
+	}
+	return strings.HasPrefix(p.Type, "id-")
+}
+
+// Samples the highest id of an id partition and returns how many ids per second it has grown by over the samples from the last
+// idRateWindow. Inserts which don't raise the highest id (like rows for old ids) don't count. The rate isn't known until there are
+// samples at least a minute apart.
+func (db DB) idRate(p *Partition) (float64, bool, error) {
+	max, err := db.maxId(p.Table, p.Column)
+	if err != nil || db.idSamples == nil {
+		return 0, false, err
+	}
+	db.idSamples.Lock()
+	defer db.idSamples.Unlock()
+	if db.idSamples.byTable == nil {
+		db.idSamples.byTable = map[string][]idSample{}
+	}
+	samples := addIdSample(db.idSamples.byTable[p.Table], idSample{time.Now(), max}, idRateWindow)
+	db.idSamples.byTable[p.Table] = samples
+	rate, known := idSampleRate(samples)
+	return rate, known, nil
+}
+
+// Adds a sample, dropping those older than the window (but always keeping the one before the newest, so there's a rate).
+func addIdSample(samples []idSample, s idSample, window time.Duration) []idSample {
+	samples = append(samples, s)
+	first := 0
+	for first < len(samples)-2 && s.at.Sub(samples[first].at) > window {
+		first++
+	}
+	return append([]idSample{}, samples[first:]...)
+}
+
+// Returns the ids per second used between the oldest and newest samples, if they're at least a minute apart.
+// The highest id going down (rows deleted) counts as not growing.
+func idSampleRate(samples []idSample) (float64, bool) {
+	if len(samples) < 2 {
+		return 0, false
+	}
+	first, last := samples[0], samples[len(samples)-1]
+	elapsed := last.at.Sub(first.at)
+	if elapsed < time.Minute {
+		return 0, false
+	}
+	if last.max <= first.max {
+		return 0, true
+	}
+	return float64(last.max-first.max) / elapsed.Seconds(), true
+}
+
+// Returns an "@every" schedule for the longest step that isn't longer than the given duration (and at least a minute).
+func scheduleEvery(d time.Duration) string {
+	every := scheduleSteps[0]
+	for _, step := range scheduleSteps {
+		if step <= d {
+			every = step
+		}
+	}
+	if every%time.Hour == 0 {
+		return fmt.Sprintf("@every %dh", every/time.Hour)
+	}
+	return fmt.Sprintf("@every %dm", every/time.Minute)
+}
+
+// The length of each Postgres interval unit. Months and years are approximate, which is close enough for scheduling.
+var intervalUnits = map[string]time.Duration{
+	"microsecond": time.Microsecond,
+	"us":          time.Microsecond,
+	"millisecond": time.Millisecond,
+	"ms":          time.Millisecond,
+	"second":      time.Second,
+	"sec":         time.Second,
+	"s":           time.Second,
+	"minute":      time.Minute,
+	"min":         time.Minute,
+	"m":           time.Minute,
+	"hour":        time.Hour,
+	"hr":          time.Hour,
+	"h":           time.Hour,
+	"day":         24 * time.Hour,
+	"d":           24 * time.Hour,
+	"week":        7 * 24 * time.Hour,
+	"w":           7 * 24 * time.Hour,
+	"month":       30 * 24 * time.Hour,
+	"mon":         30 * 24 * time.Hour,
+	"year":        365 * 24 * time.Hour,
+	"yr":          365 * 24 * time.Hour,
+	"y":           365 * 24 * time.Hour,
+	"decade":      10 * 365 * 24 * time.Hour,
+	"century":     100 * 365 * 24 * time.Hour,
+	"centurie":    100 * 365 * 24 * time.Hour,
+}
+
+// Parses a Postgres interval such as "3 days", "1 hour 30 minutes", "2 weeks" or "12:00:00" (as used by time-custom partitions).
+func parseInterval(s string) (time.Duration, error) {
+	fields := strings.Fields(strings.ToLower(strings.TrimPrefix(strings.TrimSpace(s), "@")))
+	var total time.Duration
+	for i := 0; i < len(fields); i++ {
+		field := fields[i]
+		// hh:mm[:ss]
+		if strings.Contains(field, ":") {
+			parts := strings.Split(field, ":")
+			if len(parts) > 3 {
+				return 0, fmt.Errorf("%s is not a valid interval", s)
+			}
+			units := []time.Duration{time.Hour, time.Minute, time.Second}
+			for j, part := range parts {
+				n, err := strconv.ParseFloat(part, 64)
+				if err != nil {
+					return 0, fmt.Errorf("%s is not a valid interval", s)
+				}
+				total += time.Duration(n * float64(units[j]))
+			}
+			continue
+		}
+
+		// A number followed by a unit, either as one field ("3d") or two ("3 days")
+		number := strings.TrimRightFunc(field, func(r rune) bool { return r < '0' || r > '9' })
+		unit := field[len(number):]
+		if unit == "" && i+1 < len(fields) {
+			i++
+			unit = fields[i]
+		}
+		n, err := strconv.ParseFloat(number, 64)
+		if err != nil {
+			return 0, fmt.Errorf("%s is not a valid interval", s)
+		}
+		length, ok := intervalUnits[unit]
+		if !ok {
+			length, ok = intervalUnits[strings.TrimSuffix(unit, "s")]
+		}
+		if !ok {
+			return 0, fmt.Errorf("%s is not a valid interval, %s is not a known unit", s, unit)
+		}
+		total += time.Duration(n * float64(length))
+	}
+	if total <= 0 {
+		return 0, fmt.Errorf("%s is not a valid interval", s)
+	}
+	return total, nil
+}
+
+// Returns a random delay, up to the partition's configured jitter, to wait before running scheduled maintenance.
+// This keeps partitions on the same schedule from all running maintenance at the same moment.
+func (p Partition) MaintenanceDelay() time.Duration {
+	jitter, err := time.ParseDuration(p.Jitter)
+	if err != nil || jitter <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(jitter)))
+}
+
+// Checks that a schedule is something the cron package will accept, by parsing it the same way cron.AddFunc() does.
+func validateSchedule(spec string) error {
+	if strings.HasPrefix(spec, "@every ") {
+		if d, err := time.ParseDuration(strings.TrimPrefix(spec, "@every ")); err != nil || d <= 0 {
+			return fmt.Errorf("%w: schedule must be @every followed by a positive duration, for example @every 15m", ErrInvalidPartition)
+		}
+	}
+	if _, err := cron.Parse(spec); err != nil {
+		return fmt.Errorf("%w: schedule must be @every <duration>, one of %s or a cron expression (seconds minutes hours day-of-month month [day-of-week]): %s", ErrInvalidPartition, strings.Join(scheduleDescriptors, ", "), err.Error())
+	}
+	return nil
+}
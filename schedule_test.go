@@ -0,0 +1,163 @@
+package gopartman
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestValidateSchedule(t *testing.T) {
+	tests := []struct {
+		spec  string
+		valid bool
+	}{
+		{"@every 15m", true},
+		{"@every 1h30m", true},
+		{"@every 0s", false},
+		{"@every -5m", false},
+		{"@every soon", false},
+		{"@hourly", true},
+		{"@daily", true},
+		{"@midnight", true},
+		{"@fortnightly", false},
+		{"0 30 * * * *", true},
+		{"30 * * * *", true},
+		{"* * * *", false},
+		{"0 0 0 1 1 * *", false},
+		{"", false},
+		{"0 0 12 * * MON-FRI", true},
+		{"*/15 * * * *", true},
+		{"0 0 1,15 * ?", true},
+		{"a b c d e", false},
+		{"99 * * * * *", false},
+		{"0 60 * * *", false},
+		{"0 0 24 * * *", false},
+		{"0 0 0 0 * *", false},
+		{"0 0 0 * 13 *", false},
+		{"0 0 0 * * 7", false},
+		{"0 */0 * * *", false},
+		{"0 5-1 * * *", false},
+		{"0 0 0 * * NOPE", false},
+	}
+	for _, test := range tests {
+		err := validateSchedule(test.spec)
+		if test.valid && err != nil {
+			t.Errorf("validateSchedule(%q) returned %v, want no error", test.spec, err)
+		}
+		if !test.valid && !errors.Is(err, ErrInvalidPartition) {
+			t.Errorf("validateSchedule(%q) returned %v, want ErrInvalidPartition", test.spec, err)
+		}
+	}
+}
+
+func TestParseInterval(t *testing.T) {
+	tests := []struct {
+		interval string
+		want     time.Duration
+		valid    bool
+	}{
+		{"3 days", 3 * 24 * time.Hour, true},
+		{"1 day", 24 * time.Hour, true},
+		{"1 hour 30 minutes", 90 * time.Minute, true},
+		{"2 weeks", 14 * 24 * time.Hour, true},
+		{"1 mon", 30 * 24 * time.Hour, true},
+		{"3d", 3 * 24 * time.Hour, true},
+		{"1h 15m", 75 * time.Minute, true},
+		{"  6 HOURS ", 6 * time.Hour, true},
+		{"12:00:00", 12 * time.Hour, true},
+		{"01:30", 90 * time.Minute, true},
+		{"1 day 12:00:00", 36 * time.Hour, true},
+		{"1.5 hours", 90 * time.Minute, true},
+		{"@1 hour", time.Hour, true},
+		{"", 0, false},
+		{"0 days", 0, false},
+		{"3 fortnights", 0, false},
+		{"days", 0, false},
+		{"1:2:3:4", 0, false},
+		{"aa:00", 0, false},
+	}
+	for _, test := range tests {
+		got, err := parseInterval(test.interval)
+		if !test.valid {
+			if err == nil {
+				t.Errorf("parseInterval(%q) returned %v, want an error", test.interval, got)
+			}
+			continue
+		}
+		if err != nil || got != test.want {
+			t.Errorf("parseInterval(%q) returned %v, %v, want %v", test.interval, got, err, test.want)
+		}
+	}
+}
+
+func TestScheduleEvery(t *testing.T) {
+	tests := []struct {
+		d    time.Duration
+		want string
+	}{
+		{time.Second, "@every 1m"},
+		{time.Minute, "@every 1m"},
+		{7 * time.Minute, "@every 5m"},
+		{45 * time.Minute, "@every 30m"},
+		{90 * time.Minute, "@every 1h"},
+		{18 * time.Hour, "@every 12h"},
+		{30 * 24 * time.Hour, "@every 24h"},
+	}
+	for _, test := range tests {
+		if got := scheduleEvery(test.d); got != test.want {
+			t.Errorf("scheduleEvery(%v) returned %q, want %q", test.d, got, test.want)
+		}
+	}
+}
+
+func TestIdSampleRate(t *testing.T) {
+	start := time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name    string
+		samples []idSample
+		want    float64
+		known   bool
+	}{
+		{"no samples", nil, 0, false},
+		{"one sample", []idSample{{start, 100}}, 0, false},
+		{"too close together", []idSample{{start, 100}, {start.Add(30 * time.Second), 200}}, 0, false},
+		{"growing", []idSample{{start, 100}, {start.Add(time.Minute), 160}}, 1, true},
+		{"oldest to newest", []idSample{{start, 0}, {start.Add(time.Minute), 5000}, {start.Add(100 * time.Second), 200}}, 2, true},
+		{"not growing", []idSample{{start, 100}, {start.Add(time.Hour), 100}}, 0, true},
+		{"rows deleted", []idSample{{start, 100}, {start.Add(time.Hour), 50}}, 0, true},
+	}
+	for _, test := range tests {
+		got, known := idSampleRate(test.samples)
+		if got != test.want || known != test.known {
+			t.Errorf("%s: idSampleRate() returned %v, %v, want %v, %v", test.name, got, known, test.want, test.known)
+		}
+	}
+}
+
+func TestAddIdSample(t *testing.T) {
+	start := time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name    string
+		samples []idSample
+		add     time.Duration
+		// The times (after start) of the samples which should be kept
+		want []time.Duration
+	}{
+		{"first sample", nil, 0, []time.Duration{0}},
+		{"within the window", []idSample{{start, 1}, {start.Add(time.Hour), 2}}, 2 * time.Hour, []time.Duration{0, time.Hour, 2 * time.Hour}},
+		{"drops old samples", []idSample{{start, 1}, {start.Add(time.Hour), 2}, {start.Add(20 * time.Hour), 3}}, 26 * time.Hour, []time.Duration{20 * time.Hour, 26 * time.Hour}},
+		{"keeps the one before the newest", []idSample{{start, 1}, {start.Add(time.Hour), 2}}, 48 * time.Hour, []time.Duration{time.Hour, 48 * time.Hour}},
+	}
+	for _, test := range tests {
+		got := addIdSample(test.samples, idSample{start.Add(test.add), 10}, idRateWindow)
+		if len(got) != len(test.want) {
+			t.Errorf("%s: addIdSample() kept %d samples, want %d", test.name, len(got), len(test.want))
+			continue
+		}
+		for i, at := range test.want {
+			if !got[i].at.Equal(start.Add(at)) {
+				t.Errorf("%s: addIdSample() kept a sample from %v at %d, want %v", test.name, got[i].at, i, start.Add(at))
+			}
+		}
+	}
+}
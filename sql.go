@@ -9,64 +9,72 @@
  *  - This file is long, but including the SQL here (opposed to external SQL files) means the SQL gets built into the binary making things easier
  */
 
-package main
+package gopartman
 
-import (
-	"log"
-)
-
-// Checks if the partition management schema exist in the database.
-func (db DB) sqlFunctionsExist() bool {
-	var count int
-	err := db.Get(&count, "SELECT COUNT(schema_name) FROM information_schema.schemata WHERE schema_name = 'partman';")
+// Checks if pg_partman is installed in the database.
+func (db DB) SqlFunctionsExist() bool {
+	installed, err := db.partmanInstalled()
 	if err != nil {
-		log.Printf("%v", err)
-		return false
+		db.Log.Error(err)
 	}
+	return installed
+}
 
-	// SELECT count(*) FROM pg_proc WHERE proname = 'create_parent';
-
-	return count > 0
+// Checks if pg_partman is installed in the database, returning any error from the check itself.
+// The partman schema existing isn't enough, it's pg_partman's configuration table and create_parent() that are needed.
+func (db DB) partmanInstalled() (bool, error) {
+	var installed bool
+	err := db.Get(&installed, `SELECT to_regclass('partman.part_config') IS NOT NULL AND EXISTS (SELECT 1 FROM pg_proc p
+		JOIN pg_namespace n ON n.oid = p.pronamespace WHERE n.nspname = 'partman' AND p.proname = 'create_parent')`)
+	if err != nil {
+		return false, &SQLError{Op: "check for pg_partman", Err: err}
+	}
+	return installed, nil
 }
 
 // Loads pg_partman functions, types, schema, etc. Call this for each database.
-func (db DB) loadPgPartman() {
+func (db DB) LoadPgPartman() error {
 	// Everything is going under a partman schema.
 	_, err := db.Exec("CREATE SCHEMA IF NOT EXISTS partman;")
 	if err != nil {
-		log.Printf("%v", err)
+		return &SQLError{Op: "create partman schema", Err: err}
 	}
 
-	db.loadSqlTables()
-	db.loadSqlTypes()
-	db.loadSqlFunctions()
+	if err = db.loadSqlTables(); err != nil {
+		return &SQLError{Op: "load partman tables", Err: err}
+	}
+	if err = db.loadSqlTypes(); err != nil {
+		return &SQLError{Op: "load partman types", Err: err}
+	}
+	if err = db.loadSqlFunctions(); err != nil {
+		return &SQLError{Op: "load partman functions", Err: err}
+	}
+	return nil
 }
 
 // Removes the partman schema including all objects.
-func (db DB) unloadPartman() {
+func (db DB) UnloadPartman() error {
 	_, err := db.Exec("DROP SCHEMA IF EXISTS partman CASCADE;")
 	if err != nil {
-		log.Printf("%v", err)
+		return &SQLError{Op: "drop partman schema", Err: err}
 	}
+	return nil
 }
 
 // Loads types
-func (db DB) loadSqlTypes() {
+func (db DB) loadSqlTypes() error {
 	_, err := db.Exec(`
 		CREATE TYPE partman.check_parent_table AS (parent_table text, count bigint);
 	`)
-	if err != nil {
-		log.Printf("%v", err)
-	}
+	return err
 }
 
 // Loads functions from pg_partman
-func (db DB) loadSqlFunctions() {
+func (db DB) loadSqlFunctions() error {
 	var err error
-	tx, err := db.Begin()
+	tx, err := db.begin()
 	if err != nil {
-		log.Printf("%v", err)
-		return
+		return err
 	}
 
 	// apply_constraints()
@@ -272,7 +280,8 @@ func (db DB) loadSqlFunctions() {
 		$$;
 	`)
 	if err != nil {
-		log.Printf("%v", err)
+		tx.Rollback()
+		return err
 	}
 
 	// apply_foreign_keys
@@ -396,7 +405,8 @@ func (db DB) loadSqlFunctions() {
 		$$;
 	`)
 	if err != nil {
-		log.Printf("%v", err)
+		tx.Rollback()
+		return err
 	}
 
 	// check_name_length()
@@ -440,7 +450,8 @@ func (db DB) loadSqlFunctions() {
 		$$;
 	`)
 	if err != nil {
-		log.Printf("%v", err)
+		tx.Rollback()
+		return err
 	}
 
 	// check_parent()
@@ -483,7 +494,8 @@ func (db DB) loadSqlFunctions() {
 		$$;
 	`)
 	if err != nil {
-		log.Printf("%v", err)
+		tx.Rollback()
+		return err
 	}
 
 	// check_version()
@@ -524,7 +536,8 @@ func (db DB) loadSqlFunctions() {
 		$$;
 	`)
 	if err != nil {
-		log.Printf("%v", err)
+		tx.Rollback()
+		return err
 	}
 
 	// create_function_id
@@ -796,7 +809,8 @@ func (db DB) loadSqlFunctions() {
 		$$;
 	`)
 	if err != nil {
-		log.Printf("%v", err)
+		tx.Rollback()
+		return err
 	}
 
 	// create_function_time()
@@ -1055,7 +1069,8 @@ func (db DB) loadSqlFunctions() {
 		$$;
 	`)
 	if err != nil {
-		log.Printf("%v", err)
+		tx.Rollback()
+		return err
 	}
 
 	// create_parent()
@@ -1538,7 +1553,8 @@ func (db DB) loadSqlFunctions() {
 	$$;
 	`)
 	if err != nil {
-		log.Printf("%v", err)
+		tx.Rollback()
+		return err
 	}
 
 	// create_partition_id()
@@ -1802,7 +1818,8 @@ func (db DB) loadSqlFunctions() {
 		$$;
 	`)
 	if err != nil {
-		log.Printf("%v", err)
+		tx.Rollback()
+		return err
 	}
 
 	// create_partition_time()
@@ -2142,7 +2159,8 @@ func (db DB) loadSqlFunctions() {
 		$$;
 	`)
 	if err != nil {
-		log.Printf("%v", err)
+		tx.Rollback()
+		return err
 	}
 
 	// create_sub_parent()
@@ -2249,7 +2267,8 @@ func (db DB) loadSqlFunctions() {
 		$$;
 	`)
 	if err != nil {
-		log.Printf("%v", err)
+		tx.Rollback()
+		return err
 	}
 
 	// create_trigger()
@@ -2281,7 +2300,8 @@ func (db DB) loadSqlFunctions() {
 		$$;
 	`)
 	if err != nil {
-		log.Printf("%v", err)
+		tx.Rollback()
+		return err
 	}
 
 	// drop_constraints()
@@ -2391,7 +2411,8 @@ func (db DB) loadSqlFunctions() {
 		$$;
 	`)
 	if err != nil {
-		log.Printf("%v", err)
+		tx.Rollback()
+		return err
 	}
 
 	// drop_partition_id()
@@ -2599,7 +2620,8 @@ func (db DB) loadSqlFunctions() {
 		$$;
 	`)
 	if err != nil {
-		log.Printf("%v", err)
+		tx.Rollback()
+		return err
 	}
 
 	// drop_partition_time()
@@ -2828,7 +2850,8 @@ func (db DB) loadSqlFunctions() {
 		$$;
 	`)
 	if err != nil {
-		log.Printf("%v", err)
+		tx.Rollback()
+		return err
 	}
 
 	// partition_data_id()
@@ -2960,7 +2983,8 @@ func (db DB) loadSqlFunctions() {
 		$$;
 	`)
 	if err != nil {
-		log.Printf("%v", err)
+		tx.Rollback()
+		return err
 	}
 
 	// partition_data_time()
@@ -3167,7 +3191,8 @@ func (db DB) loadSqlFunctions() {
 		$$;
 	`)
 	if err != nil {
-		log.Printf("%v", err)
+		tx.Rollback()
+		return err
 	}
 
 	// reapply_privileges()
@@ -3302,7 +3327,8 @@ func (db DB) loadSqlFunctions() {
 		$$;
 	`)
 	if err != nil {
-		log.Printf("%v", err)
+		tx.Rollback()
+		return err
 	}
 
 	// run_maintenance()
@@ -3567,7 +3593,8 @@ func (db DB) loadSqlFunctions() {
 		$$;
 	`)
 	if err != nil {
-		log.Printf("%v", err)
+		tx.Rollback()
+		return err
 	}
 
 	// show_partitions()
@@ -3625,7 +3652,8 @@ func (db DB) loadSqlFunctions() {
 		$$;
 	`)
 	if err != nil {
-		log.Printf("%v", err)
+		tx.Rollback()
+		return err
 	}
 
 	// undo_partition()
@@ -3854,7 +3882,8 @@ func (db DB) loadSqlFunctions() {
 		$$;
 	`)
 	if err != nil {
-		log.Printf("%v", err)
+		tx.Rollback()
+		return err
 	}
 
 	// undo_partition_id()
@@ -4125,7 +4154,8 @@ func (db DB) loadSqlFunctions() {
 		$$;
 	`)
 	if err != nil {
-		log.Printf("%v", err)
+		tx.Rollback()
+		return err
 	}
 
 	// undo_partition_time()
@@ -4395,19 +4425,19 @@ func (db DB) loadSqlFunctions() {
 		$$;
 	`)
 	if err != nil {
-		log.Printf("%v", err)
+		tx.Rollback()
+		return err
 	}
 
-	tx.Commit()
+	return tx.Commit()
 }
 
 // Sets up tables to keep track of partitions
-func (db DB) loadSqlTables() {
+func (db DB) loadSqlTables() error {
 	var err error
-	tx, err := db.Begin()
+	tx, err := db.begin()
 	if err != nil {
-		log.Printf("%v", err)
-		return
+		return err
 	}
 
 	_, err = tx.Exec(`
@@ -4512,7 +4542,8 @@ func (db DB) loadSqlTables() {
 		CHECK (partman.check_subpart_sameconfig(sub_parent));
 	`)
 	if err != nil {
-		log.Printf("%v", err)
+		tx.Rollback()
+		return err
 	}
 
 	// 92/tables/tables.sql
@@ -4525,8 +4556,9 @@ func (db DB) loadSqlTables() {
 		CREATE INDEX custom_time_partitions_partition_range_idx ON partman.custom_time_partitions USING gist (partition_range);
 	`)
 	if err != nil {
-		log.Printf("%v", err)
+		tx.Rollback()
+		return err
 	}
 
-	tx.Commit()
+	return tx.Commit()
 }
@@ -0,0 +1,197 @@
+/**
+ * This file contains the history of child table sizes. Snapshots of each child table's rows, bytes, index bytes and dead tuples are kept
+ * in gopartman's own schema (gopartman.child_stats), so growth can be tracked over time without anything else to run.
+ * Rows and dead tuples come from Postgres' statistics (as of the last ANALYZE or autovacuum), so taking a snapshot is cheap.
+ */
+
+package gopartman
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Where snapshots are kept. It's created (along with the gopartman schema) the first time one is taken. It isn't in pg_partman's
+// schema, which would make pg_partman look installed on servers with only native partitions (see partmanInstalled()).
+const statsTableSQL = `CREATE TABLE IF NOT EXISTS gopartman.child_stats (
+	parent_table text NOT NULL,
+	child_table text NOT NULL,
+	taken timestamptz NOT NULL DEFAULT now(),
+	rows bigint NOT NULL,
+	bytes bigint NOT NULL,
+	index_bytes bigint NOT NULL,
+	dead_tuples bigint NOT NULL,
+	PRIMARY KEY (parent_table, taken, child_table)
+)`
+
+// How long snapshots are kept if Config.Stats.Keep isn't set.
+const defaultStatsKeep = "90 days"
+
+// A child table in a snapshot. Bytes include indexes and TOAST, like ChildInfo.BytesOnDisk.
+type ChildStats struct {
+	Parent     string    `json:"parent" db:"parent_table"`
+	Table      string    `json:"table" db:"child_table"`
+	Taken      time.Time `json:"taken" db:"taken"`
+	Rows       int64     `json:"rows" db:"rows"`
+	Bytes      int64     `json:"bytes" db:"bytes"`
+	IndexBytes int64     `json:"indexBytes" db:"index_bytes"`
+	DeadTuples int64     `json:"deadTuples" db:"dead_tuples"`
+}
+
+// A partition's totals as of its last snapshot of a day, with how much they changed since the day before.
+type StatsDay struct {
+	Day         time.Time `json:"day" db:"day"`
+	Rows        int64     `json:"rows" db:"rows"`
+	Bytes       int64     `json:"bytes" db:"bytes"`
+	IndexBytes  int64     `json:"indexBytes" db:"index_bytes"`
+	DeadTuples  int64     `json:"deadTuples" db:"dead_tuples"`
+	RowsGrowth  int64     `json:"rowsGrowth" db:"-"`
+	BytesGrowth int64     `json:"bytesGrowth" db:"-"`
+}
+
+// A child table as of its latest snapshot, with how much it grew since its first snapshot in a window.
+type ChildGrowth struct {
+	ChildStats
+	RowsGrowth  int64 `json:"rowsGrowth"`
+	BytesGrowth int64 `json:"bytesGrowth"`
+}
+
+// Checks whether there are any snapshots to read (the table is only created when the first is taken).
+func (db DB) statsExist() (bool, error) {
+	var exists bool
+	if err := db.Get(&exists, "SELECT to_regclass('gopartman.child_stats') IS NOT NULL"); err != nil {
+		return false, &SQLError{Op: "read gopartman.child_stats", Err: err}
+	}
+	return exists, nil
+}
+
+// Takes a snapshot of the size of each of a partition's child tables, then removes snapshots older than keep (a Postgres interval,
+// 90 days if empty) for every partition on the server.
+func (db DB) SnapshotStats(p *Partition, keep string) error {
+	if keep == "" {
+		keep = defaultStatsKeep
+	}
+	tables, err := db.childTableNames(p)
+	if err != nil {
+		return err
+	}
+	if _, err := db.Exec("CREATE SCHEMA IF NOT EXISTS gopartman"); err != nil {
+		return &SQLError{Op: "create the gopartman schema", Table: p.Table, Err: err}
+	}
+	if _, err := db.Exec(statsTableSQL); err != nil {
+		return &SQLError{Op: "create gopartman.child_stats", Table: p.Table, Err: err}
+	}
+	_, err = db.Exec(`INSERT INTO gopartman.child_stats (parent_table, child_table, rows, bytes, index_bytes, dead_tuples)
+		SELECT $1, c, COALESCE(s.n_live_tup, 0), pg_total_relation_size(c::regclass), pg_indexes_size(c::regclass), COALESCE(s.n_dead_tup, 0)
+		FROM unnest($2::text[]) c LEFT JOIN pg_stat_user_tables s ON s.relid = c::regclass`, p.Table, pq.StringArray(tables))
+	if err != nil {
+		return &SQLError{Op: "snapshot child tables", Table: p.Table, Err: err}
+	}
+	if _, err := db.Exec("DELETE FROM gopartman.child_stats WHERE taken < now() - $1::interval", keep); err != nil {
+		return &SQLError{Op: "remove old snapshots", Table: p.Table, Err: err}
+	}
+	return nil
+}
+
+// Takes a snapshot of every configured partition (list and hash ones too) on every server. With coordination configured, only the
+// partitions this process is the leader for are snapshotted, so several daemons don't record the same thing. Failures are logged
+// and the rest carry on, the last error is returned.
+func (m *Manager) SnapshotStats() error {
+	m.RLock()
+	keep := m.Config.Stats.Keep
+	refs := []PartitionRef{}
+	for serverName, db := range m.Connections {
+		for name := range db.Partitions {
+			refs = append(refs, PartitionRef{Server: serverName, Partition: name})
+		}
+	}
+	m.RUnlock()
+
+	var lastErr error
+	for _, ref := range refs {
+		if leader, err := m.IsLeader(ref.Server, ref.Partition); !leader {
+			if err != nil {
+				m.Log.Error(err)
+				lastErr = err
+			}
+			continue
+		}
+		db, p, err := m.GetPartition(ref.Server, ref.Partition)
+		if err == nil {
+			err = db.SnapshotStats(p, keep)
+		}
+		if err != nil {
+			m.Log.Error("Couldn't take a snapshot of " + ref.Partition + " on " + ref.Server + ": " + err.Error())
+			lastErr = err
+		}
+	}
+	return lastErr
+}
+
+// Returns a partition's totals for each of the last given number of days it has snapshots for, oldest first. Each day's totals are
+// from its last snapshot, and the growth of the first day is from the snapshot before it (if there is one).
+func (db DB) DailyStats(p *Partition, days int) ([]StatsDay, error) {
+	stats := []StatsDay{}
+	if days < 1 {
+		return stats, fmt.Errorf("%w: days must be at least 1", ErrInvalidPartition)
+	}
+	if exists, err := db.statsExist(); err != nil || !exists {
+		return stats, err
+	}
+	// One more day is read so the first day has something to grow from
+	err := db.Select(&stats, `WITH last AS (
+			SELECT DISTINCT ON (date_trunc('day', taken)) date_trunc('day', taken) AS day, taken
+			FROM gopartman.child_stats WHERE parent_table = $1 AND taken >= date_trunc('day', now()) - interval '1 day' * $2
+			ORDER BY date_trunc('day', taken), taken DESC
+		)
+		SELECT l.day, SUM(s.rows)::bigint AS rows, SUM(s.bytes)::bigint AS bytes, SUM(s.index_bytes)::bigint AS index_bytes, SUM(s.dead_tuples)::bigint AS dead_tuples
+		FROM last l JOIN gopartman.child_stats s ON s.parent_table = $1 AND s.taken = l.taken
+		GROUP BY l.day ORDER BY l.day`, p.Table, days)
+	if err != nil {
+		return stats, &SQLError{Op: "read gopartman.child_stats", Table: p.Table, Err: err}
+	}
+	for i := 1; i < len(stats); i++ {
+		stats[i].RowsGrowth = stats[i].Rows - stats[i-1].Rows
+		stats[i].BytesGrowth = stats[i].Bytes - stats[i-1].Bytes
+	}
+	if len(stats) > days {
+		stats = stats[len(stats)-days:]
+	}
+	return stats, nil
+}
+
+// Returns each of a partition's child tables as of its latest snapshot in the last given number of days, with how much it grew since
+// its first snapshot in that time. The largest (in bytes) come first.
+func (db DB) ChildGrowth(p *Partition, days int) ([]ChildGrowth, error) {
+	growth := []ChildGrowth{}
+	if days < 1 {
+		return growth, fmt.Errorf("%w: days must be at least 1", ErrInvalidPartition)
+	}
+	if exists, err := db.statsExist(); err != nil || !exists {
+		return growth, err
+	}
+	rows, err := db.Queryx(`SELECT DISTINCT ON (child_table) parent_table, child_table, taken, rows, bytes, index_bytes, dead_tuples,
+			rows - first_value(rows) OVER w AS rows_growth, bytes - first_value(bytes) OVER w AS bytes_growth
+		FROM gopartman.child_stats WHERE parent_table = $1 AND taken >= now() - interval '1 day' * $2
+		WINDOW w AS (PARTITION BY child_table ORDER BY taken)
+		ORDER BY child_table, taken DESC`, p.Table, days)
+	if err != nil {
+		return growth, &SQLError{Op: "read gopartman.child_stats", Table: p.Table, Err: err}
+	}
+	defer rows.Close()
+	for rows.Next() {
+		g := ChildGrowth{}
+		if err := rows.Scan(&g.Parent, &g.Table, &g.Taken, &g.Rows, &g.Bytes, &g.IndexBytes, &g.DeadTuples, &g.RowsGrowth, &g.BytesGrowth); err != nil {
+			return growth, &SQLError{Op: "read gopartman.child_stats", Table: p.Table, Err: err}
+		}
+		growth = append(growth, g)
+	}
+	if err := rows.Err(); err != nil {
+		return growth, &SQLError{Op: "read gopartman.child_stats", Table: p.Table, Err: err}
+	}
+	sort.SliceStable(growth, func(i, j int) bool { return growth[i].Bytes > growth[j].Bytes })
+	return growth, nil
+}
@@ -0,0 +1,236 @@
+/**
+ * This file contains functions for native list and hash partitions.
+ * List partitions have a child table for each configured list of values, plus a default child table. Values which show
+ * up in the default child table are split out into child tables of their own by maintenance.
+ * Hash partitions spread rows across a fixed number (the modulus) of child tables.
+ */
+
+package gopartman
+
+import (
+	"fmt"
+	"github.com/lib/pq"
+	"hash/fnv"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// The most new values split out of the default child table of a list partition each time maintenance runs.
+const maxListSplits = 100
+
+// Names of list partition children (the part after "<table>_p_").
+var listNameRegexp = regexp.MustCompile(`^[a-z0-9_]{1,40}$`)
+
+// The longest table name Postgres keeps, longer names are cut short without an error (so they'd never match when looked up).
+const maxIdentifierLength = 63
+
+// The length of a hashed value name, see listValueName().
+const hashedValueNameLength = 17
+
+// Room left after a value's name for the number uniqueTableName() might add to it.
+const uniqueSuffixLength = 4
+
+// Checks the list or hash settings of a partition.
+func (p Partition) validateStrategy() error {
+	if p.Retention != "" {
+		return fmt.Errorf("%w: retention can't be used with %s partitions", ErrInvalidPartition, p.Type)
+	}
+	switch p.Type {
+	case HashType:
+		if p.Modulus < 1 {
+			return fmt.Errorf("%w: hash partitions need a modulus (the number of child tables)", ErrInvalidPartition)
+		}
+		if err := p.checkChildName("_p" + strconv.Itoa(p.Modulus-1)); err != nil {
+			return err
+		}
+	case ListType:
+		for _, suffix := range []string{"_default", "_v_" + strings.Repeat("x", hashedValueNameLength+uniqueSuffixLength)} {
+			if err := p.checkChildName(suffix); err != nil {
+				return err
+			}
+		}
+		seen := map[string]string{}
+		for name, values := range p.Lists {
+			if !listNameRegexp.MatchString(name) {
+				return fmt.Errorf("%w: list names can only have lowercase letters, numbers and underscores", ErrInvalidPartition)
+			}
+			if len(values) == 0 {
+				return fmt.Errorf("%w: the %s list has no values", ErrInvalidPartition, name)
+			}
+			if err := p.checkChildName("_p_" + name); err != nil {
+				return err
+			}
+			for _, v := range values {
+				if other, ok := seen[v]; ok {
+					return fmt.Errorf("%w: %s is in both the %s and %s lists", ErrInvalidPartition, v, other, name)
+				}
+				seen[v] = name
+			}
+		}
+	}
+	return nil
+}
+
+// Checks that a child table named with the suffix fits in a Postgres table name.
+func (p Partition) checkChildName(suffix string) error {
+	if len(relationName(p.Table)+suffix) > maxIdentifierLength {
+		return fmt.Errorf("%w: the child table %s%s would be longer than the %d characters Postgres allows, use a shorter table (or list) name", ErrInvalidPartition, p.Table, suffix, maxIdentifierLength)
+	}
+	return nil
+}
+
+// Returns a table's name without its schema.
+func relationName(table string) string {
+	return table[strings.LastIndex(table, ".")+1:]
+}
+
+// Creates any of a hash partition's child tables which don't exist yet.
+func (db DB) hashMaintenance(p *Partition) error {
+	existing, err := db.nativeChildTables(p.Table)
+	if err != nil {
+		return err
+	}
+	for remainder := 0; remainder < p.Modulus; remainder++ {
+		table := p.Table + "_p" + strconv.Itoa(remainder)
+		if stringInSlice(table, existing) {
+			continue
+		}
+		_, err := db.Exec("CREATE TABLE IF NOT EXISTS " + table + " PARTITION OF " + p.Table + " FOR VALUES WITH (MODULUS " + strconv.Itoa(p.Modulus) + ", REMAINDER " + strconv.Itoa(remainder) + ")")
+		if err != nil {
+			return &SQLError{Op: "create child table " + table, Table: p.Table, Err: err}
+		}
+		db.Log.Info("Created child table " + table + ".")
+	}
+	return nil
+}
+
+// Creates the default child table and a child table for each configured list of values, then splits any values which
+// ended up in the default child table out into child tables of their own.
+func (db DB) listMaintenance(p *Partition) error {
+	existing, err := db.nativeChildTables(p.Table)
+	if err != nil {
+		return err
+	}
+	defaultTable := p.Table + "_default"
+	if !stringInSlice(defaultTable, existing) {
+		if _, err := db.Exec("CREATE TABLE IF NOT EXISTS " + defaultTable + " PARTITION OF " + p.Table + " DEFAULT"); err != nil {
+			return &SQLError{Op: "create child table " + defaultTable, Table: p.Table, Err: err}
+		}
+		db.Log.Info("Created child table " + defaultTable + ".")
+	}
+
+	names := []string{}
+	for name := range p.Lists {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		table := p.Table + "_p_" + name
+		if stringInSlice(table, existing) {
+			continue
+		}
+		if err := db.splitListChild(p, defaultTable, table, p.Lists[name]); err != nil {
+			return err
+		}
+	}
+
+	values := []string{}
+	err = db.Select(&values, "SELECT DISTINCT "+pq.QuoteIdentifier(p.Column)+"::text FROM "+defaultTable+" WHERE "+pq.QuoteIdentifier(p.Column)+" IS NOT NULL ORDER BY 1 LIMIT "+strconv.Itoa(maxListSplits))
+	if err != nil {
+		return &SQLError{Op: "find new values", Table: defaultTable, Err: err}
+	}
+	// Different values can end up with the same name (two hashes can be the same, or a value can look like a hash)
+	taken := map[string]bool{}
+	for _, table := range existing {
+		taken[table] = true
+	}
+	for _, v := range values {
+		room := maxIdentifierLength - len(relationName(p.Table)+"_v_") - uniqueSuffixLength
+		table := uniqueTableName(p.Table+"_v_"+listValueName(v, room), taken)
+		if err := db.splitListChild(p, defaultTable, table, []string{v}); err != nil {
+			return err
+		}
+		taken[table] = true
+	}
+	return nil
+}
+
+// Returns the name, or if it's taken, the name with the lowest number after it that isn't.
+func uniqueTableName(name string, taken map[string]bool) string {
+	unique := name
+	for n := 2; taken[unique]; n++ {
+		unique = name + "_" + strconv.Itoa(n)
+	}
+	return unique
+}
+
+// Creates a child table for a list of values, moving any rows with those values out of the default child table.
+// The default child table is detached while this happens (all in one transaction) because Postgres won't attach a
+// child table for values the default child table already has rows for.
+func (db DB) splitListChild(p *Partition, defaultTable string, table string, values []string) error {
+	literals := make([]string, len(values))
+	for i, v := range values {
+		literals[i] = pq.QuoteLiteral(v)
+	}
+	in := "(" + strings.Join(literals, ", ") + ")"
+	column := pq.QuoteIdentifier(p.Column)
+
+	tx, err := db.begin()
+	if err != nil {
+		return &SQLError{Op: "begin", Table: p.Table, Err: err}
+	}
+	statements := []string{
+		"ALTER TABLE " + p.Table + " DETACH PARTITION " + defaultTable,
+		"CREATE TABLE " + table + " PARTITION OF " + p.Table + " FOR VALUES IN " + in,
+		"INSERT INTO " + table + " SELECT * FROM " + defaultTable + " WHERE " + column + " IN " + in,
+		"DELETE FROM " + defaultTable + " WHERE " + column + " IN " + in,
+		"ALTER TABLE " + p.Table + " ATTACH PARTITION " + defaultTable + " DEFAULT",
+	}
+	for _, statement := range statements {
+		if _, err := tx.Exec(statement); err != nil {
+			tx.Rollback()
+			return &SQLError{Op: "split child table " + table + " from " + defaultTable, Table: p.Table, Err: err}
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return &SQLError{Op: "commit", Table: p.Table, Err: err}
+	}
+	db.Log.Info("Created child table " + table + " for " + strings.Join(values, ", ") + ".")
+	return nil
+}
+
+// Returns the name used for the child table of a value which showed up in a list partition's default child table.
+// Values which can't be part of a table name (or are longer than room) use a hash of the value instead. Names aren't always
+// unique, see uniqueTableName().
+func listValueName(v string, room int) string {
+	name := strings.ToLower(v)
+	if listNameRegexp.MatchString(name) && name == v && len(name) <= room {
+		return name
+	}
+	h := fnv.New64a()
+	h.Write([]byte(v))
+	return fmt.Sprintf("h%016x", h.Sum64())
+}
+
+// Checks whether the values of any list which was already configured have changed (or the list was removed). Its child
+// table already holds the old values and wouldn't be changed, so new lists can be added but existing ones can't be changed.
+func listsChanged(current map[string][]string, lists map[string][]string) bool {
+	for name, values := range current {
+		changed, ok := lists[name]
+		if !ok || len(changed) != len(values) {
+			return true
+		}
+		sorted := append([]string{}, values...)
+		sort.Strings(sorted)
+		sortedChanged := append([]string{}, changed...)
+		sort.Strings(sortedChanged)
+		for i := range sorted {
+			if sorted[i] != sortedChanged[i] {
+				return true
+			}
+		}
+	}
+	return false
+}
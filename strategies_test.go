@@ -0,0 +1,96 @@
+package gopartman
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestListValueName(t *testing.T) {
+	tests := []struct {
+		value  string
+		room   int
+		hashed bool
+	}{
+		{"us_east", 40, false},
+		{"42", 40, false},
+		{"US_EAST", 40, true},
+		{"us-east", 40, true},
+		{"", 40, true},
+		{"us_east", 7, false},
+		{"us_east", 6, true},
+		{strings.Repeat("a", 41), 60, true},
+	}
+	for _, test := range tests {
+		got := listValueName(test.value, test.room)
+		if test.hashed && (len(got) != hashedValueNameLength || got[0] != 'h') {
+			t.Errorf("listValueName(%q, %d) returned %s, want a hash", test.value, test.room, got)
+		}
+		if !test.hashed && got != test.value {
+			t.Errorf("listValueName(%q, %d) returned %s, want %s", test.value, test.room, got, test.value)
+		}
+	}
+	if listValueName("US_EAST", 40) == listValueName("us-east", 40) {
+		t.Errorf("listValueName() returned the same hash for different values")
+	}
+}
+
+func TestUniqueTableName(t *testing.T) {
+	taken := map[string]bool{"public.orders_v_a": true, "public.orders_v_a_2": true}
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"public.orders_v_b", "public.orders_v_b"},
+		{"public.orders_v_a", "public.orders_v_a_3"},
+	}
+	for _, test := range tests {
+		if got := uniqueTableName(test.name, taken); got != test.want {
+			t.Errorf("uniqueTableName(%s) returned %s, want %s", test.name, got, test.want)
+		}
+	}
+}
+
+func TestListsChanged(t *testing.T) {
+	current := map[string][]string{"big": {"1", "7"}, "small": {"2", "3"}}
+	tests := []struct {
+		name    string
+		lists   map[string][]string
+		changed bool
+	}{
+		{"the same", map[string][]string{"big": {"1", "7"}, "small": {"2", "3"}}, false},
+		{"reordered", map[string][]string{"big": {"7", "1"}, "small": {"3", "2"}}, false},
+		{"a list added", map[string][]string{"big": {"1", "7"}, "small": {"2", "3"}, "new": {"9"}}, false},
+		{"a value added", map[string][]string{"big": {"1", "7", "8"}, "small": {"2", "3"}}, true},
+		{"a value replaced", map[string][]string{"big": {"1", "8"}, "small": {"2", "3"}}, true},
+		{"a list removed", map[string][]string{"big": {"1", "7"}}, true},
+	}
+	for _, test := range tests {
+		if got := listsChanged(current, test.lists); got != test.changed {
+			t.Errorf("%s: listsChanged() returned %v, want %v", test.name, got, test.changed)
+		}
+	}
+}
+
+func TestValidateStrategyNameLength(t *testing.T) {
+	tests := []struct {
+		p     Partition
+		valid bool
+	}{
+		{Partition{Table: "public." + strings.Repeat("t", 39), Type: ListType, Lists: map[string][]string{"a": {"1"}}}, true},
+		{Partition{Table: "public." + strings.Repeat("t", 40), Type: ListType, Lists: map[string][]string{"a": {"1"}}}, false},
+		{Partition{Table: "public." + strings.Repeat("t", 20), Type: ListType, Lists: map[string][]string{strings.Repeat("l", 40): {"1"}}}, true},
+		{Partition{Table: "public." + strings.Repeat("t", 21), Type: ListType, Lists: map[string][]string{strings.Repeat("l", 40): {"1"}}}, false},
+		{Partition{Table: "public." + strings.Repeat("t", 60), Type: HashType, Modulus: 10}, true},
+		{Partition{Table: "public." + strings.Repeat("t", 60), Type: HashType, Modulus: 11}, false},
+	}
+	for _, test := range tests {
+		err := test.p.validateStrategy()
+		if test.valid && err != nil {
+			t.Errorf("validateStrategy() for %s returned %v, want no error", test.p.Table, err)
+		}
+		if !test.valid && !errors.Is(err, ErrInvalidPartition) {
+			t.Errorf("validateStrategy() for %s returned %v, want ErrInvalidPartition", test.p.Table, err)
+		}
+	}
+}
@@ -0,0 +1,165 @@
+/**
+ * This file contains functions for sub-partitioning with pg_partman (create_sub_parent() and partman.part_config_sub).
+ * Each child table of a sub-partitioned partition is the parent of its own partition set, which can be sub-partitioned again.
+ */
+
+package gopartman
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Selects every table below a parent table (as "table") and how far below it is (as "depth").
+const partitionTreeSQL = `WITH RECURSIVE tree(oid, depth) AS (
+		SELECT $1::regclass::oid, 0
+		UNION ALL
+		SELECT i.inhrelid, t.depth + 1 FROM pg_inherits i JOIN tree t ON i.inhparent = t.oid
+	), tables AS (
+		SELECT n.nspname || '.' || c.relname AS name, tree.depth FROM tree
+		JOIN pg_class c ON c.oid = tree.oid JOIN pg_namespace n ON n.oid = c.relnamespace
+		WHERE tree.depth > 0
+	)`
+
+// Checks a level of sub-partitioning (and the levels below it).
+func (s SubPartition) validate() error {
+	if s.Column == "" {
+		return fmt.Errorf("%w: a column is required for sub-partitions", ErrInvalidPartition)
+	}
+	switch s.Type {
+	case "time-static", "time-dynamic":
+		if !stringInSlice(s.Interval, timeIntervals) {
+			return fmt.Errorf("%w: sub-partition interval must be one of %s", ErrInvalidPartition, strings.Join(timeIntervals, ", "))
+		}
+	case "time-custom":
+		if _, err := parseInterval(s.Interval); err != nil {
+			return fmt.Errorf("%w: %s", ErrInvalidPartition, err.Error())
+		}
+	case "id-static", "id-dynamic":
+		if i, err := strconv.ParseInt(s.Interval, 10, 64); err != nil || i < 1 {
+			return fmt.Errorf("%w: sub-partition interval must be a positive number for id partitions", ErrInvalidPartition)
+		}
+	default:
+		return fmt.Errorf("%w: sub-partition type must be a time or id type", ErrInvalidPartition)
+	}
+	if s.SubPartition != nil {
+		return s.SubPartition.validate()
+	}
+	return nil
+}
+
+// Turns every child table of a partition set into the parent of its own partition set, then does the same for the next level down.
+// New child tables made by maintenance are sub-partitioned too (pg_partman copies the partman.part_config_sub record of their siblings).
+func (db DB) createSubParents(table string, s *SubPartition) error {
+	premake := s.Premake
+	if premake < 1 {
+		premake = defaultPremake
+	}
+	_, err := db.Exec("SELECT partman.create_sub_parent($1, $2, $3, $4, p_premake => $5)", table, s.Column, s.Type, s.Interval, premake)
+	if err != nil {
+		return &SQLError{Op: "create_sub_parent", Table: table, Err: err}
+	}
+
+	// Like create_parent(), create_sub_parent() doesn't set a retention period
+	if s.Retention != "" {
+		if _, err := db.Exec("UPDATE partman.part_config_sub SET sub_retention = $2 WHERE sub_parent = $1", table, s.Retention); err != nil {
+			return &SQLError{Op: "set sub-partition retention", Table: table, Err: err}
+		}
+		_, err := db.Exec("UPDATE partman.part_config SET retention = $2 WHERE parent_table IN (SELECT partman.show_partitions($1))", table, s.Retention)
+		if err != nil {
+			return &SQLError{Op: "set sub-partition retention", Table: table, Err: err}
+		}
+	}
+
+	if s.SubPartition == nil {
+		return nil
+	}
+	// In dry-run mode the partition set was never created, so there are no child tables to go through
+	if db.DryRun != nil {
+		db.DryRun.preview("create_sub_parent() would be called for each child table of " + table + ", to sub-partition their child tables on " + s.SubPartition.Column)
+		return nil
+	}
+	children := []string{}
+	if err := db.Select(&children, "SELECT partman.show_partitions($1)", table); err != nil {
+		return &SQLError{Op: "show_partitions", Table: table, Err: err}
+	}
+	for _, child := range children {
+		if err := db.createSubParents(child, s.SubPartition); err != nil {
+			return err
+		}
+	}
+	db.Log.Info("Sub-partitioned the child tables of " + table + ".")
+	return nil
+}
+
+// Returns the sub-parent tables (those with a partman.part_config record) below a parent table, from the top level down.
+func (db DB) subParents(table string) ([]string, error) {
+	tables := []string{}
+	err := db.Select(&tables, partitionTreeSQL+` SELECT t.name FROM tables t
+		JOIN partman.part_config pc ON pc.parent_table = t.name ORDER BY t.depth, t.name`, table)
+	if err != nil {
+		return nil, &SQLError{Op: "list sub-partitions", Table: table, Err: err}
+	}
+	return tables, nil
+}
+
+// Adds the children of the sub-parent tables among c, all the way down (counted the same way, see GetChildPartitions()).
+func (db DB) addSubPartitionChildren(c []ChildInfo, subs []string, opts map[string]interface{}) error {
+	for i, child := range c {
+		if !stringInSlice(child.Table, subs) {
+			continue
+		}
+		children, err := db.GetChildPartitions(&Partition{Table: child.Table}, opts)
+		if err != nil {
+			return err
+		}
+		if err := db.addSubPartitionChildren(children, subs, opts); err != nil {
+			return err
+		}
+		c[i].Children = children
+		// A sub-parent's statistics only cover its own rows, COUNT(*) includes its children's
+		if c[i].Estimated {
+			for _, sub := range children {
+				c[i].Records += sub.Records
+			}
+		}
+	}
+	return nil
+}
+
+// Gets the sub-partitioning configuration of a partition, one record for each level below the top parent table.
+func (db DB) SubPartitionInfo(p *Partition) ([]PartConfigSub, error) {
+	subs := []PartConfigSub{}
+	if err := db.requirePartitionSet(p); err != nil {
+		return subs, err
+	}
+	// The top parent table is at depth 0, which partitionTreeSQL leaves out
+	err := db.Select(&subs, partitionTreeSQL+`, levels AS (
+			SELECT $1::text AS name, 0 AS depth UNION ALL SELECT t.name, t.depth FROM tables t
+		)
+		SELECT DISTINCT ON (l.depth) l.depth, s.sub_parent, s.sub_type, s.sub_control, s.sub_part_interval, s.sub_premake,
+			COALESCE(s.sub_retention, '') AS sub_retention
+		FROM levels l JOIN partman.part_config_sub s ON s.sub_parent = l.name
+		ORDER BY l.depth, s.sub_parent`, p.Table)
+	if err != nil {
+		return subs, &SQLError{Op: "read partman.part_config_sub", Table: p.Table, Err: err}
+	}
+	return subs, nil
+}
+
+// Returns the shortest derived schedule of a partition's sub-partitioning levels with time intervals (or an empty string if there are none).
+// The finer levels need maintenance more often than the top level does.
+func (s *SubPartition) maintenanceSchedule() string {
+	shortest := ""
+	for ; s != nil; s = s.SubPartition {
+		if !strings.HasPrefix(s.Type, "time-") {
+			continue
+		}
+		spec, err := Partition{Type: s.Type, Interval: s.Interval}.MaintenanceSchedule()
+		if err == nil && (shortest == "" || scheduleLength(spec) < scheduleLength(shortest)) {
+			shortest = spec
+		}
+	}
+	return shortest
+}